@@ -2,9 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 
-	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-lambda-go/lambdacontext"
 
@@ -12,10 +12,21 @@ import (
 	"oteltail/internal/logger"
 	"oteltail/internal/otelclient"
 	"oteltail/internal/promtail"
-	"oteltail/internal/utils"
 )
 
-func handler(ctx context.Context, ev map[string]interface{}) error {
+// The configuration and the client are created once per execution environment
+// and reused by the warm invocations, which keeps the gRPC connection open
+// between them.
+var (
+	cfg     *config.Configuration
+	oClient *otelclient.OtelClient
+)
+
+// handler processes an event. For SQS events the failed messages are
+// reported in a promtail.SQSEventResponse, which requires
+// ReportBatchItemFailures on the event source mapping, so that the messages
+// which were processed are not delivered again.
+func handler(ctx context.Context, ev map[string]interface{}) (resp any, err error) {
 
 	log := logger.GetLogger(ctx)
 
@@ -23,56 +34,93 @@ func handler(ctx context.Context, ev map[string]interface{}) error {
 
 	lctx := logger.AppendCtx(ctx, slog.String("request_id", lc.AwsRequestID))
 
-	vctx := config.ReadEnvConfig(lctx, "OTELTAIL")
+	vctx := config.WithConfig(lctx, cfg)
 
-	oClient, err := otelclient.NewOtelClient(vctx, &otelclient.OtelClientConfig{
-		Url: config.GetConfig(vctx).OtelExporterEndpoint.URL,
-	}, log)
-	if err != nil {
-		log.ErrorContext(vctx, "error initiating otel client", "error", err)
-		return err
+	// While the collector is down, fail before reading the event so that the
+	// event source backs off instead of every invocation waiting for its
+	// exports to time out.
+	if err := oClient.CheckAvailable(vctx); err != nil {
+		log.WarnContext(vctx, "collector unavailable", "error", err)
+		return nil, err
 	}
 
-	event, err := utils.CheckEventType(ev)
+	// Records are exported in the background, flush them before the
+	// execution environment is frozen. The invocation fails if they could not
+	// be delivered so that it is retried, the checkpoints are only kept once
+	// the records they cover were delivered, not merely spilled to disk. The
+	// metrics of a failed invocation are dropped since its retry counts the
+	// records again.
+	defer func() {
+		if err != nil {
+			oClient.DiscardMetrics()
+		}
+		if ferr := oClient.ForceFlush(vctx); ferr != nil {
+			log.ErrorContext(vctx, "error flushing logs", "error", ferr)
+			promtail.DiscardCheckpoints()
+			err = errors.Join(err, ferr)
+			return
+		}
+		if oClient.Spilled() {
+			log.WarnContext(vctx, "logs spilled to disk, checkpoints not saved")
+			promtail.DiscardCheckpoints()
+			return
+		}
+		if cerr := promtail.CommitCheckpoints(vctx); cerr != nil {
+			log.ErrorContext(vctx, "error saving checkpoints", "error", cerr)
+		}
+	}()
+
+	// The logs spilled by the previous invocations go out first, those which
+	// still fail stay on disk.
+	if rerr := oClient.ReplaySpill(vctx); rerr != nil {
+		log.WarnContext(vctx, "error replaying spilled logs", "error", rerr)
+	}
+
+	source, err := promtail.DetectSource(ev)
 	if err != nil {
 		log.ErrorContext(vctx, "invalid event", "error", ev)
-		return err
+		return nil, err
 	}
 
-	switch evt := event.(type) {
-	case *events.CloudWatchEvent:
-		err = promtail.ProcessEventBridgeEvent(vctx, evt, oClient, promtail.ProcessS3Event)
-	case *events.S3Event:
-		err = promtail.ProcessS3Event(vctx, evt, oClient)
-	case *events.CloudwatchLogsEvent:
-		err = promtail.ProcessCWEvent(vctx, evt, oClient)
-	case *events.KinesisEvent:
-		if config.GetConfig(vctx).ParseKinesisCwLogs {
-			err = promtail.ProcessKinesisCwEvent(vctx, evt, oClient)
-		} else {
-			err = promtail.ProcessKinesisEvent(vctx, evt, oClient)
-		}
-	case *events.SQSEvent:
-		err = promtail.ProcessSQSEvent(vctx, evt, handler)
-	case *events.SNSEvent:
-		err = promtail.ProcessSNSEvent(vctx, evt, handler)
-	// When setting up S3 Notification on a bucket, a test event is first sent, see: https://docs.aws.amazon.com/AmazonS3/latest/userguide/notification-content-structure.html
-	case *events.S3TestEvent:
-		return nil
+	err = promtail.ProcessEvent(vctx, source, ev, oClient)
+
+	var failed *promtail.FailedRecordsError
+	if source.Name() == "sqs" && errors.As(err, &failed) {
+		log.ErrorContext(vctx, "error processing records", "error", err, "failed", len(failed.IDs))
+		return failed.SQSEventResponse(), nil
 	}
 
 	if err != nil {
 		log.ErrorContext(vctx, "error processing event", "error", err)
-		return err
+		return nil, err
 	}
 
-	oClient.LogProcessor.Shutdown(vctx)
-
 	log.InfoContext(vctx, "processing complete")
 
-	return err
+	return nil, nil
 }
 
 func main() {
+	ctx := context.Background()
+
+	log := logger.GetLogger(ctx)
+
+	vctx := config.ReadEnvConfig(ctx, "OTELTAIL")
+	cfg = config.GetConfig(vctx)
+
+	if err := promtail.LoadS3Parsers(vctx); err != nil {
+		log.ErrorContext(vctx, "error loading S3 parsers", "error", err)
+		panic(err)
+	}
+
+	var err error
+	oClient, err = otelclient.NewOtelClient(vctx, &otelclient.OtelClientConfig{
+		Url: cfg.OtelExporterEndpoint.URL,
+	}, log)
+	if err != nil {
+		log.ErrorContext(vctx, "error initiating otel client", "error", err)
+		panic(err)
+	}
+
 	lambda.Start(handler)
 }
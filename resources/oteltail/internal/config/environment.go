@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"os"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/mdobak/go-xerrors"
@@ -35,18 +38,83 @@ func (w *WriteAddress) Decode(value string) error {
 
 // Configuration is
 type Configuration struct {
-	OtelExporterEndpoint  WriteAddress `envconfig:"OTEL_EXPORTER_OTLP_ENDPOINT" required:"true"`
-	OtelInsecure          bool         `envconfig:"OTEL_EXPORTER_INSECURE"`
-	OtelServiceName       string       `envconfig:"OTEL_SERVICE_NAME" required:"true"`
-	ResourceAttributesRaw string       `envconfig:"RESOURCE_ATTRIBUTES"`
-	DropAttributesRaw     string       `envconfig:"DROP_ATTRIBUTES"`
-	KeepStream            bool         `envconfig:"KEEP_STREAM"`
-	LogBatchSize          int          `envconfig:"LOG_BATCH_SIZE" default:"5"`
-	PrintLogLine          bool         `envconfig:"PRINT_LOG_LINES"`
-	ParseKinesisCwLogs    bool         `envconfig:"PARSE_KINESIS_CLOUDWATCH_LOGS"`
-	CustomS3PathRegex     string       `envconfig:"CUSTOM_S3_PATH_REGEX"`
-	ResourceAttributes    []attribute.KeyValue
-	DropAttributes        []model.LabelName
+	OtelExporterEndpoint           WriteAddress      `envconfig:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	OtelInsecure                   bool              `envconfig:"OTEL_EXPORTER_INSECURE"`
+	OtelKeepalive                  time.Duration     `envconfig:"OTEL_EXPORTER_KEEPALIVE"`
+	OtelCompression                string            `envconfig:"OTEL_EXPORTER_COMPRESSION"`
+	OtelMaxSendBytes               int               `envconfig:"OTEL_EXPORTER_MAX_SEND_BYTES" default:"4194304"`
+	OtelBreakerFailures            int               `envconfig:"OTEL_EXPORTER_BREAKER_FAILURES" default:"3"`
+	OtelBreakerOpenTimeout         time.Duration     `envconfig:"OTEL_EXPORTER_BREAKER_OPEN_TIMEOUT" default:"5s"`
+	OtelBreakerMaxOpenTimeout      time.Duration     `envconfig:"OTEL_EXPORTER_BREAKER_MAX_OPEN_TIMEOUT" default:"2m"`
+	ExporterAuth                   string            `envconfig:"EXPORTER_AUTH"`
+	ExporterAuthHeaders            map[string]string `envconfig:"EXPORTER_AUTH_HEADERS"`
+	ExporterAuthTokenFile          string            `envconfig:"EXPORTER_AUTH_TOKEN_FILE"`
+	ExporterAuthOAuth2TokenURL     string            `envconfig:"EXPORTER_AUTH_OAUTH2_TOKEN_URL"`
+	ExporterAuthOAuth2ClientID     string            `envconfig:"EXPORTER_AUTH_OAUTH2_CLIENT_ID"`
+	ExporterAuthOAuth2ClientSecret string            `envconfig:"EXPORTER_AUTH_OAUTH2_CLIENT_SECRET"`
+	ExporterAuthOAuth2Scopes       []string          `envconfig:"EXPORTER_AUTH_OAUTH2_SCOPES"`
+	ExporterAuthSigV4Service       string            `envconfig:"EXPORTER_AUTH_SIGV4_SERVICE"`
+	ExporterAuthSigV4Region        string            `envconfig:"EXPORTER_AUTH_SIGV4_REGION"`
+	OtelServiceName                string            `envconfig:"OTEL_SERVICE_NAME" required:"true"`
+	ResourceAttributesRaw          string            `envconfig:"RESOURCE_ATTRIBUTES"`
+	DropAttributesRaw              string            `envconfig:"DROP_ATTRIBUTES"`
+	KeepStream                     bool              `envconfig:"KEEP_STREAM"`
+	LogBatchSize                   int               `envconfig:"LOG_BATCH_SIZE" default:"512"`
+	LogBatchBytes                  int               `envconfig:"LOG_BATCH_BYTES" default:"3145728"`
+	LogMaxRecordBytes              int               `envconfig:"LOG_MAX_RECORD_BYTES" default:"1048576"`
+	LogOversizeAction              string            `envconfig:"LOG_OVERSIZE_ACTION" default:"truncate"`
+	PrintLogLine                   bool              `envconfig:"PRINT_LOG_LINES"`
+	ParseBody                      string            `envconfig:"PARSE_BODY"`
+	ParseBodyLogTypes              []string          `envconfig:"PARSE_BODY_LOG_TYPES" default:"cloudwatch"`
+	ParseBodyPromoteKeys           []string          `envconfig:"PARSE_BODY_PROMOTE_KEYS"`
+	ParseBodyTimestampKeys         []string          `envconfig:"PARSE_BODY_TIMESTAMP_KEYS" default:"timestamp,time,ts,@timestamp"`
+	ParseBodyLevelKeys             []string          `envconfig:"PARSE_BODY_LEVEL_KEYS" default:"level,severity,lvl,log.level"`
+	ParseBodyTraceIDKeys           []string          `envconfig:"PARSE_BODY_TRACE_ID_KEYS" default:"trace_id,traceId,traceID,trace.id"`
+	ParseBodyMessageKeys           []string          `envconfig:"PARSE_BODY_MESSAGE_KEYS" default:"message,msg"`
+	ParseBodyMaxAttributes         int               `envconfig:"PARSE_BODY_MAX_ATTRIBUTES" default:"64"`
+	ParseBodyMaxDepth              int               `envconfig:"PARSE_BODY_MAX_DEPTH" default:"5"`
+	ParseKinesisCwLogs             bool              `envconfig:"PARSE_KINESIS_CLOUDWATCH_LOGS"`
+	ParseLambdaLogs                bool              `envconfig:"PARSE_LAMBDA_LOGS"`
+	CustomS3PathRegex              string            `envconfig:"CUSTOM_S3_PATH_REGEX"`
+	DebugExporter                  string            `envconfig:"DEBUG_EXPORTER"`
+	DebugExporterPath              string            `envconfig:"DEBUG_EXPORTER_PATH" default:"/tmp/oteltail-debug.json"`
+	S3ParsersFile                  string            `envconfig:"S3_PARSERS_FILE"`
+	S3ParsersRaw                   string            `envconfig:"S3_PARSERS"`
+	EventBridgeAllowRaw            string            `envconfig:"EVENTBRIDGE_ALLOW"`
+	EventBridgeDenyRaw             string            `envconfig:"EVENTBRIDGE_DENY"`
+	ExportersFile                  string            `envconfig:"EXPORTERS_FILE"`
+	ExportersRaw                   string            `envconfig:"EXPORTERS"`
+	RateLimitsFile                 string            `envconfig:"RATE_LIMITS_FILE"`
+	RateLimitsRaw                  string            `envconfig:"RATE_LIMITS"`
+	LogMetricsFile                 string            `envconfig:"LOG_METRICS_FILE"`
+	LogMetricsRaw                  string            `envconfig:"LOG_METRICS"`
+	LogMetricsMaxSeries            int               `envconfig:"LOG_METRICS_MAX_SERIES" default:"1000"`
+	S3ExpectedBucketOwners         []string          `envconfig:"S3_EXPECTED_BUCKET_OWNERS"`
+	S3FetchConcurrency             int               `envconfig:"S3_FETCH_CONCURRENCY" default:"4"`
+	RecordConcurrency              int               `envconfig:"RECORD_CONCURRENCY" default:"4"`
+	DeadlineSafetyMargin           time.Duration     `envconfig:"DEADLINE_SAFETY_MARGIN" default:"2s"`
+	DeadlineAction                 string            `envconfig:"DEADLINE_ACTION" default:"error"`
+	CheckpointPath                 string            `envconfig:"CHECKPOINT_PATH" default:"/tmp/oteltail-checkpoints.json"`
+	SpillEnabled                   bool              `envconfig:"SPILL_ENABLED"`
+	SpillDir                       string            `envconfig:"SPILL_DIR" default:"/tmp/oteltail-spill"`
+	SpillMaxBytes                  int64             `envconfig:"SPILL_MAX_BYTES" default:"67108864"`
+	ParseErrorPolicy               string            `envconfig:"PARSE_ERROR_POLICY" default:"fail"`
+	ExportErrorPolicy              string            `envconfig:"EXPORT_ERROR_POLICY" default:"fail"`
+	DeadLetterURL                  string            `envconfig:"DEADLETTER_URL"`
+	TimestampFallback              string            `envconfig:"TIMESTAMP_FALLBACK" default:"observed"`
+	TimestampMaxAge                time.Duration     `envconfig:"TIMESTAMP_MAX_AGE"`
+	TimestampMaxFuture             time.Duration     `envconfig:"TIMESTAMP_MAX_FUTURE"`
+	TimestampOutOfWindow           string            `envconfig:"TIMESTAMP_OUT_OF_WINDOW" default:"clamp"`
+	TimestampOutOfOrder            string            `envconfig:"TIMESTAMP_OUT_OF_ORDER"`
+	ResourceAttributes             []attribute.KeyValue
+	DropAttributes                 []model.LabelName
+	S3Parsers                      []S3ParserConfig
+	EventBridgeAllow               []EventBridgeRule
+	EventBridgeDeny                []EventBridgeRule
+	Exporters                      []ExporterConfig
+	Routes                         []RouteConfig
+	RateLimits                     []RateLimitConfig
+	LogMetrics                     []MetricConfig
 }
 
 var lambdaConfig Configuration
@@ -75,7 +143,20 @@ func ReadEnvConfig(ctx context.Context, namespace string) context.Context {
 		panic(err)
 	}
 
-	log.InfoContext(ctx, "config parse", "OtelExporterEndpoint", lambdaConfig.OtelExporterEndpoint.URL.String())
+	// OTEL_EXPORTER_OTLP_LOGS_ENDPOINT is read by the exporter and takes
+	// precedence over OTEL_EXPORTER_OTLP_ENDPOINT, either is enough
+	logsEndpoint := os.Getenv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT")
+	if lambdaConfig.OtelExporterEndpoint.URL == nil && logsEndpoint == "" {
+		err = fmt.Errorf("required key OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_LOGS_ENDPOINT missing value")
+		log.ErrorContext(ctx, "unable to process environment", "error", err)
+		panic(err)
+	}
+
+	if logsEndpoint != "" {
+		log.InfoContext(ctx, "config parse", "OtelExporterLogsEndpoint", logsEndpoint)
+	} else {
+		log.InfoContext(ctx, "config parse", "OtelExporterEndpoint", lambdaConfig.OtelExporterEndpoint.URL.String())
+	}
 
 	lambdaConfig.ResourceAttributes, err = parseResourceAttributes(ctx, lambdaConfig.ResourceAttributesRaw)
 
@@ -90,9 +171,178 @@ func ReadEnvConfig(ctx context.Context, namespace string) context.Context {
 		panic(err)
 	}
 
+	lambdaConfig.S3Parsers, err = parseS3Parsers(lambdaConfig.S3ParsersFile, lambdaConfig.S3ParsersRaw)
+	if err != nil {
+		log.ErrorContext(ctx, "unable to parse S3 parsers", "error", err)
+		panic(err)
+	}
+
+	lambdaConfig.EventBridgeAllow, err = parseEventBridgeRules("EVENTBRIDGE_ALLOW", lambdaConfig.EventBridgeAllowRaw)
+	if err != nil {
+		log.ErrorContext(ctx, "unable to parse eventbridge allow rules", "error", err)
+		panic(err)
+	}
+
+	lambdaConfig.EventBridgeDeny, err = parseEventBridgeRules("EVENTBRIDGE_DENY", lambdaConfig.EventBridgeDenyRaw)
+	if err != nil {
+		log.ErrorContext(ctx, "unable to parse eventbridge deny rules", "error", err)
+		panic(err)
+	}
+
+	lambdaConfig.Exporters, lambdaConfig.Routes, err = parseExporters(lambdaConfig.ExportersFile, lambdaConfig.ExportersRaw)
+	if err != nil {
+		log.ErrorContext(ctx, "unable to parse exporters", "error", err)
+		panic(err)
+	}
+
+	lambdaConfig.RateLimits, err = parseRateLimits(lambdaConfig.RateLimitsFile, lambdaConfig.RateLimitsRaw)
+	if err != nil {
+		log.ErrorContext(ctx, "unable to parse rate limits", "error", err)
+		panic(err)
+	}
+
+	lambdaConfig.LogMetrics, err = parseMetrics(lambdaConfig.LogMetricsFile, lambdaConfig.LogMetricsRaw)
+	if err != nil {
+		log.ErrorContext(ctx, "unable to parse log metrics", "error", err)
+		panic(err)
+	}
+
+	if lambdaConfig.S3FetchConcurrency < 1 {
+		err = fmt.Errorf("invalid value for environment variable S3_FETCH_CONCURRENCY: %d", lambdaConfig.S3FetchConcurrency)
+		log.ErrorContext(ctx, "unable to parse S3 fetch concurrency", "error", err)
+		panic(err)
+	}
+
+	if lambdaConfig.RecordConcurrency < 1 {
+		err = fmt.Errorf("invalid value for environment variable RECORD_CONCURRENCY: %d", lambdaConfig.RecordConcurrency)
+		log.ErrorContext(ctx, "unable to parse record concurrency", "error", err)
+		panic(err)
+	}
+
+	switch lambdaConfig.DeadlineAction {
+	case "error", "checkpoint":
+	default:
+		err = fmt.Errorf("invalid value for environment variable DEADLINE_ACTION: %s", lambdaConfig.DeadlineAction)
+		log.ErrorContext(ctx, "unable to parse deadline action", "error", err)
+		panic(err)
+	}
+
+	switch lambdaConfig.ParseErrorPolicy {
+	case "fail", "skip", "raw":
+	case "deadletter":
+		if lambdaConfig.DeadLetterURL == "" {
+			err = fmt.Errorf("environment variable DEADLETTER_URL is required by the deadletter parse error policy")
+			log.ErrorContext(ctx, "invalid parse error policy", "error", err)
+			panic(err)
+		}
+	default:
+		err = fmt.Errorf("invalid value for environment variable PARSE_ERROR_POLICY: %s", lambdaConfig.ParseErrorPolicy)
+		log.ErrorContext(ctx, "invalid parse error policy", "error", err)
+		panic(err)
+	}
+
+	switch lambdaConfig.ExportErrorPolicy {
+	case "fail":
+	case "deadletter":
+		if lambdaConfig.DeadLetterURL == "" {
+			err = fmt.Errorf("environment variable DEADLETTER_URL is required by the deadletter export error policy")
+			log.ErrorContext(ctx, "invalid export error policy", "error", err)
+			panic(err)
+		}
+	default:
+		err = fmt.Errorf("invalid value for environment variable EXPORT_ERROR_POLICY: %s", lambdaConfig.ExportErrorPolicy)
+		log.ErrorContext(ctx, "invalid export error policy", "error", err)
+		panic(err)
+	}
+
+	switch lambdaConfig.TimestampFallback {
+	case "observed", "skip", "error":
+	default:
+		err = fmt.Errorf("invalid value for environment variable TIMESTAMP_FALLBACK: %s", lambdaConfig.TimestampFallback)
+		log.ErrorContext(ctx, "invalid timestamp fallback", "error", err)
+		panic(err)
+	}
+
+	switch lambdaConfig.TimestampOutOfWindow {
+	case "clamp", "tag", "drop":
+	default:
+		err = fmt.Errorf("invalid value for environment variable TIMESTAMP_OUT_OF_WINDOW: %s", lambdaConfig.TimestampOutOfWindow)
+		log.ErrorContext(ctx, "invalid timestamp window action", "error", err)
+		panic(err)
+	}
+
+	switch lambdaConfig.TimestampOutOfOrder {
+	case "", "clamp", "tag", "drop":
+	default:
+		err = fmt.Errorf("invalid value for environment variable TIMESTAMP_OUT_OF_ORDER: %s", lambdaConfig.TimestampOutOfOrder)
+		log.ErrorContext(ctx, "invalid timestamp order action", "error", err)
+		panic(err)
+	}
+
+	if lambdaConfig.LogBatchSize < 1 || lambdaConfig.LogBatchBytes < 1 || lambdaConfig.LogMaxRecordBytes > lambdaConfig.LogBatchBytes {
+		err = fmt.Errorf("invalid batch limits: LOG_BATCH_SIZE and LOG_BATCH_BYTES must be positive and LOG_MAX_RECORD_BYTES at most LOG_BATCH_BYTES")
+		log.ErrorContext(ctx, "invalid batch limits", "error", err)
+		panic(err)
+	}
+
+	if err = validateCompression(lambdaConfig.OtelCompression); err != nil {
+		err = fmt.Errorf("invalid value for environment variable OTEL_EXPORTER_COMPRESSION: %w", err)
+		log.ErrorContext(ctx, "invalid exporter compression", "error", err)
+		panic(err)
+	}
+
+	switch lambdaConfig.ExporterAuth {
+	case "", "bearer_file", "oauth2", "sigv4":
+	default:
+		err = fmt.Errorf("invalid value for environment variable EXPORTER_AUTH: %s", lambdaConfig.ExporterAuth)
+		log.ErrorContext(ctx, "invalid exporter auth", "error", err)
+		panic(err)
+	}
+
+	switch {
+	case lambdaConfig.ExporterAuth == "bearer_file" && lambdaConfig.ExporterAuthTokenFile == "":
+		err = fmt.Errorf("EXPORTER_AUTH=bearer_file requires EXPORTER_AUTH_TOKEN_FILE")
+	case lambdaConfig.ExporterAuth == "oauth2" && (lambdaConfig.ExporterAuthOAuth2TokenURL == "" || lambdaConfig.ExporterAuthOAuth2ClientID == ""):
+		err = fmt.Errorf("EXPORTER_AUTH=oauth2 requires EXPORTER_AUTH_OAUTH2_TOKEN_URL and EXPORTER_AUTH_OAUTH2_CLIENT_ID")
+	case lambdaConfig.ExporterAuth == "sigv4" && lambdaConfig.ExporterAuthSigV4Service == "":
+		err = fmt.Errorf("EXPORTER_AUTH=sigv4 requires EXPORTER_AUTH_SIGV4_SERVICE")
+	}
+	if err != nil {
+		log.ErrorContext(ctx, "invalid exporter auth", "error", err)
+		panic(err)
+	}
+
+	switch lambdaConfig.LogOversizeAction {
+	case "truncate", "split":
+	default:
+		err = fmt.Errorf("invalid value for environment variable LOG_OVERSIZE_ACTION: %s", lambdaConfig.LogOversizeAction)
+		log.ErrorContext(ctx, "invalid oversize action", "error", err)
+		panic(err)
+	}
+
+	switch lambdaConfig.ParseBody {
+	case "", "json", "logfmt", "auto":
+	default:
+		err = fmt.Errorf("invalid value for environment variable PARSE_BODY: %s", lambdaConfig.ParseBody)
+		log.ErrorContext(ctx, "invalid body parser", "error", err)
+		panic(err)
+	}
+
+	if lambdaConfig.ParseBodyMaxAttributes < 1 || lambdaConfig.ParseBodyMaxDepth < 1 {
+		err = fmt.Errorf("invalid value for environment variables PARSE_BODY_MAX_ATTRIBUTES and PARSE_BODY_MAX_DEPTH: %d, %d", lambdaConfig.ParseBodyMaxAttributes, lambdaConfig.ParseBodyMaxDepth)
+		log.ErrorContext(ctx, "invalid body parser limits", "error", err)
+		panic(err)
+	}
+
 	return context.WithValue(ctx, contextKeyConfig, &lambdaConfig)
 }
 
+// WithConfig returns a copy of ctx carrying cfg, so that a configuration read
+// once can be reused across invocations.
+func WithConfig(ctx context.Context, cfg *Configuration) context.Context {
+	return context.WithValue(ctx, contextKeyConfig, cfg)
+}
+
 // GetConfig is
 func GetConfig(ctx context.Context) *Configuration {
 
@@ -147,3 +397,52 @@ func parseDropAttributes() ([]model.LabelName, error) {
 
 	return result, nil
 }
+
+// EventBridgeRule matches EventBridge events on their source and, optionally,
+// detail-type. Both are path.Match patterns.
+type EventBridgeRule struct {
+	Source     string
+	DetailType string
+}
+
+// Matches reports whether the event source and detail-type match the rule.
+func (r EventBridgeRule) Matches(source string, detailType string) bool {
+	if ok, _ := path.Match(r.Source, source); !ok {
+		return false
+	}
+	if r.DetailType == "" {
+		return true
+	}
+	ok, _ := path.Match(r.DetailType, detailType)
+	return ok
+}
+
+// parseEventBridgeRules parses a comma separated list of source[:detail-type]
+// rules, e.g. "aws.guardduty,aws.ecs:ECS Task State Change,myapp.*".
+func parseEventBridgeRules(name string, raw string) ([]EventBridgeRule, error) {
+	var result []EventBridgeRule
+
+	if raw == "" {
+		return result, nil
+	}
+
+	for _, entry := range strings.Split(raw, ",") {
+		source, detailType, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		rule := EventBridgeRule{
+			Source:     strings.TrimSpace(source),
+			DetailType: strings.TrimSpace(detailType),
+		}
+		if rule.Source == "" {
+			return nil, fmt.Errorf("invalid value for environment variable %s. Empty source in rule %q", name, entry)
+		}
+		if _, err := path.Match(rule.Source, ""); err != nil {
+			return nil, fmt.Errorf("invalid value for environment variable %s. Bad source pattern %q: %w", name, rule.Source, err)
+		}
+		if _, err := path.Match(rule.DetailType, ""); err != nil {
+			return nil, fmt.Errorf("invalid value for environment variable %s. Bad detail-type pattern %q: %w", name, rule.DetailType, err)
+		}
+		result = append(result, rule)
+	}
+
+	return result, nil
+}
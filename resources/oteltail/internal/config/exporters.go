@@ -0,0 +1,289 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EXPORTER_TYPE_OTLP exports with OTLP/gRPC, the default.
+	EXPORTER_TYPE_OTLP = "otlp"
+	// EXPORTER_TYPE_LOKI exports with the Loki push API.
+	EXPORTER_TYPE_LOKI = "loki"
+)
+
+// DefaultExporterName is the name of the exporter configured by the
+// OTEL_EXPORTER_OTLP_* variables. It receives the records no route matches.
+const DefaultExporterName = "default"
+
+// ExporterConfig describes a named OTLP destination and RouteConfig selects
+// the exporters of a record. Both are read from the YAML (or JSON) document
+// referenced by EXPORTERS_FILE or held in EXPORTERS.
+//
+// Example:
+//
+//	exporters:
+//	  - name: siem
+//	    endpoint: https://siem-collector:4317
+//	    ca_file: /opt/siem/ca.pem
+//	    timeout: 5s
+//	    retry:
+//	      max_elapsed_time: 30s
+//	    ignore_failures: true
+//	    auth:
+//	      type: oauth2
+//	      oauth2_token_url: https://idp.example.com/token
+//	      oauth2_client_id: oteltail
+//	      oauth2_client_secret: secret
+//	  - name: loki
+//	    type: loki
+//	    endpoint: https://loki.example.com/loki/api/v1/push
+//	    tenant_id: team-a
+//	routes:
+//	  - match:
+//	      __aws_log_type: s3_cloudtrail|s3_waf
+//	    exporters: [siem, default]
+//	  - exporters: [loki, default]
+type ExporterConfig struct {
+	// Name identifies the exporter in the routes.
+	Name string `yaml:"name"`
+	// Type is one of "otlp", the default, or "loki".
+	Type string `yaml:"type"`
+	// Endpoint is the collector URL, http:// endpoints are insecure. For
+	// Loki it is the push API URL.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure disables TLS whatever the endpoint scheme. For Loki, the
+	// certificate of https:// endpoints is not verified.
+	Insecure bool `yaml:"insecure"`
+	// CAFile is the PEM encoded CA used to verify the collector.
+	CAFile string `yaml:"ca_file"`
+	// ClientCertFile and ClientKeyFile are the PEM encoded client certificate
+	// and key used for mTLS.
+	ClientCertFile string `yaml:"client_cert_file"`
+	ClientKeyFile  string `yaml:"client_key_file"`
+	// Headers are sent with every export.
+	Headers map[string]string `yaml:"headers"`
+	// Compression is "gzip" or "none", OTEL_EXPORTER_COMPRESSION by default.
+	// It is ignored by Loki exporters, which always use snappy.
+	Compression string `yaml:"compression"`
+	// Timeout bounds each export, including its retries.
+	Timeout time.Duration `yaml:"timeout"`
+	// Retry overrides the default retry policy of OTLP exporters.
+	Retry *RetryConfig `yaml:"retry"`
+	// TenantID is the Loki tenant, sent as X-Scope-OrgID.
+	TenantID string `yaml:"tenant_id"`
+	// Username and Password authenticate the Loki pushes with basic auth.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// IgnoreFailures logs the export errors of the exporter instead of
+	// failing the invocation, e.g. while migrating to a new backend.
+	IgnoreFailures bool `yaml:"ignore_failures"`
+	// Auth authenticates the exports, the EXPORTER_AUTH_* variables only
+	// apply to the default destination.
+	Auth *AuthConfig `yaml:"auth"`
+}
+
+// AuthConfig selects the credentials of an exporter, with the same types
+// and settings as the EXPORTER_AUTH_* variables.
+type AuthConfig struct {
+	// Type is "bearer_file", "oauth2" or "sigv4".
+	Type string `yaml:"type"`
+	// TokenFile holds the bearer token, read again when it changes.
+	TokenFile          string   `yaml:"token_file"`
+	OAuth2TokenURL     string   `yaml:"oauth2_token_url"`
+	OAuth2ClientID     string   `yaml:"oauth2_client_id"`
+	OAuth2ClientSecret string   `yaml:"oauth2_client_secret"`
+	OAuth2Scopes       []string `yaml:"oauth2_scopes"`
+	SigV4Service       string   `yaml:"sigv4_service"`
+	// SigV4Region is the region of the function by default.
+	SigV4Region string `yaml:"sigv4_region"`
+}
+
+// ExporterAuthConfig returns the credentials of the default destination,
+// selected by the EXPORTER_AUTH_* variables.
+func (c *Configuration) ExporterAuthConfig() AuthConfig {
+	return AuthConfig{
+		Type:               c.ExporterAuth,
+		TokenFile:          c.ExporterAuthTokenFile,
+		OAuth2TokenURL:     c.ExporterAuthOAuth2TokenURL,
+		OAuth2ClientID:     c.ExporterAuthOAuth2ClientID,
+		OAuth2ClientSecret: c.ExporterAuthOAuth2ClientSecret,
+		OAuth2Scopes:       c.ExporterAuthOAuth2Scopes,
+		SigV4Service:       c.ExporterAuthSigV4Service,
+		SigV4Region:        c.ExporterAuthSigV4Region,
+	}
+}
+
+// validateAuth checks the auth block of an exporter.
+func validateAuth(a AuthConfig) error {
+	switch a.Type {
+	case "bearer_file", "oauth2", "sigv4":
+	default:
+		return fmt.Errorf("unknown auth type %q", a.Type)
+	}
+
+	switch {
+	case a.Type == "bearer_file" && a.TokenFile == "":
+		return fmt.Errorf("auth type bearer_file requires token_file")
+	case a.Type == "oauth2" && (a.OAuth2TokenURL == "" || a.OAuth2ClientID == ""):
+		return fmt.Errorf("auth type oauth2 requires oauth2_token_url and oauth2_client_id")
+	case a.Type == "sigv4" && a.SigV4Service == "":
+		return fmt.Errorf("auth type sigv4 requires sigv4_service")
+	}
+
+	return nil
+}
+
+// RetryConfig is the retry policy of an exporter.
+type RetryConfig struct {
+	Disabled        bool          `yaml:"disabled"`
+	InitialInterval time.Duration `yaml:"initial_interval"`
+	MaxInterval     time.Duration `yaml:"max_interval"`
+	MaxElapsedTime  time.Duration `yaml:"max_elapsed_time"`
+}
+
+// RouteConfig sends the records whose labels match to exporters. The first
+// matching route wins.
+type RouteConfig struct {
+	// Match maps label names, e.g. __aws_log_type, to anchored regular
+	// expressions their values must match. An empty match matches every
+	// record.
+	Match map[string]string `yaml:"match"`
+	// Exporters are the names of the exporters the records are sent to.
+	Exporters []string `yaml:"exporters"`
+
+	matchers map[model.LabelName]*regexp.Regexp
+}
+
+// Matches reports whether the labels match the route.
+func (r RouteConfig) Matches(labels model.LabelSet) bool {
+	return matchLabels(r.matchers, labels)
+}
+
+// compileMatch compiles the anchored regular expressions of a label match.
+func compileMatch(match map[string]string) (map[model.LabelName]*regexp.Regexp, error) {
+	matchers := make(map[model.LabelName]*regexp.Regexp, len(match))
+	for label, expr := range match {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid match for %s: %w", label, err)
+		}
+		matchers[model.LabelName(label)] = re
+	}
+	return matchers, nil
+}
+
+// matchLabels reports whether the labels match every matcher, a missing
+// label matches as an empty value.
+func matchLabels(matchers map[model.LabelName]*regexp.Regexp, labels model.LabelSet) bool {
+	for name, re := range matchers {
+		if !re.MatchString(string(labels[name])) {
+			return false
+		}
+	}
+	return true
+}
+
+type exportersDocument struct {
+	Exporters []ExporterConfig `yaml:"exporters"`
+	Routes    []RouteConfig    `yaml:"routes"`
+}
+
+// parseExporters reads the exporters and routes from the file at path and
+// the raw document, either of which may be empty.
+func parseExporters(path string, raw string) ([]ExporterConfig, []RouteConfig, error) {
+	var doc exportersDocument
+
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to read exporters file: %w", err)
+		}
+
+		fileDoc, err := decodeExporters(content)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid exporters file %s: %w", path, err)
+		}
+		doc.Exporters = append(doc.Exporters, fileDoc.Exporters...)
+		doc.Routes = append(doc.Routes, fileDoc.Routes...)
+	}
+
+	if raw != "" {
+		rawDoc, err := decodeExporters([]byte(raw))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid value for environment variable EXPORTERS: %w", err)
+		}
+		doc.Exporters = append(doc.Exporters, rawDoc.Exporters...)
+		doc.Routes = append(doc.Routes, rawDoc.Routes...)
+	}
+
+	names := map[string]bool{DefaultExporterName: true}
+	for i, e := range doc.Exporters {
+		if e.Name == "" {
+			return nil, nil, fmt.Errorf("exporter %d has no name", i)
+		}
+		if names[e.Name] {
+			return nil, nil, fmt.Errorf("duplicate exporter %s", e.Name)
+		}
+		switch e.Type {
+		case "", EXPORTER_TYPE_OTLP, EXPORTER_TYPE_LOKI:
+		default:
+			return nil, nil, fmt.Errorf("exporter %s has an unknown type %s", e.Name, e.Type)
+		}
+		if err := validateCompression(e.Compression); err != nil {
+			return nil, nil, fmt.Errorf("exporter %s: %w", e.Name, err)
+		}
+		if e.Endpoint == "" {
+			return nil, nil, fmt.Errorf("exporter %s has no endpoint", e.Name)
+		}
+		if e.Auth != nil {
+			if err := validateAuth(*e.Auth); err != nil {
+				return nil, nil, fmt.Errorf("exporter %s: %w", e.Name, err)
+			}
+		}
+		names[e.Name] = true
+	}
+
+	for i, r := range doc.Routes {
+		if len(r.Exporters) == 0 {
+			return nil, nil, fmt.Errorf("route %d has no exporters", i)
+		}
+		for _, name := range r.Exporters {
+			if !names[name] {
+				return nil, nil, fmt.Errorf("route %d uses unknown exporter %s", i, name)
+			}
+		}
+
+		matchers, err := compileMatch(r.Match)
+		if err != nil {
+			return nil, nil, fmt.Errorf("route %d: %w", i, err)
+		}
+		doc.Routes[i].matchers = matchers
+	}
+
+	return doc.Exporters, doc.Routes, nil
+}
+
+// validateCompression checks an OTLP compression setting. zstd is rejected
+// explicitly, the build has no zstd codec to register with gRPC.
+func validateCompression(compression string) error {
+	switch compression {
+	case "", "none", "gzip":
+		return nil
+	case "zstd":
+		return fmt.Errorf("zstd compression is not supported, use gzip")
+	default:
+		return fmt.Errorf("unknown compression %s", compression)
+	}
+}
+
+func decodeExporters(content []byte) (exportersDocument, error) {
+	var doc exportersDocument
+	err := yaml.Unmarshal(content, &doc)
+	return doc, err
+}
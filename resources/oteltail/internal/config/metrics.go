@@ -0,0 +1,261 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/log"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// METRIC_TYPE_COUNTER adds the source value, or 1 without a source, for
+	// each record.
+	METRIC_TYPE_COUNTER = "counter"
+	// METRIC_TYPE_GAUGE keeps the last source value.
+	METRIC_TYPE_GAUGE = "gauge"
+	// METRIC_TYPE_HISTOGRAM counts the source values in buckets.
+	METRIC_TYPE_HISTOGRAM = "histogram"
+)
+
+// DefaultMetricBuckets are the histogram bucket bounds used when a metric
+// sets none, those of the Prometheus client.
+var DefaultMetricBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// MetricConfig defines a metric computed from the records, like the metrics
+// stage of promtail. Entries are read from the YAML (or JSON) document
+// referenced by LOG_METRICS_FILE or held in LOG_METRICS.
+//
+// The fields of a record are its labels, its string, numeric and boolean
+// attributes, the named groups of Regex and the JSON values selected by JSON.
+//
+// Example:
+//
+//	metrics:
+//	  - name: alb_target_processing_time
+//	    type: histogram
+//	    unit: s
+//	    match:
+//	      __aws_log_type: s3_lb
+//	    regex: ^\S+ \S+ \S+ \S+ \S+ \S+ (?P<target_processing_time>[-\d.]+) \S+ (?P<elb_status_code>(?P<status_class>\d)\d\d|-)
+//	    filter:
+//	      target_processing_time: '[\d.]+'
+//	    source: target_processing_time
+//	    labels: [status_class]
+//	  - name: waf_blocked_requests
+//	    type: counter
+//	    match:
+//	      __aws_log_type: s3_waf
+//	    json:
+//	      action: action
+//	      rule: terminatingRuleId
+//	    filter:
+//	      action: BLOCK
+//	    labels: [rule]
+type MetricConfig struct {
+	// Name is the name of the exported metric.
+	Name string `yaml:"name"`
+	// Type is one of "counter", "gauge" or "histogram".
+	Type        string `yaml:"type"`
+	Description string `yaml:"description"`
+	Unit        string `yaml:"unit"`
+	// Match maps label names to anchored regular expressions their values
+	// must match for the record to be considered.
+	Match map[string]string `yaml:"match"`
+	// Regex is matched against the line, its named groups become fields.
+	// Records whose line does not match are ignored.
+	Regex string `yaml:"regex"`
+	// JSON maps field names to the dot-separated path of a value in the line
+	// decoded as a JSON object.
+	JSON map[string]string `yaml:"json"`
+	// Filter maps field names to anchored regular expressions their values
+	// must match for the record to be counted.
+	Filter map[string]string `yaml:"filter"`
+	// Source is the field holding the numeric value of the record. Without
+	// it, a counter counts the records.
+	Source string `yaml:"source"`
+	// Buckets are the upper bounds of the histogram buckets.
+	Buckets []float64 `yaml:"buckets"`
+	// Labels are the fields used as the metric attributes.
+	Labels []string `yaml:"labels"`
+
+	matchers map[model.LabelName]*regexp.Regexp
+	filters  map[model.LabelName]*regexp.Regexp
+	regex    *regexp.Regexp
+}
+
+// Matches reports whether the metric applies to the records with the labels.
+func (m MetricConfig) Matches(labels model.LabelSet) bool {
+	return matchLabels(m.matchers, labels)
+}
+
+// Fields returns the fields of a record with the given labels, attributes
+// and line, and reports whether the record is counted by the metric.
+func (m MetricConfig) Fields(labels model.LabelSet, attrs []log.KeyValue, line string) (model.LabelSet, bool) {
+	fields := labels.Clone()
+
+	for _, kv := range attrs {
+		switch kv.Value.Kind() {
+		case log.KindString:
+			fields[model.LabelName(kv.Key)] = model.LabelValue(kv.Value.AsString())
+		case log.KindInt64:
+			fields[model.LabelName(kv.Key)] = model.LabelValue(strconv.FormatInt(kv.Value.AsInt64(), 10))
+		case log.KindFloat64:
+			fields[model.LabelName(kv.Key)] = model.LabelValue(strconv.FormatFloat(kv.Value.AsFloat64(), 'g', -1, 64))
+		case log.KindBool:
+			fields[model.LabelName(kv.Key)] = model.LabelValue(strconv.FormatBool(kv.Value.AsBool()))
+		}
+	}
+
+	if m.regex != nil {
+		match := m.regex.FindStringSubmatch(line)
+		if match == nil {
+			return nil, false
+		}
+		for i, name := range m.regex.SubexpNames() {
+			if name != "" && match[i] != "" {
+				fields[model.LabelName(name)] = model.LabelValue(match[i])
+			}
+		}
+	}
+
+	if len(m.JSON) > 0 {
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+
+		var doc map[string]any
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, false
+		}
+		for name, path := range m.JSON {
+			if value, ok := jsonPath(doc, path); ok {
+				fields[model.LabelName(name)] = model.LabelValue(value)
+			}
+		}
+	}
+
+	return fields, matchLabels(m.filters, fields)
+}
+
+// jsonPath returns the scalar value at the dot-separated path.
+func jsonPath(doc map[string]any, path string) (string, bool) {
+	var value any = doc
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[key]; !ok {
+			return "", false
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number, bool:
+		return fmt.Sprint(v), true
+	default:
+		return "", false
+	}
+}
+
+type metricsDocument struct {
+	Metrics []MetricConfig `yaml:"metrics"`
+}
+
+// parseMetrics reads the metric definitions from the file at path and the
+// raw document, either of which may be empty.
+func parseMetrics(path string, raw string) ([]MetricConfig, error) {
+	var result []MetricConfig
+
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read metrics file: %w", err)
+		}
+
+		metrics, err := decodeMetrics(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metrics file %s: %w", path, err)
+		}
+		result = append(result, metrics...)
+	}
+
+	if raw != "" {
+		metrics, err := decodeMetrics([]byte(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for environment variable LOG_METRICS: %w", err)
+		}
+		result = append(result, metrics...)
+	}
+
+	names := make(map[string]bool, len(result))
+	for _, m := range result {
+		if names[m.Name] {
+			return nil, fmt.Errorf("metric %s is defined twice", m.Name)
+		}
+		names[m.Name] = true
+	}
+
+	return result, nil
+}
+
+func decodeMetrics(content []byte) ([]MetricConfig, error) {
+	var doc metricsDocument
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+
+	for i, m := range doc.Metrics {
+		if m.Name == "" {
+			return nil, fmt.Errorf("metric %d has no name", i)
+		}
+
+		switch m.Type {
+		case METRIC_TYPE_COUNTER:
+		case METRIC_TYPE_GAUGE, METRIC_TYPE_HISTOGRAM:
+			if m.Source == "" {
+				return nil, fmt.Errorf("metric %s of type %s has no source", m.Name, m.Type)
+			}
+		default:
+			return nil, fmt.Errorf("metric %s has an unknown type %q", m.Name, m.Type)
+		}
+
+		if m.Type == METRIC_TYPE_HISTOGRAM {
+			if len(m.Buckets) == 0 {
+				doc.Metrics[i].Buckets = DefaultMetricBuckets
+			} else if !sort.Float64sAreSorted(m.Buckets) {
+				return nil, fmt.Errorf("metric %s has unsorted buckets", m.Name)
+			}
+		}
+
+		if m.Regex != "" {
+			re, err := regexp.Compile(m.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("metric %s has an invalid regex: %w", m.Name, err)
+			}
+			doc.Metrics[i].regex = re
+		}
+
+		matchers, err := compileMatch(m.Match)
+		if err != nil {
+			return nil, fmt.Errorf("metric %s: %w", m.Name, err)
+		}
+		doc.Metrics[i].matchers = matchers
+
+		filters, err := compileMatch(m.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("metric %s: %w", m.Name, err)
+		}
+		doc.Metrics[i].filters = filters
+	}
+
+	return doc.Metrics, nil
+}
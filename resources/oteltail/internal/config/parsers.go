@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// S3ParserConfig describes a custom S3 log layout. Entries are read from the
+// YAML (or JSON) document referenced by S3_PARSERS_FILE or held in S3_PARSERS.
+//
+// Example:
+//
+//	parsers:
+//	  - name: audit
+//	    key_regex: ^audit-logs\/workspaceId=(?P<workspace>\d+)\/.*
+//	    timestamp_regex: (?P<timestamp>\d+-\d+-\d+T\d+:\d+:\d+Z)
+//	    timestamp_format: RFC3339
+//	    compression: gzip
+//	    line_format: text
+//	    labels:
+//	      workspace: workspace_id
+type S3ParserConfig struct {
+	// Name is used as the parser type and, unless LogTypeLabel is set, as the
+	// __aws_log_type label value.
+	Name string `yaml:"name"`
+	// LogTypeLabel overrides the __aws_log_type label value.
+	LogTypeLabel string `yaml:"log_type_label"`
+	// KeyRegex matches the object key, its named groups become labels.
+	KeyRegex string `yaml:"key_regex"`
+	// TimestampRegex extracts the timestamp from text lines, it must contain a
+	// single capture group.
+	TimestampRegex string `yaml:"timestamp_regex"`
+	// TimestampField is the key (json) or column (csv) holding the timestamp.
+	TimestampField string `yaml:"timestamp_field"`
+	// TimestampFormat is a Go time layout or the name of one of the time
+	// package layouts, e.g. RFC3339.
+	TimestampFormat string `yaml:"timestamp_format"`
+	// TimestampType is either "string" or "unix".
+	TimestampType string `yaml:"timestamp_type"`
+	// SkipHeaderCount is the number of lines to skip at the top of the object.
+	SkipHeaderCount int `yaml:"skip_header_count"`
+	// Compression is one of "gzip", "none" or "auto", the default.
+	Compression string `yaml:"compression"`
+	// LineFormat is one of "text", the default, "json" or "csv".
+	LineFormat string `yaml:"line_format"`
+	// CSVColumns names the csv columns, if empty the last skipped header line
+	// is used.
+	CSVColumns []string `yaml:"csv_columns"`
+	// Labels maps KeyRegex group names to label names. If empty every group is
+	// exported as __custom_<group>.
+	Labels map[string]string `yaml:"labels"`
+	// OwnerLabelKey is the KeyRegex group used for the __aws_<type>_owner label.
+	OwnerLabelKey string `yaml:"owner_label_key"`
+}
+
+type s3ParsersDocument struct {
+	Parsers []S3ParserConfig `yaml:"parsers"`
+}
+
+// parseS3Parsers reads the custom S3 parser definitions from the file at path
+// and the raw document, either of which may be empty.
+func parseS3Parsers(path string, raw string) ([]S3ParserConfig, error) {
+	var result []S3ParserConfig
+
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read S3 parsers file: %w", err)
+		}
+
+		parsers, err := decodeS3Parsers(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 parsers file %s: %w", path, err)
+		}
+		result = append(result, parsers...)
+	}
+
+	if raw != "" {
+		parsers, err := decodeS3Parsers([]byte(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for environment variable S3_PARSERS: %w", err)
+		}
+		result = append(result, parsers...)
+	}
+
+	return result, nil
+}
+
+func decodeS3Parsers(content []byte) ([]S3ParserConfig, error) {
+	var doc s3ParsersDocument
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+
+	for i, p := range doc.Parsers {
+		if p.Name == "" {
+			return nil, fmt.Errorf("parser %d has no name", i)
+		}
+		if p.KeyRegex == "" {
+			return nil, fmt.Errorf("parser %s has no key_regex", p.Name)
+		}
+	}
+
+	return doc.Parsers, nil
+}
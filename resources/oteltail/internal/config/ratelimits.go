@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// RATE_LIMIT_ACTION_DROP drops the records over the limit.
+	RATE_LIMIT_ACTION_DROP = "drop"
+	// RATE_LIMIT_ACTION_DELAY waits until the records fit in the limit, as
+	// long as the deadline allows it, and defers them otherwise.
+	RATE_LIMIT_ACTION_DELAY = "delay"
+	// RATE_LIMIT_ACTION_DEFER fails the invocation with a retryable error so
+	// that the event source sends the records again later.
+	RATE_LIMIT_ACTION_DEFER = "defer"
+)
+
+// RateLimitConfig is a token bucket limit on the records matching a set of
+// labels. Entries are read from the YAML (or JSON) document referenced by
+// RATE_LIMITS_FILE or held in RATE_LIMITS.
+//
+// Example:
+//
+//	rate_limits:
+//	  - name: log-groups
+//	    match:
+//	      __aws_log_type: cloudwatch|kinesis
+//	    by: [__aws_cloudwatch_log_group]
+//	    records_per_second: 2000
+//	    bytes_per_second: 2097152
+//	    action: defer
+//	  - name: bucket-prefixes
+//	    by: [__aws_bucket_name, __aws_bucket_key]
+//	    prefix_depth: 2
+//	    bytes_per_second: 10485760
+//	    action: delay
+type RateLimitConfig struct {
+	// Name identifies the limit in the logs.
+	Name string `yaml:"name"`
+	// Match maps label names to anchored regular expressions their values
+	// must match for the limit to apply. An empty match applies to every
+	// record.
+	Match map[string]string `yaml:"match"`
+	// By lists the labels whose values select a bucket, e.g.
+	// __aws_cloudwatch_log_group for a limit per log group. If empty the
+	// limit is shared by all the matching records.
+	By []string `yaml:"by"`
+	// PrefixDepth cuts the values of the By labels to their first
+	// PrefixDepth /-separated segments, e.g. for a limit per S3 prefix.
+	PrefixDepth int `yaml:"prefix_depth"`
+	// RecordsPerSecond and BytesPerSecond are the rates, either may be 0 to
+	// not limit it.
+	RecordsPerSecond float64 `yaml:"records_per_second"`
+	BytesPerSecond   float64 `yaml:"bytes_per_second"`
+	// BurstRecords and BurstBytes are the bucket sizes, one second of the
+	// rate by default.
+	BurstRecords int `yaml:"burst_records"`
+	BurstBytes   int `yaml:"burst_bytes"`
+	// Action is one of "drop", the default, "delay" or "defer".
+	Action string `yaml:"action"`
+
+	matchers map[model.LabelName]*regexp.Regexp
+}
+
+// Matches reports whether the limit applies to the labels.
+func (r RateLimitConfig) Matches(labels model.LabelSet) bool {
+	return matchLabels(r.matchers, labels)
+}
+
+// BucketKey returns the key of the bucket the labels fall in.
+func (r RateLimitConfig) BucketKey(labels model.LabelSet) string {
+	values := make([]string, len(r.By))
+	for i, name := range r.By {
+		value := string(labels[model.LabelName(name)])
+		if r.PrefixDepth > 0 {
+			if parts := strings.SplitN(value, "/", r.PrefixDepth+1); len(parts) > r.PrefixDepth {
+				value = strings.Join(parts[:r.PrefixDepth], "/")
+			}
+		}
+		values[i] = value
+	}
+	return strings.Join(values, "\x00")
+}
+
+type rateLimitsDocument struct {
+	RateLimits []RateLimitConfig `yaml:"rate_limits"`
+}
+
+// parseRateLimits reads the rate limits from the file at path and the raw
+// document, either of which may be empty.
+func parseRateLimits(path string, raw string) ([]RateLimitConfig, error) {
+	var result []RateLimitConfig
+
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read rate limits file: %w", err)
+		}
+
+		limits, err := decodeRateLimits(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limits file %s: %w", path, err)
+		}
+		result = append(result, limits...)
+	}
+
+	if raw != "" {
+		limits, err := decodeRateLimits([]byte(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for environment variable RATE_LIMITS: %w", err)
+		}
+		result = append(result, limits...)
+	}
+
+	return result, nil
+}
+
+func decodeRateLimits(content []byte) ([]RateLimitConfig, error) {
+	var doc rateLimitsDocument
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+
+	for i, l := range doc.RateLimits {
+		if l.Name == "" {
+			return nil, fmt.Errorf("rate limit %d has no name", i)
+		}
+		if l.RecordsPerSecond <= 0 && l.BytesPerSecond <= 0 {
+			return nil, fmt.Errorf("rate limit %s has neither records_per_second nor bytes_per_second", l.Name)
+		}
+
+		switch l.Action {
+		case "":
+			doc.RateLimits[i].Action = RATE_LIMIT_ACTION_DROP
+		case RATE_LIMIT_ACTION_DROP, RATE_LIMIT_ACTION_DELAY, RATE_LIMIT_ACTION_DEFER:
+		default:
+			return nil, fmt.Errorf("rate limit %s has an unknown action %s", l.Name, l.Action)
+		}
+
+		matchers, err := compileMatch(l.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit %s: %w", l.Name, err)
+		}
+		doc.RateLimits[i].matchers = matchers
+	}
+
+	return doc.RateLimits, nil
+}
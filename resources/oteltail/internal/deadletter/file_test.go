@@ -0,0 +1,66 @@
+package deadletter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSinkAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deadletter.jsonl")
+	sink := NewFileSink(path)
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	first := []Record{
+		{Source: "s3://bucket/a.log", Line: "bad line", Error: "no timestamp", Labels: map[string]string{"bucket": "bucket"}, Time: now},
+		{Source: "s3://bucket/a.log", Line: "é\"<", Error: "no timestamp", Time: now},
+	}
+	second := []Record{
+		{Source: "exporter:default", Line: "{}", Error: "rejected", Time: now.Add(time.Second)},
+	}
+
+	ctx := context.Background()
+	if err := sink.Write(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var got []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %d: %v", len(got)+1, err)
+		}
+		got = append(got, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := append(first, second...)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %+v, want %+v", got, want)
+	}
+}
+
+func TestFileSinkUnwritable(t *testing.T) {
+	sink := NewFileSink(filepath.Join(t.TempDir(), "missing", "deadletter.jsonl"))
+
+	if err := sink.Write(context.Background(), []Record{{Line: "bad line"}}); err == nil {
+		t.Error("Write to a missing directory succeeded")
+	}
+}
@@ -0,0 +1,75 @@
+package deadletter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Sink writes the records of each Write call as a JSON lines object under
+// a prefix.
+type S3Sink struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func NewS3Sink(ctx context.Context, bucket, prefix string) (*S3Sink, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Sink{
+		client: s3.NewFromConfig(cfg),
+		bucket: bucket,
+		prefix: prefix,
+	}, nil
+}
+
+func (s *S3Sink) Write(ctx context.Context, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.key(records[0].Source)),
+		Body:        bytes.NewReader(body.Bytes()),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write dead-letter records to bucket %s: %w", s.bucket, err)
+	}
+
+	return nil
+}
+
+// key returns <prefix>/<yyyy>/<mm>/<dd>/<source>.<unix nano>.jsonl, so that
+// the dead letters of a source can be found from its name.
+func (s *S3Sink) key(source string) string {
+	now := time.Now().UTC()
+
+	source = strings.TrimPrefix(source, "s3://")
+	if source == "" {
+		source = "unknown"
+	}
+
+	return path.Join(s.prefix, now.Format("2006/01/02"), fmt.Sprintf("%s.%d.jsonl", source, now.UnixNano()))
+}
@@ -0,0 +1,54 @@
+package deadletter
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Record is a log record which could not be parsed or exported.
+type Record struct {
+	// Source identifies where the record was read from, e.g. the S3 object
+	// URL, or the exporter which failed to send it.
+	Source string `json:"source"`
+	// Line is the raw record.
+	Line string `json:"line"`
+	// Error is the reason the record could not be parsed or exported.
+	Error string `json:"error"`
+	// Labels are the labels the record would have been sent with.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Time is when the record was dead-lettered.
+	Time time.Time `json:"time"`
+}
+
+// Sink stores the records which could not be parsed or exported so that they
+// can be inspected and replayed.
+type Sink interface {
+	// Write stores records, all read from the same source.
+	Write(ctx context.Context, records []Record) error
+}
+
+// New returns the sink for rawURL, which is one of:
+//
+//	file:///tmp/deadletter.jsonl                         records appended to a local file
+//	s3://bucket/prefix                                   one object per source under the prefix
+//	https://sqs.<region>.amazonaws.com/<account>/<queue> one message per record, sent in batches
+func New(ctx context.Context, rawURL string) (Sink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dead-letter URL: %w", err)
+	}
+
+	switch {
+	case u.Scheme == "file":
+		return NewFileSink(u.Path), nil
+	case u.Scheme == "s3":
+		return NewS3Sink(ctx, u.Host, strings.TrimPrefix(u.Path, "/"))
+	case u.Scheme == "https" && strings.HasPrefix(u.Host, "sqs."):
+		return NewSQSSink(ctx, rawURL)
+	default:
+		return nil, fmt.Errorf("unsupported dead-letter URL %s", rawURL)
+	}
+}
@@ -0,0 +1,142 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"oteltail/internal/utils"
+)
+
+// maxMessageBytes is the SQS message size limit, which also applies to the
+// sum of the messages of a batch.
+const maxMessageBytes = 256 * 1024
+
+// maxBatchMessages is the number of messages a batch takes.
+const maxBatchMessages = 10
+
+// sqsAPI is the part of the SQS client the sink uses.
+type sqsAPI interface {
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+}
+
+// SQSSink sends each record as a message to a queue, in batches.
+type SQSSink struct {
+	client   sqsAPI
+	queueURL string
+}
+
+// NewSQSSink creates a sink for the queue URL, which has the form
+// https://sqs.<region>.amazonaws.com/<account>/<queue>.
+func NewSQSSink(ctx context.Context, queueURL string) (*SQSSink, error) {
+	u, err := url.Parse(queueURL)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(u.Host, ".")
+	if len(parts) < 3 || parts[0] != "sqs" {
+		return nil, fmt.Errorf("invalid SQS queue URL %s", queueURL)
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(parts[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQSSink{
+		client:   sqs.NewFromConfig(cfg),
+		queueURL: queueURL,
+	}, nil
+}
+
+func (s *SQSSink) Write(ctx context.Context, records []Record) error {
+	bodies := make([]string, 0, len(records))
+	for _, record := range records {
+		body, err := messageBody(record)
+		if err != nil {
+			return err
+		}
+		bodies = append(bodies, body)
+	}
+
+	for _, batch := range messageBatches(bodies) {
+		entries := make([]types.SendMessageBatchRequestEntry, 0, len(batch))
+		for i, body := range batch {
+			entries = append(entries, types.SendMessageBatchRequestEntry{
+				Id:          aws.String(strconv.Itoa(i)),
+				MessageBody: aws.String(body),
+			})
+		}
+
+		out, err := s.client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(s.queueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send dead-letter records to %s: %w", s.queueURL, err)
+		}
+		if len(out.Failed) > 0 {
+			failed := out.Failed[0]
+			return fmt.Errorf("failed to send %d dead-letter records to %s: %s: %s", len(out.Failed), s.queueURL, aws.ToString(failed.Code), aws.ToString(failed.Message))
+		}
+	}
+
+	return nil
+}
+
+// messageBatches groups the message bodies in batches of at most
+// maxBatchMessages messages and maxMessageBytes.
+func messageBatches(bodies []string) [][]string {
+	var (
+		batches [][]string
+		batch   []string
+		size    int
+	)
+	for _, body := range bodies {
+		if len(batch) == maxBatchMessages || (len(batch) > 0 && size+len(body) > maxMessageBytes) {
+			batches = append(batches, batch)
+			batch, size = nil, 0
+		}
+		batch = append(batch, body)
+		size += len(body)
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+// messageBody encodes the record, cutting its line until the message fits
+// within the SQS limit. The source is enough to find the original record.
+func messageBody(record Record) (string, error) {
+	for {
+		body, err := json.Marshal(record)
+		if err != nil {
+			return "", err
+		}
+
+		over := len(body) - maxMessageBytes
+		if over <= 0 || record.Line == "" {
+			return string(body), nil
+		}
+
+		// escaping makes the line longer in the message than in the record,
+		// so the cut may not be enough at once
+		n := len(record.Line) - over
+		if n <= 0 {
+			record.Line = ""
+			continue
+		}
+		record.Line = record.Line[:utils.UTF8Cut(record.Line, n)]
+	}
+}
@@ -0,0 +1,94 @@
+package deadletter
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// fakeSQS records the batches it is sent and fails the messages with the
+// given bodies.
+type fakeSQS struct {
+	batches [][]types.SendMessageBatchRequestEntry
+	fail    string
+}
+
+func (f *fakeSQS) SendMessageBatch(_ context.Context, params *sqs.SendMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	f.batches = append(f.batches, params.Entries)
+
+	out := &sqs.SendMessageBatchOutput{}
+	for _, e := range params.Entries {
+		if f.fail != "" && strings.Contains(aws.ToString(e.MessageBody), f.fail) {
+			out.Failed = append(out.Failed, types.BatchResultErrorEntry{
+				Id:      e.Id,
+				Code:    aws.String("InvalidMessageContents"),
+				Message: aws.String("invalid"),
+			})
+		}
+	}
+	return out, nil
+}
+
+func TestSQSSinkBatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		records int
+		line    string
+		want    []int
+	}{
+		{"single", 1, "line", []int{1}},
+		{"messages", 23, "line", []int{10, 10, 3}},
+		{"bytes", 5, strings.Repeat("a", 100*1024), []int{2, 2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeSQS{}
+			sink := &SQSSink{client: client, queueURL: "https://sqs.eu-west-1.amazonaws.com/123456789012/dlq"}
+
+			records := make([]Record, tt.records)
+			for i := range records {
+				records[i] = Record{Source: "s3://bucket/key", Line: tt.line}
+			}
+			if err := sink.Write(context.Background(), records); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(client.batches) != len(tt.want) {
+				t.Fatalf("%d batches, want %d", len(client.batches), len(tt.want))
+			}
+			for i, batch := range client.batches {
+				if len(batch) != tt.want[i] {
+					t.Errorf("batch %d has %d messages, want %d", i, len(batch), tt.want[i])
+				}
+
+				size := 0
+				ids := map[string]bool{}
+				for _, e := range batch {
+					size += len(aws.ToString(e.MessageBody))
+					ids[aws.ToString(e.Id)] = true
+				}
+				if size > maxMessageBytes {
+					t.Errorf("batch %d is %d bytes, over the SQS limit", i, size)
+				}
+				if len(ids) != len(batch) {
+					t.Errorf("batch %d has duplicate IDs", i)
+				}
+			}
+		})
+	}
+}
+
+func TestSQSSinkFailed(t *testing.T) {
+	client := &fakeSQS{fail: "bad"}
+	sink := &SQSSink{client: client, queueURL: "https://sqs.eu-west-1.amazonaws.com/123456789012/dlq"}
+
+	err := sink.Write(context.Background(), []Record{{Line: "good"}, {Line: "bad"}})
+	if err == nil || !strings.Contains(err.Error(), "InvalidMessageContents") {
+		t.Errorf("Write = %v, want the failed messages reported", err)
+	}
+}
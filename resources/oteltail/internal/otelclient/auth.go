@@ -0,0 +1,47 @@
+package otelclient
+
+import (
+	"context"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"golang.org/x/oauth2/clientcredentials"
+	"google.golang.org/grpc/credentials"
+
+	"oteltail/internal/config"
+	"oteltail/internal/telemetry/sdklog/auth"
+)
+
+// newExporterCredentials returns the credentials selected by a, preceded by
+// the static headers. The default destination gets those of the
+// EXPORTER_AUTH_* variables, the EXPORTERS those of their auth block.
+func newExporterCredentials(ctx context.Context, headers map[string]string, a config.AuthConfig) ([]credentials.PerRPCCredentials, error) {
+	var creds []credentials.PerRPCCredentials
+
+	if len(headers) > 0 {
+		creds = append(creds, auth.Headers(headers))
+	}
+
+	switch a.Type {
+	case "bearer_file":
+		bearer, err := auth.NewBearerTokenFile(a.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, bearer)
+	case "oauth2":
+		creds = append(creds, auth.NewOAuth2(clientcredentials.Config{
+			ClientID:     a.OAuth2ClientID,
+			ClientSecret: a.OAuth2ClientSecret,
+			TokenURL:     a.OAuth2TokenURL,
+			Scopes:       a.OAuth2Scopes,
+		}))
+	case "sigv4":
+		awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, auth.NewSigV4(awsCfg, a.SigV4Service, a.SigV4Region))
+	}
+
+	return creds, nil
+}
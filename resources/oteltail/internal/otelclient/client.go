@@ -2,18 +2,26 @@ package otelclient
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
 
 	"log/slog"
 	"net/url"
 	"oteltail/internal/config"
+	"oteltail/internal/logger"
 	"oteltail/internal/telemetry/sdklog"
 	"oteltail/internal/telemetry/sdklog/otlploggrpc"
+	"oteltail/internal/telemetry/sdklog/spill"
+	"oteltail/internal/telemetry/sdklog/stdoutlog"
 	"time"
 
 	"go.opentelemetry.io/otel/log"
 
 	"go.opentelemetry.io/otel/sdk/resource"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
 )
 
 type Client interface {
@@ -22,9 +30,15 @@ type Client interface {
 
 // Implements Client
 type OtelClient struct {
-	Config       *OtelClientConfig
+	Config *OtelClientConfig
+	// LogProcessor and Logger are those of the default destination.
 	LogProcessor *sdklog.LoggerProvider
 	Logger       log.Logger
+
+	destinations map[string]*destination
+	routes       []config.RouteConfig
+	// resource describes the records and the LOG_METRICS.
+	resource *resource.Resource
 }
 
 type OtelClientConfig struct {
@@ -33,6 +47,14 @@ type OtelClientConfig struct {
 
 const NearlyImmediate = 100 * time.Millisecond
 
+// FlushMargin is left between the end of a flush and the deadline of the
+// invocation so that the handler can still return its result.
+const FlushMargin = 200 * time.Millisecond
+
+// KeepaliveTimeout is how long a keepalive ping waits for its ack before the
+// connection is considered broken.
+const KeepaliveTimeout = 20 * time.Second
+
 func NewOtelClient(ctx context.Context, cfg *OtelClientConfig, log *slog.Logger) (*OtelClient, error) {
 
 	additionResourceAttributes := append(config.GetConfig(ctx).ResourceAttributes, semconv.ServiceNameKey.String(config.GetConfig(ctx).OtelServiceName))
@@ -42,8 +64,13 @@ func NewOtelClient(ctx context.Context, cfg *OtelClientConfig, log *slog.Logger)
 		additionResourceAttributes...,
 	)
 
-	opts := []otlploggrpc.Option{
-		otlploggrpc.WithEndpointURL(cfg.Url.String()),
+	// the OTEL_EXPORTER_OTLP_LOGS_* variables are read by the exporter and
+	// take precedence over these options
+	var opts []otlploggrpc.Option
+
+	if cfg.Url != nil {
+		opts = append(opts,
+			otlploggrpc.WithEndpointURL(cfg.Url.String()))
 	}
 
 	if config.GetConfig(ctx).OtelInsecure {
@@ -51,23 +78,279 @@ func NewOtelClient(ctx context.Context, cfg *OtelClientConfig, log *slog.Logger)
 			otlploggrpc.WithInsecure())
 	}
 
+	if compression := config.GetConfig(ctx).OtelCompression; compression != "" {
+		opts = append(opts,
+			otlploggrpc.WithCompressor(compression))
+	}
+
+	creds, err := newExporterCredentials(ctx, config.GetConfig(ctx).ExporterAuthHeaders, config.GetConfig(ctx).ExporterAuthConfig())
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range creds {
+		opts = append(opts,
+			otlploggrpc.WithPerRPCCredentials(c))
+	}
+
+	d, err := newOTLPDestination(ctx, config.DefaultExporterName, resources, config.GetConfig(ctx).SpillDir, opts...)
+	if err != nil {
+		return nil, err
+	}
+	lp := d.provider
+	d.logger = lp.Logger("log/slog")
+
+	client := &OtelClient{
+		Config:       cfg,
+		LogProcessor: lp,
+		Logger:       d.logger,
+		destinations: map[string]*destination{
+			config.DefaultExporterName: d,
+		},
+		routes:   config.GetConfig(ctx).Routes,
+		resource: resources,
+	}
+
+	for _, exporter := range config.GetConfig(ctx).Exporters {
+		d, err := newDestination(ctx, resources, exporter)
+		if err != nil {
+			return nil, fmt.Errorf("exporter %s: %w", exporter.Name, err)
+		}
+		client.destinations[exporter.Name] = d
+	}
+
+	debugExporter, err := newDebugExporter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// every destination writes the records it exports, the routes may send
+	// them to any of them
+	if debugExporter != nil {
+		for _, d := range client.destinations {
+			d.provider.RegisterLogProcessor(sdklog.NewSimpleLogProcessor(debugExporter))
+		}
+	}
+
+	return client, nil
+}
+
+// newOTLPDestination creates the destination name, exporting to the
+// collector configured by opts, through the spill to disk in spillDir when
+// SPILL_ENABLED is set. Its logger is left to the caller.
+func newOTLPDestination(ctx context.Context, name string, resources *resource.Resource, spillDir string, opts ...otlploggrpc.Option) (*destination, error) {
+	if keepalive := config.GetConfig(ctx).OtelKeepalive; keepalive > 0 {
+		opts = append(opts,
+			otlploggrpc.WithKeepalive(keepalive, KeepaliveTimeout))
+	}
+
+	if maxSendBytes := config.GetConfig(ctx).OtelMaxSendBytes; maxSendBytes > 0 {
+		opts = append(opts,
+			otlploggrpc.WithMaxSendMsgSize(maxSendBytes))
+	}
+
+	if failures := config.GetConfig(ctx).OtelBreakerFailures; failures > 0 {
+		opts = append(opts,
+			otlploggrpc.WithCircuitBreaker(failures, config.GetConfig(ctx).OtelBreakerOpenTimeout, config.GetConfig(ctx).OtelBreakerMaxOpenTimeout))
+	}
+
 	client := otlploggrpc.NewClient(opts...)
-	err := client.Start(ctx)
+	if err := client.Start(ctx); err != nil {
+		return nil, err
+	}
 
-	lp := sdklog.NewLoggerProvider(resources)
+	var exporter spill.RawExporter = client
+	if config.GetConfig(ctx).ExportErrorPolicy == EXPORT_ERROR_POLICY_DEADLETTER {
+		sink, err := DeadLetterSink(ctx)
+		if err != nil {
+			return nil, err
+		}
+		exporter = &deadLetterExporter{next: client, name: name, sink: sink}
+	}
+
+	if !config.GetConfig(ctx).SpillEnabled {
+		return &destination{
+			name:     name,
+			provider: newBatchProvider(ctx, resources, exporter, false),
+			exporter: client,
+		}, nil
+	}
+
+	spillExporter, err := spill.New(exporter,
+		spill.WithDir(spillDir),
+		spill.WithMaxBytes(config.GetConfig(ctx).SpillMaxBytes),
+	)
+	if err != nil {
+		return nil, err
+	}
 
-	processor := sdklog.NewBatchLogProcessor(
-		client,
+	// the exporter does not lose logs anymore, wait for it rather than
+	// dropping logs when the queue is full
+	return &destination{
+		name:     name,
+		provider: newBatchProvider(ctx, resources, spillExporter, true),
+		exporter: client,
+		spill:    spillExporter,
+	}, nil
+}
+
+// newBatchProvider creates a provider exporting through a batch processor.
+// With blocking, emitting waits for room in the queue instead of dropping
+// the record.
+func newBatchProvider(ctx context.Context, resources *resource.Resource, exporter sdklog.LogExporter, blocking bool) *sdklog.LoggerProvider {
+	// export the records in the batches Batch.Add sends them in
+	processorOpts := []sdklog.BatchLogProcessorOption{
 		sdklog.WithBatchTimeout(NearlyImmediate),
+		sdklog.WithMaxExportBatchSize(config.GetConfig(ctx).LogBatchSize),
+		sdklog.WithMaxExportBatchBytes(config.GetConfig(ctx).LogBatchBytes),
+	}
+
+	if blocking {
+		processorOpts = append(processorOpts, sdklog.WithBlocking())
+	}
+
+	lp := sdklog.NewLoggerProvider(resources)
+	lp.RegisterLogProcessor(sdklog.NewBatchLogProcessor(exporter, processorOpts...))
+
+	return lp
+}
+
+// CheckAvailable returns an error wrapping otlploggrpc.ErrCircuitOpen if the
+// circuit breaker of a destination is open, so that the invocation fails
+// fast and the event source retries it later. Destinations which spill to
+// disk or ignore their failures still accept records.
+func (c *OtelClient) CheckAvailable(ctx context.Context) error {
+	if config.GetConfig(ctx).SpillEnabled {
+		return nil
+	}
+
+	for _, d := range c.destinations {
+		if d.exporter != nil && !d.ignoreFailures && d.exporter.CircuitOpen() {
+			return fmt.Errorf("exporter %s: %w", d.name, otlploggrpc.ErrCircuitOpen)
+		}
+	}
+
+	return nil
+}
+
+// ReplaySpill exports the logs the destinations spilled to disk during the
+// previous invocations, so that they are delivered before the records of
+// the invocation rather than whenever the next export happens.
+func (c *OtelClient) ReplaySpill(ctx context.Context) error {
+	var errs []error
+	for _, d := range c.destinations {
+		if d.spill == nil {
+			continue
+		}
+		if err := d.spill.Replay(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("exporter %s: %w", d.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Spilled reports whether logs of a destination, other than those with
+// ignore_failures, are on disk waiting to be replayed. ForceFlush succeeds
+// once the logs are spilled, but they are lost with the execution
+// environment, so the checkpoints covering them must not be saved.
+func (c *OtelClient) Spilled() bool {
+	for _, d := range c.destinations {
+		if d.spill != nil && !d.ignoreFailures && d.spill.Pending() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ForceFlush exports the buffered records of every destination. It gives up
+// shortly before the deadline of ctx, which for a handler is the Lambda
+// timeout. The errors of destinations with ignore_failures are logged rather
+// than returned. Once the records are delivered, the LOG_METRICS of the
+// invocation, the records throttled by the RATE_LIMITS and those dropped
+// over LOG_MAX_RECORD_BYTES are sent to the collector of the default
+// destination.
+func (c *OtelClient) ForceFlush(ctx context.Context) error {
+	throttled := reportRateLimits(ctx)
+	oversized := reportOversized(ctx)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-FlushMargin))
+		defer cancel()
+	}
+
+	if err := c.flushDestinations(ctx); err != nil {
+		discardMetrics()
+		return err
+	}
+
+	var extra []*metricpb.Metric
+	if throttled != nil {
+		extra = append(extra, throttled)
+	}
+	if oversized != nil {
+		extra = append(extra, oversized)
+	}
+	exportMetrics(ctx, c.destinations[config.DefaultExporterName].exporter, c.resource, extra...)
+
+	return nil
+}
+
+// DiscardMetrics drops the LOG_METRICS aggregated by an invocation which
+// failed, so that they are not exported by ForceFlush. The invocation is
+// retried and counts its records again.
+func (c *OtelClient) DiscardMetrics() {
+	discardMetrics()
+}
+
+// flushDestinations flushes the destinations in parallel.
+func (c *OtelClient) flushDestinations(ctx context.Context) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
 	)
+	for _, d := range c.destinations {
+		wg.Add(1)
+		go func(d *destination) {
+			defer wg.Done()
 
-	lp.RegisterLogProcessor(processor)
+			err := d.provider.ForceFlush(ctx)
+			if err == nil {
+				return
+			}
+			if d.ignoreFailures {
+				logger.GetLogger(ctx).WarnContext(ctx, "ignoring export failure", "exporter", d.name, "error", err)
+				return
+			}
 
-	logger := lp.Logger("log/slog")
+			mu.Lock()
+			errs = append(errs, fmt.Errorf("exporter %s: %w", d.name, err))
+			mu.Unlock()
+		}(d)
+	}
+	wg.Wait()
 
-	return &OtelClient{
-		Config:       cfg,
-		LogProcessor: lp,
-		Logger:       logger,
-	}, err
+	return errors.Join(errs...)
+}
+
+// newDebugExporter returns the exporter selected by DEBUG_EXPORTER, which
+// writes every exported record as OTLP-JSON alongside the exporters of the
+// destinations. It returns nil if no debug exporter is configured.
+func newDebugExporter(ctx context.Context) (sdklog.LogExporter, error) {
+	cfg := config.GetConfig(ctx)
+
+	switch cfg.DebugExporter {
+	case "":
+		return nil, nil
+	case "stdout":
+		return stdoutlog.New(stdoutlog.WithWriter(os.Stdout))
+	case "stderr":
+		return stdoutlog.New(stdoutlog.WithWriter(os.Stderr))
+	case "file":
+		return stdoutlog.New(stdoutlog.WithFile(cfg.DebugExporterPath))
+	default:
+		return nil, fmt.Errorf("unknown debug exporter %q", cfg.DebugExporter)
+	}
 }
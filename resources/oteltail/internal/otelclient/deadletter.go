@@ -0,0 +1,133 @@
+package otelclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"oteltail/internal/config"
+	"oteltail/internal/deadletter"
+	"oteltail/internal/telemetry/sdklog"
+	"oteltail/internal/telemetry/sdklog/otlploggrpc"
+	"oteltail/internal/telemetry/sdklog/otlploggrpc/transform"
+	"oteltail/internal/telemetry/sdklog/spill"
+)
+
+const (
+	// EXPORT_ERROR_POLICY_FAIL fails the flush when the collector rejects the
+	// logs.
+	EXPORT_ERROR_POLICY_FAIL = "fail"
+	// EXPORT_ERROR_POLICY_DEADLETTER writes the logs the collector, or Loki,
+	// rejects as invalid to DEADLETTER_URL.
+	EXPORT_ERROR_POLICY_DEADLETTER = "deadletter"
+)
+
+var (
+	deadLetterSinkOnce sync.Once
+	deadLetterSink     deadletter.Sink
+	deadLetterSinkErr  error
+)
+
+// DeadLetterSink returns the sink configured by DEADLETTER_URL, it is created
+// once per process.
+func DeadLetterSink(ctx context.Context) (deadletter.Sink, error) {
+	deadLetterSinkOnce.Do(func() {
+		deadLetterSink, deadLetterSinkErr = deadletter.New(ctx, config.GetConfig(ctx).DeadLetterURL)
+	})
+	return deadLetterSink, deadLetterSinkErr
+}
+
+// deadLetterExporter writes the logs the collector rejects as invalid to a
+// sink rather than failing the export, retrying them would fail every retry
+// of the invocation the same way. It sits below the spill so that rejected
+// logs are not spilled either.
+type deadLetterExporter struct {
+	next spill.RawExporter
+	name string
+	sink deadletter.Sink
+}
+
+// Compile time check *deadLetterExporter implements spill.RawExporter.
+var _ spill.RawExporter = (*deadLetterExporter)(nil)
+
+func (e *deadLetterExporter) ExportLogs(ctx context.Context, logs []*sdklog.LogData) error {
+	return e.ExportResourceLogs(ctx, transform.Logs(logs))
+}
+
+func (e *deadLetterExporter) ExportResourceLogs(ctx context.Context, resourceLogs []*logspb.ResourceLogs) error {
+	err := e.next.ExportResourceLogs(ctx, resourceLogs)
+	if err == nil || !otlploggrpc.Permanent(err) {
+		return err
+	}
+
+	// the requests of a split export which were delivered are not rejected
+	var unsent *otlploggrpc.UnsentError
+	if errors.As(err, &unsent) {
+		resourceLogs = unsent.Unsent
+	}
+
+	return writeDeadLetters(ctx, e.sink, e.name, resourceLogs, err)
+}
+
+func (e *deadLetterExporter) Shutdown(ctx context.Context) error {
+	return e.next.Shutdown(ctx)
+}
+
+// writeDeadLetters writes the logs the exporter name had rejected to the
+// sink. It returns nil once they are written.
+func writeDeadLetters(ctx context.Context, sink deadletter.Sink, name string, resourceLogs []*logspb.ResourceLogs, cause error) error {
+	records := deadLetterRecords(name, resourceLogs, cause)
+	if err := sink.Write(ctx, records); err != nil {
+		return errors.Join(cause, fmt.Errorf("failed to dead-letter %d records: %w", len(records), err))
+	}
+
+	slog.Warn("records rejected by the collector were dead-lettered", "exporter", name, "count", len(records), "error", cause)
+
+	return nil
+}
+
+// deadLetterRecords converts the rejected logs, the body is the line and the
+// string attributes are the labels.
+func deadLetterRecords(exporter string, resourceLogs []*logspb.ResourceLogs, cause error) []deadletter.Record {
+	now := time.Now()
+
+	var records []deadletter.Record
+	for _, rl := range resourceLogs {
+		for _, sl := range rl.GetScopeLogs() {
+			for _, lr := range sl.GetLogRecords() {
+				labels := make(map[string]string, len(lr.GetAttributes()))
+				for _, kv := range lr.GetAttributes() {
+					if v, ok := kv.GetValue().GetValue().(*commonpb.AnyValue_StringValue); ok {
+						labels[kv.GetKey()] = v.StringValue
+					}
+				}
+
+				records = append(records, deadletter.Record{
+					Source: "exporter:" + exporter,
+					Line:   bodyLine(lr.GetBody()),
+					Error:  cause.Error(),
+					Labels: labels,
+					Time:   now,
+				})
+			}
+		}
+	}
+
+	return records
+}
+
+// bodyLine returns a string body as is and any other body as JSON.
+func bodyLine(body *commonpb.AnyValue) string {
+	if v, ok := body.GetValue().(*commonpb.AnyValue_StringValue); ok {
+		return v.StringValue
+	}
+	line, _ := protojson.Marshal(body)
+	return string(line)
+}
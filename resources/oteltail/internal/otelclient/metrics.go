@@ -0,0 +1,332 @@
+package otelclient
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/sdk/resource"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"oteltail/internal/config"
+	"oteltail/internal/logger"
+	"oteltail/internal/telemetry/sdklog/otlploggrpc"
+	"oteltail/internal/telemetry/sdklog/otlploggrpc/transform"
+	"oteltail/pkg/version"
+)
+
+// metricSeries is the aggregate of a LOG_METRICS metric for one set of
+// attribute values.
+type metricSeries struct {
+	values []string
+	count  uint64
+	sum    float64
+	last   float64
+	// buckets counts the histogram values, the last one is above every bound.
+	buckets []uint64
+}
+
+// logMetrics aggregates the LOG_METRICS over an invocation.
+type logMetrics struct {
+	mu    sync.Mutex
+	start time.Time
+	// series holds the series of each metric by attribute values.
+	series map[string]map[string]*metricSeries
+	// overflow counts the records dropped by LOG_METRICS_MAX_SERIES.
+	overflow map[string]int
+}
+
+var metrics = &logMetrics{}
+
+// metricObservation is a value of a LOG_METRICS metric for a record.
+type metricObservation struct {
+	metric *config.MetricConfig
+	values []string
+	value  float64
+}
+
+// entryMetrics holds the observations of an entry until it is sent, with
+// the scope of the message it was read from, if any.
+type entryMetrics struct {
+	scope        *metricScope
+	observations []metricObservation
+}
+
+// metricScope holds the observations of the records of an SQS or SNS
+// message until it is processed. The records of a failed message are
+// counted again when it is delivered again.
+type metricScope struct {
+	parent *metricScope
+
+	mu           sync.Mutex
+	done         bool
+	observations []metricObservation
+}
+
+type metricScopeKey struct{}
+
+// WithMetricScope returns a context whose records are counted by the
+// LOG_METRICS once EndMetricScope is called, if the records were processed.
+func WithMetricScope(ctx context.Context) context.Context {
+	parent, _ := ctx.Value(metricScopeKey{}).(*metricScope)
+	return context.WithValue(ctx, metricScopeKey{}, &metricScope{parent: parent})
+}
+
+// EndMetricScope counts the records of the scope of ctx by the LOG_METRICS
+// if processed is set and drops them otherwise. The records sent afterwards
+// are counted right away.
+func EndMetricScope(ctx context.Context, processed bool) {
+	scope, ok := ctx.Value(metricScopeKey{}).(*metricScope)
+	if !ok {
+		return
+	}
+
+	scope.mu.Lock()
+	observations := scope.observations
+	scope.observations = nil
+	scope.done = true
+	scope.mu.Unlock()
+
+	if processed {
+		recordMetrics(ctx, scope.parent, observations)
+	}
+}
+
+// observeMetrics returns the observations of the LOG_METRICS the entry is
+// counted by, they are recorded by recordMetrics once the entry is sent.
+func observeMetrics(ctx context.Context, e LogEntry) *entryMetrics {
+	cfg := config.GetConfig(ctx)
+
+	var observations []metricObservation
+	for i := range cfg.LogMetrics {
+		m := &cfg.LogMetrics[i]
+		if !m.Matches(e.Labels) {
+			continue
+		}
+
+		fields, ok := m.Fields(e.Labels, e.Attributes, e.Entry.Line)
+		if !ok {
+			continue
+		}
+
+		value := 1.0
+		if m.Source != "" {
+			v, err := strconv.ParseFloat(string(fields[model.LabelName(m.Source)]), 64)
+			if err != nil {
+				continue
+			}
+			value = v
+		}
+
+		values := make([]string, len(m.Labels))
+		for i, name := range m.Labels {
+			values[i] = string(fields[model.LabelName(name)])
+		}
+
+		observations = append(observations, metricObservation{metric: m, values: values, value: value})
+	}
+
+	if len(observations) == 0 {
+		return nil
+	}
+
+	scope, _ := ctx.Value(metricScopeKey{}).(*metricScope)
+	return &entryMetrics{scope: scope, observations: observations}
+}
+
+// recordMetrics adds the observations to scope, or to the aggregates
+// without a scope or once it ended.
+func recordMetrics(ctx context.Context, scope *metricScope, observations []metricObservation) {
+	for ; scope != nil; scope = scope.parent {
+		scope.mu.Lock()
+		if !scope.done {
+			scope.observations = append(scope.observations, observations...)
+			scope.mu.Unlock()
+			return
+		}
+		scope.mu.Unlock()
+	}
+
+	maxSeries := config.GetConfig(ctx).LogMetricsMaxSeries
+	for _, o := range observations {
+		metrics.observe(*o.metric, o.values, o.value, maxSeries)
+	}
+}
+
+func (l *logMetrics) observe(m config.MetricConfig, values []string, value float64, maxSeries int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.series == nil {
+		l.start = time.Now()
+		l.series = make(map[string]map[string]*metricSeries)
+		l.overflow = make(map[string]int)
+	}
+
+	series, ok := l.series[m.Name]
+	if !ok {
+		series = make(map[string]*metricSeries)
+		l.series[m.Name] = series
+	}
+
+	key := strings.Join(values, "\x00")
+	s, ok := series[key]
+	if !ok {
+		if maxSeries > 0 && len(series) >= maxSeries {
+			l.overflow[m.Name]++
+			return
+		}
+		s = &metricSeries{values: values}
+		if m.Type == config.METRIC_TYPE_HISTOGRAM {
+			s.buckets = make([]uint64, len(m.Buckets)+1)
+		}
+		series[key] = s
+	}
+
+	s.count++
+	s.sum += value
+	s.last = value
+	if s.buckets != nil {
+		s.buckets[sort.SearchFloat64s(m.Buckets, value)]++
+	}
+}
+
+// take returns the aggregates and resets them.
+func (l *logMetrics) take() (time.Time, map[string]map[string]*metricSeries, map[string]int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	start, series, overflow := l.start, l.series, l.overflow
+	l.series = nil
+	l.overflow = nil
+
+	return start, series, overflow
+}
+
+// discardMetrics drops the aggregates of an invocation which failed, it is
+// retried and counts its records again.
+func discardMetrics() {
+	metrics.take()
+}
+
+// exportMetrics sends the LOG_METRICS aggregated since the last export, and
+// the extra metrics of oteltail itself, to the collector of the default
+// destination, as delta sums, gauges and histograms. The aggregates are
+// dropped if they could not be sent.
+func exportMetrics(ctx context.Context, exporter *otlploggrpc.Client, res *resource.Resource, extra ...*metricpb.Metric) {
+	start, series, overflow := metrics.take()
+	if (len(series) == 0 && len(extra) == 0) || exporter == nil {
+		return
+	}
+
+	for name, n := range overflow {
+		logger.GetLogger(ctx).WarnContext(ctx, "too many series, records not counted", "metric", name, "count", n)
+	}
+
+	now := time.Now()
+
+	var out []*metricpb.Metric
+	for _, m := range config.GetConfig(ctx).LogMetrics {
+		if s, ok := series[m.Name]; ok {
+			out = append(out, metricProto(m, s, start, now))
+		}
+	}
+	out = append(out, extra...)
+
+	err := exporter.ExportMetrics(ctx, []*metricpb.ResourceMetrics{{
+		Resource: transform.Resource(res),
+		ScopeMetrics: []*metricpb.ScopeMetrics{{
+			Scope: &commonpb.InstrumentationScope{
+				Name:    "oteltail",
+				Version: version.Version,
+			},
+			Metrics: out,
+		}},
+	}})
+	if err != nil {
+		logger.GetLogger(ctx).WarnContext(ctx, "unable to export log metrics", "error", err)
+	}
+}
+
+func metricProto(m config.MetricConfig, series map[string]*metricSeries, start time.Time, now time.Time) *metricpb.Metric {
+	startNano := uint64(start.UnixNano())
+	nowNano := uint64(now.UnixNano())
+
+	// sort the series for a stable output
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := &metricpb.Metric{
+		Name:        m.Name,
+		Description: m.Description,
+		Unit:        m.Unit,
+	}
+
+	switch m.Type {
+	case config.METRIC_TYPE_GAUGE:
+		gauge := &metricpb.Gauge{}
+		for _, key := range keys {
+			s := series[key]
+			gauge.DataPoints = append(gauge.DataPoints, &metricpb.NumberDataPoint{
+				Attributes:   metricAttributes(m.Labels, s.values),
+				TimeUnixNano: nowNano,
+				Value:        &metricpb.NumberDataPoint_AsDouble{AsDouble: s.last},
+			})
+		}
+		out.Data = &metricpb.Metric_Gauge{Gauge: gauge}
+	case config.METRIC_TYPE_HISTOGRAM:
+		histogram := &metricpb.Histogram{
+			AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+		}
+		for _, key := range keys {
+			s := series[key]
+			sum := s.sum
+			histogram.DataPoints = append(histogram.DataPoints, &metricpb.HistogramDataPoint{
+				Attributes:        metricAttributes(m.Labels, s.values),
+				StartTimeUnixNano: startNano,
+				TimeUnixNano:      nowNano,
+				Count:             s.count,
+				Sum:               &sum,
+				BucketCounts:      s.buckets,
+				ExplicitBounds:    m.Buckets,
+			})
+		}
+		out.Data = &metricpb.Metric_Histogram{Histogram: histogram}
+	default:
+		sum := &metricpb.Sum{
+			AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			IsMonotonic:            true,
+		}
+		for _, key := range keys {
+			s := series[key]
+			sum.DataPoints = append(sum.DataPoints, &metricpb.NumberDataPoint{
+				Attributes:        metricAttributes(m.Labels, s.values),
+				StartTimeUnixNano: startNano,
+				TimeUnixNano:      nowNano,
+				Value:             &metricpb.NumberDataPoint_AsDouble{AsDouble: s.sum},
+			})
+		}
+		out.Data = &metricpb.Metric_Sum{Sum: sum}
+	}
+
+	return out
+}
+
+func metricAttributes(names []string, values []string) []*commonpb.KeyValue {
+	attrs := make([]*commonpb.KeyValue, 0, len(names))
+	for i, name := range names {
+		attrs = append(attrs, &commonpb.KeyValue{
+			Key:   name,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: values[i]}},
+		})
+	}
+	return attrs
+}
@@ -0,0 +1,235 @@
+package otelclient
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/log/noop"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"oteltail/internal/config"
+)
+
+// takeMetrics returns the aggregates of metric and resets them all.
+func takeMetrics(t *testing.T, name string) (map[string]*metricSeries, int) {
+	t.Helper()
+	_, series, overflow := metrics.take()
+	return series[name], overflow[name]
+}
+
+func metricsContext(t *testing.T, cfg *config.Configuration) context.Context {
+	t.Helper()
+	metrics.take()
+	t.Cleanup(func() { metrics.take() })
+
+	if cfg.LogBatchSize == 0 {
+		cfg.LogBatchSize = 100
+		cfg.LogBatchBytes = 1 << 20
+		cfg.LogMaxRecordBytes = 1 << 20
+	}
+	return config.WithConfig(context.Background(), cfg)
+}
+
+// useRateLimiter replaces the rate limit buckets for the duration of the
+// test.
+func useRateLimiter(t *testing.T) {
+	t.Helper()
+
+	saved := limiter
+	limiter = &rateLimiter{}
+	t.Cleanup(func() { limiter = saved })
+}
+
+func observe(ctx context.Context, labels model.LabelSet) {
+	if m := observeMetrics(ctx, LogEntry{Labels: labels}); m != nil {
+		recordMetrics(ctx, m.scope, m.observations)
+	}
+}
+
+func TestMetricsAggregation(t *testing.T) {
+	ctx := metricsContext(t, &config.Configuration{
+		LogMetrics: []config.MetricConfig{
+			{Name: "records", Labels: []string{"level"}},
+			{Name: "bytes", Source: "size"},
+			{Name: "size", Type: config.METRIC_TYPE_GAUGE, Source: "size"},
+			{Name: "sizes", Type: config.METRIC_TYPE_HISTOGRAM, Source: "size", Buckets: []float64{1, 5}},
+		},
+	})
+
+	for _, labels := range []model.LabelSet{
+		{"level": "info", "size": "0.5"},
+		{"level": "info", "size": "1"},
+		{"level": "error", "size": "3"},
+		{"level": "info", "size": "10"},
+		// not a number, only counted by the metrics without a source
+		{"level": "info", "size": "large"},
+	} {
+		observe(ctx, labels)
+	}
+
+	start, series, _ := metrics.take()
+	now := start.Add(time.Second)
+	cfg := config.GetConfig(ctx)
+
+	records := metricProto(cfg.LogMetrics[0], series["records"], start, now).GetSum()
+	if records.AggregationTemporality != metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA || !records.IsMonotonic {
+		t.Errorf("records is not a monotonic delta sum: %v", records)
+	}
+	counts := map[string]float64{}
+	for _, dp := range records.DataPoints {
+		counts[dp.Attributes[0].Value.GetStringValue()] = dp.GetAsDouble()
+	}
+	if counts["info"] != 4 || counts["error"] != 1 || len(counts) != 2 {
+		t.Errorf("records = %v, want 4 info and 1 error", counts)
+	}
+
+	bytes := metricProto(cfg.LogMetrics[1], series["bytes"], start, now).GetSum()
+	if len(bytes.DataPoints) != 1 || bytes.DataPoints[0].GetAsDouble() != 14.5 {
+		t.Errorf("bytes = %v, want a single point of 14.5", bytes.DataPoints)
+	}
+
+	size := metricProto(cfg.LogMetrics[2], series["size"], start, now).GetGauge()
+	if len(size.DataPoints) != 1 || size.DataPoints[0].GetAsDouble() != 10 {
+		t.Errorf("size = %v, want the last value, 10", size.DataPoints)
+	}
+
+	sizes := metricProto(cfg.LogMetrics[3], series["sizes"], start, now).GetHistogram()
+	if len(sizes.DataPoints) != 1 {
+		t.Fatalf("sizes has %d points, want 1", len(sizes.DataPoints))
+	}
+	dp := sizes.DataPoints[0]
+	if dp.Count != 4 || dp.GetSum() != 14.5 {
+		t.Errorf("sizes count %d sum %v, want 4 and 14.5", dp.Count, dp.GetSum())
+	}
+	// the bounds are inclusive upper bounds
+	if want := []uint64{2, 1, 1}; len(dp.BucketCounts) != len(want) || dp.BucketCounts[0] != want[0] || dp.BucketCounts[1] != want[1] || dp.BucketCounts[2] != want[2] {
+		t.Errorf("sizes buckets = %v, want %v", dp.BucketCounts, want)
+	}
+}
+
+func TestMetricsMaxSeries(t *testing.T) {
+	ctx := metricsContext(t, &config.Configuration{
+		LogMetricsMaxSeries: 2,
+		LogMetrics:          []config.MetricConfig{{Name: "records", Labels: []string{"level"}}},
+	})
+
+	for _, level := range []model.LabelValue{"info", "error", "debug", "info", "warn"} {
+		observe(ctx, model.LabelSet{"level": level})
+	}
+
+	series, overflow := takeMetrics(t, "records")
+	if len(series) != 2 {
+		t.Errorf("%d series, want 2", len(series))
+	}
+	if s := series["info"]; s == nil || s.count != 2 {
+		t.Errorf("info series = %v, want the existing series still counted", s)
+	}
+	if overflow != 2 {
+		t.Errorf("overflow = %d, want 2", overflow)
+	}
+}
+
+func TestMetricsSentRecords(t *testing.T) {
+	useRateLimiter(t)
+
+	ctx := metricsContext(t, &config.Configuration{
+		TimestampMaxAge:      time.Hour,
+		TimestampOutOfWindow: TIMESTAMP_WINDOW_DROP,
+		RateLimits: []config.RateLimitConfig{{
+			Name:             "test_metrics_sent",
+			RecordsPerSecond: 0.001,
+			BurstRecords:     2,
+			Action:           config.RATE_LIMIT_ACTION_DROP,
+		}},
+		LogMetrics: []config.MetricConfig{{Name: "records", Labels: []string{"id"}}},
+	})
+
+	b, _ := NewBatch(ctx, &OtelClient{Logger: noop.NewLoggerProvider().Logger("")})
+	for _, e := range []LogEntry{
+		{Labels: model.LabelSet{"id": "sent"}, Entry: logproto.Entry{Line: "sent", Timestamp: time.Now()}},
+		{Labels: model.LabelSet{"id": "old"}, Entry: logproto.Entry{Line: "old", Timestamp: time.Unix(1, 0)}},
+		{Labels: model.LabelSet{"id": "limited"}, Entry: logproto.Entry{Line: "limited", Timestamp: time.Now()}},
+	} {
+		if err := b.Add(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if series, _ := takeMetrics(t, "records"); len(series) != 0 {
+		t.Errorf("records counted before they were sent: %v", series)
+	}
+
+	if err := b.FlushBatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	series, _ := takeMetrics(t, "records")
+	if len(series) != 1 || series["sent"] == nil || series["sent"].count != 1 {
+		t.Errorf("records = %v, want only the sent record counted", series)
+	}
+}
+
+func TestMetricsSplitRecord(t *testing.T) {
+	ctx := metricsContext(t, &config.Configuration{
+		LogBatchSize:      100,
+		LogBatchBytes:     1 << 20,
+		LogMaxRecordBytes: 256,
+		LogOversizeAction: LOG_OVERSIZE_SPLIT,
+		LogMetrics:        []config.MetricConfig{{Name: "records"}},
+	})
+
+	b, _ := NewBatch(ctx, &OtelClient{Logger: noop.NewLoggerProvider().Logger("")})
+	if err := b.Add(ctx, LogEntry{Entry: logproto.Entry{Line: strings.Repeat("a", 1000), Timestamp: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	if b.LineCount < 2 {
+		t.Fatalf("record split in %d records", b.LineCount)
+	}
+	if err := b.FlushBatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	series, _ := takeMetrics(t, "records")
+	if s := series[""]; s == nil || s.count != 1 {
+		t.Errorf("records = %v, want the split record counted once", s)
+	}
+}
+
+func TestMetricScope(t *testing.T) {
+	ctx := metricsContext(t, &config.Configuration{
+		LogMetrics: []config.MetricConfig{{Name: "records", Labels: []string{"id"}}},
+	})
+
+	failed := WithMetricScope(ctx)
+	observe(failed, model.LabelSet{"id": "failed"})
+
+	processed := WithMetricScope(ctx)
+	observe(processed, model.LabelSet{"id": "processed"})
+	nested := WithMetricScope(processed)
+	observe(nested, model.LabelSet{"id": "nested"})
+
+	if series, _ := takeMetrics(t, "records"); len(series) != 0 {
+		t.Fatalf("records counted before the end of their scope: %v", series)
+	}
+
+	EndMetricScope(failed, false)
+	EndMetricScope(nested, true)
+	EndMetricScope(processed, true)
+
+	// counted right away once the scope ended
+	observe(processed, model.LabelSet{"id": "late"})
+
+	series, _ := takeMetrics(t, "records")
+	for _, id := range []string{"processed", "nested", "late"} {
+		if s := series[id]; s == nil || s.count != 1 {
+			t.Errorf("%s = %v, want counted once", id, s)
+		}
+	}
+	if s := series["failed"]; s != nil {
+		t.Errorf("failed = %v, want the records of the failed scope dropped", s)
+	}
+}
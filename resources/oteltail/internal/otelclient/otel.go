@@ -2,11 +2,13 @@ package otelclient
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/grafana/loki/pkg/logproto"
 	"github.com/prometheus/common/model"
 	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
 
 	"oteltail/internal/config"
 	"oteltail/internal/logger"
@@ -16,12 +18,31 @@ import (
 type LogEntry struct {
 	Entry  logproto.Entry
 	Labels model.LabelSet
+	// Attributes are added to the record without being part of its stream labels.
+	Attributes []log.KeyValue
+	// Body replaces Entry.Line as the record body when set.
+	Body log.Value
+	// Severity and SeverityText are the level of the record, if known.
+	Severity     log.Severity
+	SeverityText string
+	// TraceID correlates the record with a trace instead of the Lambda
+	// request when set.
+	TraceID trace.TraceID
+
+	// metrics are the LOG_METRICS observations of the entry, counted once
+	// it is sent.
+	metrics *entryMetrics
 }
 
+// Batch groups entries by stream until they are sent. It is safe for
+// concurrent use.
 type Batch struct {
+	mu        sync.Mutex
 	Streams   map[string]*Stream
 	LineCount int
-	Client    Client
+	// Bytes is the estimated encoded size of the entries, see entrySize.
+	Bytes  int
+	Client Client
 }
 
 type Stream struct {
@@ -49,42 +70,125 @@ func NewBatch(ctx context.Context, oClient Client, entries ...LogEntry) (*Batch,
 	return b, nil
 }
 
+type labelsKey struct{}
+
+// WithLabels returns a context whose entries added to a Batch get labels,
+// unless they have their own value for them. The labels already in ctx,
+// those of an enclosing event, are kept unless labels overrides them.
+func WithLabels(ctx context.Context, labels model.LabelSet) context.Context {
+	if parent, ok := ctx.Value(labelsKey{}).(model.LabelSet); ok {
+		labels = parent.Merge(labels)
+	}
+	return context.WithValue(ctx, labelsKey{}, labels)
+}
+
+// Add appends the entry to the batch. The batch is sent once it holds
+// LOG_BATCH_SIZE entries or LOG_BATCH_BYTES, and before an entry would push
+// it over LOG_BATCH_BYTES. Entries over a RATE_LIMITS limit are dropped,
+// delayed or make Add return ErrRateLimited, and entries which cannot be cut
+// to LOG_MAX_RECORD_BYTES are dropped. The entries which are sent are
+// counted by the LOG_METRICS they match.
 func (b *Batch) Add(ctx context.Context, e LogEntry) error {
-	labels := utils.LabelsMapToString(e.Labels)
-	stream, ok := b.Streams[labels]
-	if !ok {
-		b.Streams[labels] = &Stream{
-			Labels:  e.Labels,
-			Entries: []LogEntry{},
+	cfg := config.GetConfig(ctx)
+
+	if labels, ok := ctx.Value(labelsKey{}).(model.LabelSet); ok {
+		e.Labels = labels.Merge(e.Labels)
+	}
+
+	observed := observeMetrics(ctx, e)
+
+	// the delay action waits, apply the limits before locking the batch so
+	// that the other goroutines adding to it are not held up
+	var (
+		entries []LogEntry
+		sizes   []int
+	)
+	fitted := fitEntry(cfg, e)
+	if len(fitted) == 0 {
+		return dropOversized(ctx, e)
+	}
+	for _, entry := range fitted {
+		size := entrySize(entry)
+
+		if keep, err := applyRateLimits(ctx, entry, size); err != nil {
+			return err
+		} else if keep {
+			// the parts of a split entry count as one record
+			if len(entries) == 0 {
+				entry.metrics = observed
+			}
+			entries = append(entries, entry)
+			sizes = append(sizes, size)
 		}
-		stream = b.Streams[labels]
 	}
 
-	stream.Entries = append(stream.Entries, e)
-	b.LineCount += 1
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, entry := range entries {
+		size := sizes[i]
+
+		if b.LineCount > 0 && b.Bytes+size > cfg.LogBatchBytes {
+			if err := b.flush(ctx); err != nil {
+				return err
+			}
+		}
+
+		labels := utils.LabelsMapToString(entry.Labels)
+		stream, ok := b.Streams[labels]
+		if !ok {
+			b.Streams[labels] = &Stream{
+				Labels:  entry.Labels,
+				Entries: []LogEntry{},
+			}
+			stream = b.Streams[labels]
+		}
 
-	if b.LineCount > config.GetConfig(ctx).LogBatchSize {
-		return b.FlushBatch(ctx)
+		stream.Entries = append(stream.Entries, entry)
+		b.LineCount += 1
+		b.Bytes += size
+
+		if b.LineCount >= cfg.LogBatchSize || b.Bytes >= cfg.LogBatchBytes {
+			if err := b.flush(ctx); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
 func (b *Batch) FlushBatch(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.flush(ctx)
+}
+
+// flush sends the batch, b.mu must be held.
+func (b *Batch) flush(ctx context.Context) error {
 	if b.Client != nil {
 		err := b.Client.SendToOtel(ctx, b)
 		if err != nil {
 			return err
 		}
 	}
-	b.ResetBatch()
+	b.reset()
 
 	return nil
 }
 
 func (b *Batch) ResetBatch() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.reset()
+}
+
+func (b *Batch) reset() {
 	b.Streams = make(map[string]*Stream)
 	b.LineCount = 0
+	b.Bytes = 0
 }
 
 func (c *OtelClient) SendToOtel(ctx context.Context, b *Batch) error {
@@ -95,21 +199,58 @@ func (c *OtelClient) SendToOtel(ctx context.Context, b *Batch) error {
 
 	//lc, _ := lambdacontext.FromContext(ctx)
 
+	var dropped int
+
 	for _, stream := range b.Streams {
 
+		loggers := c.route(stream.Labels)
+
+		// the latest timestamp sent in the stream, see applyTimestampWindow
+		var last time.Time
+
 		for _, logentry := range stream.Entries {
 
 			var logRec log.Record
 
+			observed := time.Now()
 			logRec.SetTimestamp(logentry.Entry.Timestamp)
-			logRec.SetObservedTimestamp(time.Now())
-			logRec.SetBody(log.StringValue(string(logentry.Entry.Line)))
+			logRec.SetObservedTimestamp(observed)
+			if logentry.Body.Empty() {
+				logRec.SetBody(log.StringValue(string(logentry.Entry.Line)))
+			} else {
+				logRec.SetBody(logentry.Body)
+			}
+			logRec.SetSeverity(logentry.Severity)
+			logRec.SetSeverityText(logentry.SeverityText)
 			logRec.AddAttributes(logKVs(logentry.Labels)...)
+			logRec.AddAttributes(logentry.Attributes...)
+
+			if !applyTimestampWindow(ctx, &logRec, observed, &last) {
+				dropped++
+				continue
+			}
 
-			c.Logger.Emit(ctx, logRec)
+			emitCtx := ctx
+			if logentry.TraceID.IsValid() {
+				emitCtx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+					TraceID: logentry.TraceID,
+				}))
+			}
+
+			for _, l := range loggers {
+				l.Emit(emitCtx, logRec)
+			}
+
+			if logentry.metrics != nil {
+				recordMetrics(ctx, logentry.metrics.scope, logentry.metrics.observations)
+			}
 		}
 	}
 
+	if dropped > 0 {
+		sendlog.DebugContext(ctx, "dropped records outside of the timestamp window or out of order", "count", dropped)
+	}
+
 	return nil
 }
 
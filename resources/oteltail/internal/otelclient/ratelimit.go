@@ -0,0 +1,239 @@
+package otelclient
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"golang.org/x/time/rate"
+
+	"oteltail/internal/config"
+	"oteltail/internal/logger"
+)
+
+// ErrRateLimited is returned by Batch.Add when a record is over a rate limit
+// with the defer action. The invocation must fail so that the event source
+// sends the records again later.
+var ErrRateLimited = errors.New("rate limit reached, deferring the records")
+
+// maxRateLimitBuckets bounds the number of buckets kept between invocations,
+// they are all reset once it is reached.
+const maxRateLimitBuckets = 10000
+
+type rateLimitBucket struct {
+	records *rate.Limiter
+	bytes   *rate.Limiter
+}
+
+type rateLimitCounts struct {
+	dropped  int
+	delayed  int
+	deferred int
+	delay    time.Duration
+}
+
+// rateLimiter holds the buckets of the RATE_LIMITS. They live as long as the
+// execution environment, so that the limits also apply across invocations.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*rateLimitBucket
+	counts  map[string]*rateLimitCounts
+	// since is when the counts started.
+	since time.Time
+}
+
+var limiter = &rateLimiter{}
+
+func (l *rateLimiter) bucket(limit config.RateLimitConfig, key string) *rateLimitBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.buckets == nil || len(l.buckets) >= maxRateLimitBuckets {
+		l.buckets = make(map[string]*rateLimitBucket)
+	}
+
+	key = limit.Name + "\x00" + key
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &rateLimitBucket{
+			records: newLimiter(limit.RecordsPerSecond, limit.BurstRecords),
+			bytes:   newLimiter(limit.BytesPerSecond, limit.BurstBytes),
+		}
+		l.buckets[key] = b
+	}
+
+	return b
+}
+
+func newLimiter(perSecond float64, burst int) *rate.Limiter {
+	if perSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	if burst <= 0 {
+		burst = max(int(perSecond), 1)
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), burst)
+}
+
+func (l *rateLimiter) count(name string, fn func(c *rateLimitCounts)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.counts == nil {
+		l.counts = make(map[string]*rateLimitCounts)
+		l.since = time.Now()
+	}
+	c, ok := l.counts[name]
+	if !ok {
+		c = &rateLimitCounts{}
+		l.counts[name] = c
+	}
+	fn(c)
+}
+
+// reserve takes n tokens, at most the burst, from the limiter.
+func reserve(l *rate.Limiter, now time.Time, n int) *rate.Reservation {
+	return l.ReserveN(now, min(n, max(l.Burst(), 1)))
+}
+
+// applyRateLimits applies the RATE_LIMITS matching the entry, of the given
+// size. It reports whether the entry must be sent. The tokens taken from the
+// buckets of every limit are given back unless it is.
+func applyRateLimits(ctx context.Context, e LogEntry, size int) (bool, error) {
+	cfg := config.GetConfig(ctx)
+
+	// cancel gives back the tokens reserved so far, the record is not sent
+	var reserved []func()
+	cancel := func() {
+		for _, fn := range reserved {
+			fn()
+		}
+	}
+
+	for _, limit := range cfg.RateLimits {
+		if !limit.Matches(e.Labels) {
+			continue
+		}
+
+		b := limiter.bucket(limit, limit.BucketKey(e.Labels))
+
+		now := time.Now()
+		records := reserve(b.records, now, 1)
+		bytes := reserve(b.bytes, now, size)
+		reserved = append(reserved, func() {
+			records.CancelAt(now)
+			bytes.CancelAt(now)
+		})
+
+		delay := max(records.DelayFrom(now), bytes.DelayFrom(now))
+		if delay == 0 {
+			continue
+		}
+
+		if limit.Action == config.RATE_LIMIT_ACTION_DELAY && delay < delayBudget(ctx) {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				cancel()
+				return false, ctx.Err()
+			case <-timer.C:
+			}
+			limiter.count(limit.Name, func(c *rateLimitCounts) {
+				c.delayed++
+				c.delay += delay
+			})
+			continue
+		}
+
+		cancel()
+
+		if limit.Action == config.RATE_LIMIT_ACTION_DROP {
+			limiter.count(limit.Name, func(c *rateLimitCounts) { c.dropped++ })
+			return false, nil
+		}
+
+		limiter.count(limit.Name, func(c *rateLimitCounts) { c.deferred++ })
+		return false, ErrRateLimited
+	}
+
+	return true, nil
+}
+
+// delayBudget returns how long a record may wait for its tokens, keeping
+// DEADLINE_SAFETY_MARGIN to export the records.
+func delayBudget(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return time.Duration(1<<63 - 1)
+	}
+
+	return time.Until(deadline) - config.GetConfig(ctx).DeadlineSafetyMargin
+}
+
+// reportRateLimits logs the records throttled by each rate limit since the
+// previous report. It returns them as the oteltail.rate_limited_records
+// counter, with the rate_limit and action attributes, or nil if none was
+// throttled.
+func reportRateLimits(ctx context.Context) *metricpb.Metric {
+	limiter.mu.Lock()
+	counts, since := limiter.counts, limiter.since
+	limiter.counts = nil
+	limiter.mu.Unlock()
+
+	if len(counts) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sum := &metricpb.Sum{
+		AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+		IsMonotonic:            true,
+	}
+	now := uint64(time.Now().UnixNano())
+
+	for _, name := range names {
+		c := counts[name]
+		logger.GetLogger(ctx).WarnContext(ctx, "rate limit reached",
+			"rate_limit", name,
+			"dropped", c.dropped,
+			"delayed", c.delayed,
+			"deferred", c.deferred,
+			"delay", c.delay.String(),
+		)
+
+		for _, action := range []struct {
+			name  string
+			count int
+		}{
+			{config.RATE_LIMIT_ACTION_DROP, c.dropped},
+			{config.RATE_LIMIT_ACTION_DELAY, c.delayed},
+			{config.RATE_LIMIT_ACTION_DEFER, c.deferred},
+		} {
+			if action.count == 0 {
+				continue
+			}
+			sum.DataPoints = append(sum.DataPoints, &metricpb.NumberDataPoint{
+				Attributes:        metricAttributes([]string{"rate_limit", "action"}, []string{name, action.name}),
+				StartTimeUnixNano: uint64(since.UnixNano()),
+				TimeUnixNano:      now,
+				Value:             &metricpb.NumberDataPoint_AsInt{AsInt: int64(action.count)},
+			})
+		}
+	}
+
+	return &metricpb.Metric{
+		Name:        "oteltail.rate_limited_records",
+		Description: "Records throttled by the RATE_LIMITS",
+		Unit:        "{record}",
+		Data:        &metricpb.Metric_Sum{Sum: sum},
+	}
+}
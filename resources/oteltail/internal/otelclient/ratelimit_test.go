@@ -0,0 +1,166 @@
+package otelclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"oteltail/internal/config"
+)
+
+func rateLimitContext(t *testing.T, limits ...config.RateLimitConfig) context.Context {
+	t.Helper()
+	useRateLimiter(t)
+
+	return config.WithConfig(context.Background(), &config.Configuration{
+		DeadlineSafetyMargin: time.Second,
+		RateLimits:           limits,
+	})
+}
+
+// tokens returns the records left in the bucket of the limit for the labels.
+func tokens(limit config.RateLimitConfig, labels model.LabelSet) float64 {
+	return limiter.bucket(limit, limit.BucketKey(labels)).records.Tokens()
+}
+
+func TestApplyRateLimits(t *testing.T) {
+	entry := LogEntry{Labels: model.LabelSet{"__aws_log_type": "cloudwatch"}}
+
+	tests := []struct {
+		name    string
+		action  string
+		sent    []bool
+		wantErr error
+		count   func(c *rateLimitCounts) int
+	}{
+		{"drop", config.RATE_LIMIT_ACTION_DROP, []bool{true, true, false}, nil, func(c *rateLimitCounts) int { return c.dropped }},
+		{"defer", config.RATE_LIMIT_ACTION_DEFER, []bool{true, true, false}, ErrRateLimited, func(c *rateLimitCounts) int { return c.deferred }},
+		{"delay", config.RATE_LIMIT_ACTION_DELAY, []bool{true, true, true}, nil, func(c *rateLimitCounts) int { return c.delayed }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := config.RateLimitConfig{Name: "test", RecordsPerSecond: 20, BurstRecords: 2, Action: tt.action}
+			ctx := rateLimitContext(t, limit)
+
+			for i, want := range tt.sent {
+				sent, err := applyRateLimits(ctx, entry, 10)
+				if sent != want {
+					t.Errorf("record %d: sent = %v, want %v", i, sent, want)
+				}
+				if !sent && !errors.Is(err, tt.wantErr) {
+					t.Errorf("record %d: err = %v, want %v", i, err, tt.wantErr)
+				}
+			}
+
+			if n := tt.count(limiter.counts["test"]); n != 1 {
+				t.Errorf("counted %d records, want 1", n)
+			}
+		})
+	}
+}
+
+func TestApplyRateLimitsDelayBudget(t *testing.T) {
+	limit := config.RateLimitConfig{Name: "test", RecordsPerSecond: 0.1, BurstRecords: 1, Action: config.RATE_LIMIT_ACTION_DELAY}
+	ctx, cancel := context.WithTimeout(rateLimitContext(t, limit), 2*time.Second)
+	defer cancel()
+
+	entry := LogEntry{}
+	if sent, err := applyRateLimits(ctx, entry, 10); !sent || err != nil {
+		t.Fatalf("applyRateLimits = %v, %v, want the first record sent", sent, err)
+	}
+
+	// waiting 10s would leave no time to export the records
+	if sent, err := applyRateLimits(ctx, entry, 10); sent || !errors.Is(err, ErrRateLimited) {
+		t.Errorf("applyRateLimits = %v, %v, want the record deferred", sent, err)
+	}
+	if tokens(limit, nil) < -0.01 {
+		t.Errorf("%.2f tokens left, want the tokens of the deferred record given back", tokens(limit, nil))
+	}
+}
+
+func TestApplyRateLimitsCancel(t *testing.T) {
+	generous := config.RateLimitConfig{Name: "generous", RecordsPerSecond: 0.001, BurstRecords: 100, Action: config.RATE_LIMIT_ACTION_DROP}
+	labels := model.LabelSet{}
+
+	t.Run("later limit drops", func(t *testing.T) {
+		strict := config.RateLimitConfig{Name: "strict", RecordsPerSecond: 0.001, BurstRecords: 1, Action: config.RATE_LIMIT_ACTION_DROP}
+		ctx := rateLimitContext(t, generous, strict)
+
+		for i := 0; i < 5; i++ {
+			if _, err := applyRateLimits(ctx, LogEntry{}, 10); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// only the record which was sent took a token
+		if left := tokens(generous, labels); left < 98.9 {
+			t.Errorf("%.2f tokens left in the generous limit, want 99", left)
+		}
+	})
+
+	t.Run("delay cancelled", func(t *testing.T) {
+		delayed := config.RateLimitConfig{Name: "delayed", RecordsPerSecond: 1, BurstRecords: 1, Action: config.RATE_LIMIT_ACTION_DELAY}
+		ctx, cancel := context.WithCancel(rateLimitContext(t, generous, delayed))
+
+		if sent, err := applyRateLimits(ctx, LogEntry{}, 10); !sent || err != nil {
+			t.Fatalf("applyRateLimits = %v, %v, want the first record sent", sent, err)
+		}
+
+		time.AfterFunc(10*time.Millisecond, cancel)
+		if sent, err := applyRateLimits(ctx, LogEntry{}, 10); sent || !errors.Is(err, context.Canceled) {
+			t.Fatalf("applyRateLimits = %v, %v, want the wait cancelled", sent, err)
+		}
+
+		if left := tokens(generous, labels); left < 98.9 {
+			t.Errorf("%.2f tokens left in the generous limit, want 99", left)
+		}
+		if left := tokens(delayed, labels); left < -0.01 {
+			t.Errorf("%.2f tokens left in the delayed limit, want the tokens given back", left)
+		}
+	})
+}
+
+func TestApplyRateLimitsBuckets(t *testing.T) {
+	limit := config.RateLimitConfig{
+		Name:             "test",
+		By:               []string{"__aws_s3_log_lb", "key"},
+		PrefixDepth:      2,
+		RecordsPerSecond: 0.001,
+		BurstRecords:     1,
+		Action:           config.RATE_LIMIT_ACTION_DROP,
+	}
+	ctx := rateLimitContext(t, limit)
+
+	tests := []struct {
+		labels model.LabelSet
+		sent   bool
+	}{
+		{model.LabelSet{"__aws_s3_log_lb": "app", "key": "logs/2024/01/a.log"}, true},
+		// same first two segments of the key
+		{model.LabelSet{"__aws_s3_log_lb": "app", "key": "logs/2024/02/b.log"}, false},
+		{model.LabelSet{"__aws_s3_log_lb": "app", "key": "logs/2025/01/a.log"}, true},
+		{model.LabelSet{"__aws_s3_log_lb": "other", "key": "logs/2024/01/a.log"}, true},
+		// shorter than the prefix depth
+		{model.LabelSet{"__aws_s3_log_lb": "app", "key": "logs"}, true},
+		{model.LabelSet{"__aws_s3_log_lb": "app", "key": "logs"}, false},
+		{model.LabelSet{"key": "logs/2024/01/a.log"}, true},
+	}
+
+	for i, tt := range tests {
+		sent, err := applyRateLimits(ctx, LogEntry{Labels: tt.labels}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sent != tt.sent {
+			t.Errorf("record %d %v: sent = %v, want %v", i, tt.labels, sent, tt.sent)
+		}
+	}
+
+	if len(limiter.buckets) != 5 {
+		t.Errorf("%d buckets, want 5", len(limiter.buckets))
+	}
+}
@@ -0,0 +1,228 @@
+package otelclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"google.golang.org/grpc/credentials"
+
+	"oteltail/internal/config"
+	"oteltail/internal/telemetry/sdklog"
+	"oteltail/internal/telemetry/sdklog/auth"
+	"oteltail/internal/telemetry/sdklog/lokipush"
+	"oteltail/internal/telemetry/sdklog/otlploggrpc"
+	"oteltail/internal/telemetry/sdklog/otlploggrpc/transform"
+	"oteltail/internal/telemetry/sdklog/spill"
+)
+
+// destination is a named exporter with its own provider, so that its queue,
+// retries and failures do not affect the other destinations.
+type destination struct {
+	name           string
+	provider       *sdklog.LoggerProvider
+	logger         log.Logger
+	ignoreFailures bool
+	// exporter is the gRPC client of OTLP destinations.
+	exporter *otlploggrpc.Client
+	// spill holds the logs of OTLP destinations when SPILL_ENABLED is set.
+	spill *spill.Exporter
+}
+
+// newDestination creates the destination of an EXPORTERS entry.
+func newDestination(ctx context.Context, resources *resource.Resource, cfg config.ExporterConfig) (*destination, error) {
+	var (
+		d   *destination
+		err error
+	)
+
+	switch cfg.Type {
+	case config.EXPORTER_TYPE_LOKI:
+		var lp *sdklog.LoggerProvider
+		lp, err = newLokiProvider(ctx, resources, cfg)
+		d = &destination{name: cfg.Name, provider: lp}
+	default:
+		d, err = newOTLPExporterDestination(ctx, resources, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.logger = d.provider.Logger("log/slog")
+	d.ignoreFailures = cfg.IgnoreFailures
+
+	return d, nil
+}
+
+// newOTLPExporterDestination creates the destination of an OTLP exporter.
+// The OTEL_EXPORTER_OTLP_* variables only configure the default destination.
+func newOTLPExporterDestination(ctx context.Context, resources *resource.Resource, cfg config.ExporterConfig) (*destination, error) {
+	opts := []otlploggrpc.Option{
+		otlploggrpc.WithoutEnvConfig(),
+		otlploggrpc.WithEndpointURL(cfg.Endpoint),
+	}
+
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Insecure || u.Scheme == "http" {
+		opts = append(opts, otlploggrpc.WithInsecure())
+	} else {
+		tlsCfg, err := exporterTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, otlploggrpc.WithTLSCredentials(credentials.NewTLS(tlsCfg)))
+	}
+
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlploggrpc.WithHeaders(cfg.Headers))
+	}
+
+	if cfg.Auth != nil {
+		creds, err := newExporterCredentials(ctx, nil, *cfg.Auth)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range creds {
+			opts = append(opts, otlploggrpc.WithPerRPCCredentials(c))
+		}
+	}
+
+	if cfg.Timeout > 0 {
+		opts = append(opts, otlploggrpc.WithTimeout(cfg.Timeout))
+	}
+
+	compression := cfg.Compression
+	if compression == "" {
+		compression = config.GetConfig(ctx).OtelCompression
+	}
+	if compression != "" {
+		opts = append(opts, otlploggrpc.WithCompressor(compression))
+	}
+
+	if cfg.Retry != nil {
+		retry := otlploggrpc.DefaultRetryConfig
+		retry.Enabled = !cfg.Retry.Disabled
+		if cfg.Retry.InitialInterval > 0 {
+			retry.InitialInterval = cfg.Retry.InitialInterval
+		}
+		if cfg.Retry.MaxInterval > 0 {
+			retry.MaxInterval = cfg.Retry.MaxInterval
+		}
+		if cfg.Retry.MaxElapsedTime > 0 {
+			retry.MaxElapsedTime = cfg.Retry.MaxElapsedTime
+		}
+		opts = append(opts, otlploggrpc.WithRetry(retry))
+	}
+
+	return newOTLPDestination(ctx, cfg.Name, resources, filepath.Join(config.GetConfig(ctx).SpillDir, cfg.Name), opts...)
+}
+
+// newLokiProvider creates the provider of a Loki push exporter. Its logs are
+// not spilled to disk, the spill stores OTLP requests.
+func newLokiProvider(ctx context.Context, resources *resource.Resource, cfg config.ExporterConfig) (*sdklog.LoggerProvider, error) {
+	tlsCfg, err := exporterTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+	if cfg.Insecure {
+		transport.TLSClientConfig.InsecureSkipVerify = true
+	}
+
+	var a config.AuthConfig
+	if cfg.Auth != nil {
+		a = *cfg.Auth
+	}
+	creds, err := newExporterCredentials(ctx, cfg.Headers, a)
+	if err != nil {
+		return nil, err
+	}
+
+	var rt http.RoundTripper = transport
+	if len(creds) > 0 {
+		rt = auth.Transport(rt, creds...)
+	}
+
+	opts := []lokipush.Option{
+		lokipush.WithTransport(rt),
+		lokipush.WithTenantID(cfg.TenantID),
+	}
+	if cfg.Username != "" {
+		opts = append(opts, lokipush.WithBasicAuth(cfg.Username, cfg.Password))
+	}
+	if cfg.Timeout > 0 {
+		opts = append(opts, lokipush.WithTimeout(cfg.Timeout))
+	}
+	if config.GetConfig(ctx).ExportErrorPolicy == EXPORT_ERROR_POLICY_DEADLETTER {
+		sink, err := DeadLetterSink(ctx)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, lokipush.WithRejected(func(ctx context.Context, logs []*sdklog.LogData, err error) error {
+			return writeDeadLetters(ctx, sink, cfg.Name, transform.Logs(logs), err)
+		}))
+	}
+
+	return newBatchProvider(ctx, resources, lokipush.New(cfg.Endpoint, opts...), false), nil
+}
+
+// exporterTLSConfig loads the CA and client certificate of an exporter.
+func exporterTLSConfig(cfg config.ExporterConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.RootCAs = x509.NewCertPool()
+		if !tlsCfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", cfg.CAFile)
+		}
+	}
+
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+// route returns the loggers of the destinations of the records with the
+// given labels, those of the first matching route or the default
+// destination.
+func (c *OtelClient) route(labels model.LabelSet) []log.Logger {
+	for _, r := range c.routes {
+		if !r.Matches(labels) {
+			continue
+		}
+
+		loggers := make([]log.Logger, 0, len(r.Exporters))
+		for _, name := range r.Exporters {
+			loggers = append(loggers, c.destinations[name].logger)
+		}
+		return loggers
+	}
+
+	return []log.Logger{c.Logger}
+}
@@ -0,0 +1,150 @@
+package otelclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+
+	"oteltail/internal/config"
+)
+
+func TestNewDestinationAuth(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	authorization := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization <- r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{})
+	ctx = config.WithConfig(ctx, &config.Configuration{
+		LogBatchSize:  100,
+		LogBatchBytes: 1 << 20,
+	})
+
+	d, err := newDestination(ctx, resource.Empty(), config.ExporterConfig{
+		Name:     "loki",
+		Type:     config.EXPORTER_TYPE_LOKI,
+		Endpoint: srv.URL,
+		Auth: &config.AuthConfig{
+			Type:      "bearer_file",
+			TokenFile: tokenFile,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rec log.Record
+	rec.SetBody(log.StringValue("line"))
+	rec.AddAttributes(log.String("__aws_log_type", "cloudwatch"))
+	d.logger.Emit(ctx, rec)
+
+	if err := d.provider.ForceFlush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := <-authorization; got != "Bearer secret" {
+		t.Errorf("Authorization = %q, want %q", got, "Bearer secret")
+	}
+}
+
+func TestLokiRejectedDeadLettered(t *testing.T) {
+	useDeadLetterSink(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "entry too far behind", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "deadletter.jsonl")
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{})
+	ctx = config.WithConfig(ctx, &config.Configuration{
+		LogBatchSize:      100,
+		LogBatchBytes:     1 << 20,
+		ExportErrorPolicy: EXPORT_ERROR_POLICY_DEADLETTER,
+		DeadLetterURL:     "file://" + path,
+	})
+
+	d, err := newDestination(ctx, resource.Empty(), config.ExporterConfig{
+		Name:     "loki",
+		Type:     config.EXPORTER_TYPE_LOKI,
+		Endpoint: srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rec log.Record
+	rec.SetBody(log.StringValue("line"))
+	rec.AddAttributes(log.String("__aws_log_type", "cloudwatch"))
+	d.logger.Emit(ctx, rec)
+
+	if err := d.provider.ForceFlush(ctx); err != nil {
+		t.Fatalf("ForceFlush = %v, want the rejected logs dead-lettered", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `"source":"exporter:loki"`) || !strings.Contains(string(content), `"line":"line"`) {
+		t.Errorf("dead letters = %s, want the rejected record", content)
+	}
+}
+
+func TestDebugExporterEveryDestination(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "debug.json")
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{})
+	ctx = config.WithConfig(ctx, &config.Configuration{
+		LogBatchSize:      100,
+		LogBatchBytes:     1 << 20,
+		DebugExporter:     "file",
+		DebugExporterPath: path,
+		Exporters: []config.ExporterConfig{{
+			Name:     "loki",
+			Type:     config.EXPORTER_TYPE_LOKI,
+			Endpoint: srv.URL,
+		}},
+		Routes: []config.RouteConfig{{Exporters: []string{"loki"}}},
+	})
+
+	c, err := NewOtelClient(ctx, &OtelClientConfig{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rec log.Record
+	rec.SetBody(log.StringValue("line"))
+	rec.AddAttributes(log.String("__aws_log_type", "cloudwatch"))
+	for _, l := range c.route(model.LabelSet{"__aws_log_type": "cloudwatch"}) {
+		l.Emit(ctx, rec)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `"stringValue":"line"`) {
+		t.Errorf("debug output = %s, want the record routed to loki", content)
+	}
+}
@@ -0,0 +1,177 @@
+package otelclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/log"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"oteltail/internal/config"
+	"oteltail/internal/deadletter"
+	"oteltail/internal/logger"
+	"oteltail/internal/telemetry/sdklog"
+	"oteltail/internal/utils"
+)
+
+const (
+	// LOG_OVERSIZE_TRUNCATE cuts oversized records, keeping their original size
+	// in the original_size attribute.
+	LOG_OVERSIZE_TRUNCATE = "truncate"
+	// LOG_OVERSIZE_SPLIT sends oversized records as several records, marked
+	// with the split_index and split_count attributes.
+	LOG_OVERSIZE_SPLIT = "split"
+)
+
+// errOversized is the dead-letter error of the records fitEntry drops.
+const errOversized = "labels and attributes over LOG_MAX_RECORD_BYTES"
+
+// oversizedCounts counts the records dropped by fitEntry since the previous
+// report.
+var oversizedCounts struct {
+	mu      sync.Mutex
+	dropped int
+	since   time.Time
+}
+
+// splitAttributesSize is reserved for the attributes added to the records
+// cut by fitEntry.
+const splitAttributesSize = 64
+
+// entrySize approximates the protobuf encoded size of the record the entry
+// is sent as.
+func entrySize(e LogEntry) int {
+	size := sdklog.RecordOverhead
+
+	if e.Body.Empty() {
+		size += len(e.Entry.Line) + 2
+	} else {
+		size += sdklog.ValueSize(e.Body)
+	}
+	size += len(e.SeverityText)
+
+	for name, value := range e.Labels {
+		size += len(name) + len(value) + 4
+	}
+	for _, kv := range e.Attributes {
+		size += sdklog.KeyValueSize(kv)
+	}
+
+	return size
+}
+
+// fitEntry returns the entry as records of at most LOG_MAX_RECORD_BYTES,
+// applying LOG_OVERSIZE_ACTION to oversized entries. A structured body is
+// replaced by the raw line before the line is cut. It returns no record if
+// the labels and attributes alone are over the limit, see dropOversized.
+func fitEntry(cfg *config.Configuration, e LogEntry) []LogEntry {
+	size := entrySize(e)
+	if size <= cfg.LogMaxRecordBytes {
+		return []LogEntry{e}
+	}
+
+	if !e.Body.Empty() {
+		e.Body = log.Value{}
+		if size = entrySize(e); size <= cfg.LogMaxRecordBytes {
+			return []LogEntry{e}
+		}
+	}
+
+	line := e.Entry.Line
+	budget := len(line) - (size - cfg.LogMaxRecordBytes) - splitAttributesSize
+	if budget <= 0 {
+		return nil
+	}
+
+	// copy the attributes, they are shared by the records of the source
+	attrs := e.Attributes[:len(e.Attributes):len(e.Attributes)]
+
+	if cfg.LogOversizeAction != LOG_OVERSIZE_SPLIT {
+		e.Entry.Line = line[:utils.UTF8Cut(line, budget)]
+		e.Attributes = append(attrs, log.Int("original_size", len(line)))
+		return []LogEntry{e}
+	}
+
+	var parts []string
+	for len(line) > 0 {
+		n := utils.UTF8Cut(line, budget)
+		parts = append(parts, line[:n])
+		line = line[n:]
+	}
+
+	entries := make([]LogEntry, 0, len(parts))
+	for i, part := range parts {
+		entry := e
+		entry.Entry.Line = part
+		entry.Attributes = append(attrs, log.Int("split_index", i), log.Int("split_count", len(parts)))
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// dropOversized counts an entry fitEntry returned no record for. The
+// collector would reject it, it is dead-lettered with the
+// EXPORT_ERROR_POLICY deadletter.
+func dropOversized(ctx context.Context, e LogEntry) error {
+	oversizedCounts.mu.Lock()
+	if oversizedCounts.dropped == 0 {
+		oversizedCounts.since = time.Now()
+	}
+	oversizedCounts.dropped++
+	oversizedCounts.mu.Unlock()
+
+	if config.GetConfig(ctx).ExportErrorPolicy != EXPORT_ERROR_POLICY_DEADLETTER {
+		return nil
+	}
+
+	sink, err := DeadLetterSink(ctx)
+	if err != nil {
+		return err
+	}
+
+	labels := make(map[string]string, len(e.Labels))
+	for name, value := range e.Labels {
+		labels[string(name)] = string(value)
+	}
+
+	return sink.Write(ctx, []deadletter.Record{{
+		Source: "oversized",
+		Line:   e.Entry.Line,
+		Error:  errOversized,
+		Labels: labels,
+		Time:   time.Now(),
+	}})
+}
+
+// reportOversized logs the records dropped by fitEntry since the previous
+// report. It returns them as the oteltail.oversized_records counter, or nil
+// if none was dropped.
+func reportOversized(ctx context.Context) *metricpb.Metric {
+	oversizedCounts.mu.Lock()
+	dropped, since := oversizedCounts.dropped, oversizedCounts.since
+	oversizedCounts.dropped = 0
+	oversizedCounts.mu.Unlock()
+
+	if dropped == 0 {
+		return nil
+	}
+
+	logger.GetLogger(ctx).WarnContext(ctx, "dropped records over LOG_MAX_RECORD_BYTES", "count", dropped)
+
+	return &metricpb.Metric{
+		Name:        "oteltail.oversized_records",
+		Description: "Records dropped because their labels and attributes are over LOG_MAX_RECORD_BYTES",
+		Unit:        "{record}",
+		Data: &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+			AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			IsMonotonic:            true,
+			DataPoints: []*metricpb.NumberDataPoint{{
+				StartTimeUnixNano: uint64(since.UnixNano()),
+				TimeUnixNano:      uint64(time.Now().UnixNano()),
+				Value:             &metricpb.NumberDataPoint_AsInt{AsInt: int64(dropped)},
+			}},
+		}},
+	}
+}
@@ -0,0 +1,160 @@
+package otelclient
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/log"
+
+	"oteltail/internal/config"
+)
+
+// attribute returns the integer attribute key of the entry.
+func attribute(e LogEntry, key string) (int64, bool) {
+	for _, kv := range e.Attributes {
+		if kv.Key == key {
+			return kv.Value.AsInt64(), true
+		}
+	}
+	return 0, false
+}
+
+func TestFitEntry(t *testing.T) {
+	labels := model.LabelSet{"__aws_log_type": "s3_lb"}
+
+	tests := []struct {
+		name   string
+		action string
+		line   string
+		body   log.Value
+		parts  int
+	}{
+		{"fits", LOG_OVERSIZE_TRUNCATE, "line", log.Value{}, 1},
+		{"structured body dropped", LOG_OVERSIZE_TRUNCATE, "line", log.StringValue(strings.Repeat("b", 1000)), 1},
+		{"truncate", LOG_OVERSIZE_TRUNCATE, strings.Repeat("a", 1000), log.Value{}, 1},
+		{"truncate utf-8", LOG_OVERSIZE_TRUNCATE, strings.Repeat("é€😀", 100), log.Value{}, 1},
+		{"split", LOG_OVERSIZE_SPLIT, strings.Repeat("a", 1000), log.Value{}, 10},
+		{"split utf-8", LOG_OVERSIZE_SPLIT, strings.Repeat("é€😀", 100), log.Value{}, 9},
+	}
+
+	cfg := &config.Configuration{LogMaxRecordBytes: 256}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.LogOversizeAction = tt.action
+			e := LogEntry{Labels: labels, Body: tt.body, Entry: logproto.Entry{Line: tt.line}}
+
+			entries := fitEntry(cfg, e)
+			if len(entries) != tt.parts {
+				t.Fatalf("%d records, want %d", len(entries), tt.parts)
+			}
+
+			var line strings.Builder
+			for i, entry := range entries {
+				if size := entrySize(entry); size > cfg.LogMaxRecordBytes {
+					t.Errorf("record %d is %d bytes, over the limit", i, size)
+				}
+				if !utf8.ValidString(entry.Entry.Line) {
+					t.Errorf("record %d is cut within a rune: %q", i, entry.Entry.Line)
+				}
+				line.WriteString(entry.Entry.Line)
+
+				if tt.action == LOG_OVERSIZE_SPLIT {
+					index, _ := attribute(entry, "split_index")
+					count, _ := attribute(entry, "split_count")
+					if index != int64(i) || count != int64(len(entries)) {
+						t.Errorf("record %d: split %d of %d", i, index, count)
+					}
+				}
+			}
+
+			switch {
+			case len(entries) > 1:
+				if line.String() != tt.line {
+					t.Errorf("split records do not add up to the line")
+				}
+			case entrySize(e) > cfg.LogMaxRecordBytes && tt.body.Empty():
+				if !strings.HasPrefix(tt.line, line.String()) {
+					t.Errorf("line = %q, want a prefix of the original", line.String())
+				}
+				if size, _ := attribute(entries[0], "original_size"); size != int64(len(tt.line)) {
+					t.Errorf("original_size = %d, want %d", size, len(tt.line))
+				}
+			default:
+				if line.String() != tt.line {
+					t.Errorf("line = %q, want it unchanged", line.String())
+				}
+			}
+
+			// the attributes of the source are not modified
+			if len(e.Attributes) != 0 {
+				t.Errorf("source attributes = %v", e.Attributes)
+			}
+		})
+	}
+}
+
+// useDeadLetterSink makes DeadLetterSink create the sink of the
+// configuration of the test.
+func useDeadLetterSink(t *testing.T) {
+	t.Helper()
+
+	reset := func() {
+		deadLetterSinkOnce = sync.Once{}
+		deadLetterSink, deadLetterSinkErr = nil, nil
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestDropOversized(t *testing.T) {
+	useDeadLetterSink(t)
+	reportOversized(context.Background())
+
+	path := filepath.Join(t.TempDir(), "deadletter.jsonl")
+	ctx := config.WithConfig(context.Background(), &config.Configuration{
+		LogBatchSize:      100,
+		LogBatchBytes:     1 << 20,
+		LogMaxRecordBytes: 256,
+		ExportErrorPolicy: EXPORT_ERROR_POLICY_DEADLETTER,
+		DeadLetterURL:     "file://" + path,
+	})
+
+	b, _ := NewBatch(ctx, nil)
+	err := b.Add(ctx, LogEntry{
+		Labels: model.LabelSet{"__aws_log_type": "s3_lb", "key": model.LabelValue(strings.Repeat("k", 300))},
+		Entry:  logproto.Entry{Line: "line"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.LineCount != 0 {
+		t.Errorf("batch has %d records, want the oversized record dropped", b.LineCount)
+	}
+	if entries := fitEntry(config.GetConfig(ctx), LogEntry{Labels: model.LabelSet{"key": model.LabelValue(strings.Repeat("k", 300))}}); entries != nil {
+		t.Errorf("fitEntry = %v, want no record", entries)
+	}
+
+	m := reportOversized(ctx)
+	if m == nil || m.GetSum().DataPoints[0].GetAsInt() != 1 {
+		t.Errorf("oversized = %v, want 1 record", m)
+	}
+	if m := reportOversized(ctx); m != nil {
+		t.Errorf("oversized = %v after the report, want nil", m)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `"source":"oversized"`) || !strings.Contains(string(content), `"line":"line"`) {
+		t.Errorf("dead letters = %s, want the oversized record", content)
+	}
+}
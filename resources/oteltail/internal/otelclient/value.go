@@ -0,0 +1,53 @@
+package otelclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"go.opentelemetry.io/otel/log"
+)
+
+// JSONValue converts a decoded json document into a structured log value.
+// Numbers are expected to be decoded as json.Number, objects become maps with
+// their keys sorted.
+func JSONValue(v any) log.Value {
+	switch value := v.(type) {
+	case nil:
+		return log.Value{}
+	case string:
+		return log.StringValue(value)
+	case bool:
+		return log.BoolValue(value)
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return log.Int64Value(i)
+		}
+		if f, err := value.Float64(); err == nil {
+			return log.Float64Value(f)
+		}
+		return log.StringValue(value.String())
+	case float64:
+		return log.Float64Value(value)
+	case []any:
+		values := make([]log.Value, 0, len(value))
+		for _, item := range value {
+			values = append(values, JSONValue(item))
+		}
+		return log.SliceValue(values...)
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		kvs := make([]log.KeyValue, 0, len(value))
+		for _, key := range keys {
+			kvs = append(kvs, log.KeyValue{Key: key, Value: JSONValue(value[key])})
+		}
+		return log.MapValue(kvs...)
+	default:
+		return log.StringValue(fmt.Sprint(value))
+	}
+}
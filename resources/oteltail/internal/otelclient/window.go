@@ -0,0 +1,94 @@
+package otelclient
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/log"
+
+	"oteltail/internal/config"
+)
+
+const (
+	// TIMESTAMP_WINDOW_CLAMP moves the timestamp to the closest edge of the
+	// window, or to the latest timestamp of the stream when out of order.
+	TIMESTAMP_WINDOW_CLAMP = "clamp"
+	// TIMESTAMP_WINDOW_TAG keeps the timestamp and marks the record.
+	TIMESTAMP_WINDOW_TAG = "tag"
+	// TIMESTAMP_WINDOW_DROP drops the record.
+	TIMESTAMP_WINDOW_DROP = "drop"
+)
+
+// Attributes of the records whose timestamp is outside of the window or out
+// of order.
+const (
+	attrOriginalTimestamp    = "oteltail.original_timestamp"
+	attrTimestampOutOfWindow = "oteltail.timestamp_out_of_window"
+	attrTimestampOutOfOrder  = "oteltail.timestamp_out_of_order"
+)
+
+// applyTimestampWindow checks the timestamp of a record against the window
+// accepted around observed, TIMESTAMP_MAX_AGE before and TIMESTAMP_MAX_FUTURE
+// after it, then, with TIMESTAMP_OUT_OF_ORDER, against last, the latest
+// timestamp sent in the stream of the record. Records outside the window are
+// marked with oteltail.timestamp_out_of_window, whose value is either past
+// or future, and records older than last with
+// oteltail.timestamp_out_of_order. Marked records keep their original
+// timestamp in the oteltail.original_timestamp attribute. It reports whether
+// the record must be sent, and advances last.
+func applyTimestampWindow(ctx context.Context, rec *log.Record, observed time.Time, last *time.Time) bool {
+	cfg := config.GetConfig(ctx)
+
+	original := rec.Timestamp()
+	timestamp := original
+
+	var attrs []log.KeyValue
+
+	if edge, direction, ok := outOfWindow(cfg, timestamp, observed); ok {
+		switch cfg.TimestampOutOfWindow {
+		case TIMESTAMP_WINDOW_DROP:
+			return false
+		case TIMESTAMP_WINDOW_CLAMP:
+			timestamp = edge
+		default:
+			// a tagged record keeps its timestamp, it must not hold back the
+			// records which follow it
+			last = nil
+		}
+		attrs = append(attrs, log.String(attrTimestampOutOfWindow, direction))
+	}
+
+	if cfg.TimestampOutOfOrder != "" && last != nil && timestamp.Before(*last) {
+		switch cfg.TimestampOutOfOrder {
+		case TIMESTAMP_WINDOW_DROP:
+			return false
+		case TIMESTAMP_WINDOW_CLAMP:
+			timestamp = *last
+		}
+		attrs = append(attrs, log.Bool(attrTimestampOutOfOrder, true))
+	}
+
+	if len(attrs) > 0 {
+		rec.SetTimestamp(timestamp)
+		rec.AddAttributes(append(attrs, log.String(attrOriginalTimestamp, original.Format(time.RFC3339Nano)))...)
+	}
+
+	if last != nil && timestamp.After(*last) {
+		*last = timestamp
+	}
+
+	return true
+}
+
+// outOfWindow returns the edge of the window the timestamp is beyond and its
+// direction, past or future.
+func outOfWindow(cfg *config.Configuration, timestamp time.Time, observed time.Time) (time.Time, string, bool) {
+	switch {
+	case cfg.TimestampMaxAge > 0 && timestamp.Before(observed.Add(-cfg.TimestampMaxAge)):
+		return observed.Add(-cfg.TimestampMaxAge), "past", true
+	case cfg.TimestampMaxFuture > 0 && timestamp.After(observed.Add(cfg.TimestampMaxFuture)):
+		return observed.Add(cfg.TimestampMaxFuture), "future", true
+	default:
+		return time.Time{}, "", false
+	}
+}
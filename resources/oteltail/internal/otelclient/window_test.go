@@ -0,0 +1,150 @@
+package otelclient
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/log"
+
+	"oteltail/internal/config"
+)
+
+func TestApplyTimestampWindow(t *testing.T) {
+	observed := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	type record struct {
+		timestamp time.Time
+		// want is the timestamp sent, zero if the record is dropped.
+		want  time.Time
+		attrs map[string]string
+	}
+
+	tests := []struct {
+		name       string
+		outOfOrder string
+		window     string
+		records    []record
+	}{
+		{
+			name:   "in window and order",
+			window: TIMESTAMP_WINDOW_CLAMP,
+			records: []record{
+				{timestamp: observed.Add(-time.Minute), want: observed.Add(-time.Minute)},
+				{timestamp: observed, want: observed},
+			},
+		},
+		{
+			name:   "clamped to the window",
+			window: TIMESTAMP_WINDOW_CLAMP,
+			records: []record{
+				{timestamp: observed.Add(-48 * time.Hour), want: observed.Add(-24 * time.Hour), attrs: map[string]string{
+					attrTimestampOutOfWindow: "past",
+					attrOriginalTimestamp:    observed.Add(-48 * time.Hour).Format(time.RFC3339Nano),
+				}},
+				{timestamp: observed.Add(time.Hour), want: observed.Add(10 * time.Minute), attrs: map[string]string{
+					attrTimestampOutOfWindow: "future",
+					attrOriginalTimestamp:    observed.Add(time.Hour).Format(time.RFC3339Nano),
+				}},
+			},
+		},
+		{
+			name:   "dropped out of window",
+			window: TIMESTAMP_WINDOW_DROP,
+			records: []record{
+				{timestamp: observed.Add(time.Hour)},
+			},
+		},
+		{
+			name:   "out of order ignored by default",
+			window: TIMESTAMP_WINDOW_CLAMP,
+			records: []record{
+				{timestamp: observed, want: observed},
+				{timestamp: observed.Add(-time.Minute), want: observed.Add(-time.Minute)},
+			},
+		},
+		{
+			name:       "clamped to the stream order",
+			window:     TIMESTAMP_WINDOW_CLAMP,
+			outOfOrder: TIMESTAMP_WINDOW_CLAMP,
+			records: []record{
+				{timestamp: observed, want: observed},
+				{timestamp: observed.Add(-time.Minute), want: observed, attrs: map[string]string{
+					attrTimestampOutOfOrder: "true",
+					attrOriginalTimestamp:   observed.Add(-time.Minute).Format(time.RFC3339Nano),
+				}},
+				{timestamp: observed.Add(time.Second), want: observed.Add(time.Second)},
+			},
+		},
+		{
+			name:       "dropped out of order",
+			window:     TIMESTAMP_WINDOW_CLAMP,
+			outOfOrder: TIMESTAMP_WINDOW_DROP,
+			records: []record{
+				{timestamp: observed, want: observed},
+				{timestamp: observed.Add(-time.Minute)},
+				{timestamp: observed.Add(time.Second), want: observed.Add(time.Second)},
+			},
+		},
+		{
+			name:       "tagged out of window does not hold back the stream",
+			window:     TIMESTAMP_WINDOW_TAG,
+			outOfOrder: TIMESTAMP_WINDOW_CLAMP,
+			records: []record{
+				{timestamp: observed.Add(time.Hour), want: observed.Add(time.Hour), attrs: map[string]string{
+					attrTimestampOutOfWindow: "future",
+					attrOriginalTimestamp:    observed.Add(time.Hour).Format(time.RFC3339Nano),
+				}},
+				{timestamp: observed, want: observed},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := config.WithConfig(context.Background(), &config.Configuration{
+				TimestampMaxAge:      24 * time.Hour,
+				TimestampMaxFuture:   10 * time.Minute,
+				TimestampOutOfWindow: tt.window,
+				TimestampOutOfOrder:  tt.outOfOrder,
+			})
+
+			var last time.Time
+			for i, r := range tt.records {
+				var rec log.Record
+				rec.SetTimestamp(r.timestamp)
+
+				sent := applyTimestampWindow(ctx, &rec, observed, &last)
+				if sent != !r.want.IsZero() {
+					t.Fatalf("record %d: sent = %v, want %v", i, sent, !r.want.IsZero())
+				}
+				if !sent {
+					continue
+				}
+
+				if !rec.Timestamp().Equal(r.want) {
+					t.Errorf("record %d: timestamp = %v, want %v", i, rec.Timestamp(), r.want)
+				}
+
+				attrs := map[string]string{}
+				rec.WalkAttributes(func(kv log.KeyValue) bool {
+					if kv.Value.Kind() == log.KindBool {
+						attrs[kv.Key] = strconv.FormatBool(kv.Value.AsBool())
+					} else {
+						attrs[kv.Key] = kv.Value.AsString()
+					}
+					return true
+				})
+				if len(attrs) != len(r.attrs) {
+					t.Errorf("record %d: attributes = %v, want %v", i, attrs, r.attrs)
+				}
+				for k, v := range r.attrs {
+					if attrs[k] != v {
+						t.Errorf("record %d: %s = %q, want %q", i, k, attrs[k], v)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,401 @@
+package promtail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+
+	"oteltail/internal/config"
+	"oteltail/internal/otelclient"
+	"oteltail/internal/utils"
+)
+
+const (
+	// PARSE_BODY_JSON parses the lines holding a JSON object.
+	PARSE_BODY_JSON = "json"
+	// PARSE_BODY_LOGFMT parses the lines made of key=value pairs.
+	PARSE_BODY_LOGFMT = "logfmt"
+	// PARSE_BODY_AUTO tries JSON, then logfmt.
+	PARSE_BODY_AUTO = "auto"
+)
+
+// parseBody applies PARSE_BODY to the entries of the PARSE_BODY_LOG_TYPES.
+// When the line is structured, the PARSE_BODY_PROMOTE_KEYS become attributes,
+// the timestamp, level, trace ID and message are read from their configured
+// keys and the remaining keys become a map body, with the message under the
+// message key. The message alone becomes a string body.
+// PARSE_BODY_MAX_ATTRIBUTES bounds the number of keys kept and
+// PARSE_BODY_MAX_DEPTH the nesting of the body, deeper values are kept as JSON
+// strings. Other lines are left untouched.
+func parseBody(ctx context.Context, e otelclient.LogEntry) otelclient.LogEntry {
+	return parseBodyTimestamp(ctx, e, true)
+}
+
+// parseS3Body is parseBody for the records an S3 parser read the timestamp
+// of, from the given source. The timestamp read from the record is kept and
+// the timestamp keys are left in the body. The date of the object and the
+// observed time are only fallbacks, a body timestamp replaces them.
+func parseS3Body(ctx context.Context, e otelclient.LogEntry, source string) otelclient.LogEntry {
+	if source != timestampSourceS3Key && source != timestampSourceObserved {
+		return parseBodyTimestamp(ctx, e, false)
+	}
+
+	fallback := e.Entry.Timestamp
+	e = parseBodyTimestamp(ctx, e, true)
+	if !e.Entry.Timestamp.Equal(fallback) {
+		e.Attributes = withTimestampSource(withoutTimestampSource(e.Attributes), timestampSourceBody)
+	}
+
+	return e
+}
+
+func parseBodyTimestamp(ctx context.Context, e otelclient.LogEntry, readTimestamp bool) otelclient.LogEntry {
+	cfg := config.GetConfig(ctx)
+
+	if cfg.ParseBody == "" || !slices.Contains(cfg.ParseBodyLogTypes, string(e.Labels[model.LabelName("__aws_log_type")])) {
+		return e
+	}
+
+	doc, ok := decodeBody(cfg.ParseBody, e.Entry.Line)
+	if !ok {
+		return e
+	}
+
+	keys := bodyKeys{
+		level:   cfg.ParseBodyLevelKeys,
+		traceID: cfg.ParseBodyTraceIDKeys,
+		message: cfg.ParseBodyMessageKeys,
+	}
+	if readTimestamp {
+		keys.timestamp = cfg.ParseBodyTimestampKeys
+	}
+
+	return structuredBody(cfg, e, doc, keys)
+}
+
+// bodyKeys are the keys the well known values of a structured line are read
+// from, in order of preference.
+type bodyKeys struct {
+	timestamp []string
+	level     []string
+	traceID   []string
+	message   []string
+}
+
+// structuredBody sets the entry timestamp, level, trace ID, attributes and
+// body from the decoded line, see parseBody.
+func structuredBody(cfg *config.Configuration, e otelclient.LogEntry, doc map[string]any, keys bodyKeys) otelclient.LogEntry {
+	if parent, key, value, ok := lookupKey(doc, keys.timestamp); ok {
+		if timestamp, ok := bodyTimestamp(value); ok {
+			e.Entry.Timestamp = timestamp
+			delete(parent, key)
+		}
+	}
+
+	if parent, key, value, ok := lookupKey(doc, keys.level); ok {
+		e.SeverityText = fmt.Sprint(value)
+		e.Severity = severityOf(e.SeverityText)
+		delete(parent, key)
+	}
+
+	if parent, key, value, ok := lookupKey(doc, keys.traceID); ok {
+		if id, ok := bodyTraceID(fmt.Sprint(value)); ok {
+			e.TraceID = id
+			delete(parent, key)
+		}
+	}
+
+	message, hasMessage := "", false
+	if parent, key, value, ok := lookupKey(doc, keys.message); ok {
+		message, hasMessage = fmt.Sprint(value), true
+		delete(parent, key)
+	}
+
+	limits := bodyLimits{
+		keys:     cfg.ParseBodyMaxAttributes,
+		maxDepth: cfg.ParseBodyMaxDepth,
+	}
+
+	// the attributes are shared by the entries of an object
+	attrs := e.Attributes[:len(e.Attributes):len(e.Attributes)]
+	for _, name := range cfg.ParseBodyPromoteKeys {
+		parent, key, value, ok := lookupKey(doc, []string{name})
+		if !ok {
+			continue
+		}
+		delete(parent, key)
+
+		if !limits.take() {
+			continue
+		}
+		attrs = append(attrs, log.KeyValue{Key: name, Value: limits.value(value, 1)})
+	}
+
+	if len(doc) == 0 && hasMessage {
+		e.Body = log.StringValue(message)
+	} else {
+		// the message is kept whatever the limits
+		body := limits.value(doc, 0).AsMap()
+		if hasMessage {
+			body = append([]log.KeyValue{log.String("message", message)}, body...)
+		}
+		e.Body = log.MapValue(body...)
+	}
+
+	if limits.dropped > 0 {
+		attrs = append(attrs, log.Int("parse_dropped_keys", limits.dropped))
+	}
+	e.Attributes = attrs
+
+	return e
+}
+
+// decodeBody decodes the line as an object in the given format.
+func decodeBody(format string, line string) (map[string]any, bool) {
+	switch format {
+	case PARSE_BODY_JSON:
+		return decodeJSONBody(line)
+	case PARSE_BODY_LOGFMT:
+		return decodeLogfmt(line)
+	default:
+		if doc, ok := decodeJSONBody(line); ok {
+			return doc, true
+		}
+		return decodeLogfmt(line)
+	}
+}
+
+func decodeJSONBody(line string) (map[string]any, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return nil, false
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+
+	var doc map[string]any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, false
+	}
+	// the line must hold a single object
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, false
+	}
+
+	return doc, true
+}
+
+// decodeLogfmt decodes a line made of key=value pairs separated by spaces,
+// values may be quoted. Lines with any other token are not logfmt.
+func decodeLogfmt(line string) (map[string]any, bool) {
+	doc := make(map[string]any)
+
+	s := strings.TrimSpace(line)
+	for len(s) > 0 {
+		eq := strings.IndexAny(s, "= \t\"")
+		if eq <= 0 || s[eq] != '=' {
+			return nil, false
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, false
+			}
+
+			unquoted, err := strconv.Unquote(s[:end+1])
+			if err != nil {
+				return nil, false
+			}
+			value, s = unquoted, s[end+1:]
+		} else {
+			end := strings.IndexAny(s, " \t")
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+
+		if len(s) > 0 && s[0] != ' ' && s[0] != '\t' {
+			return nil, false
+		}
+		s = strings.TrimLeft(s, " \t")
+
+		doc[key] = value
+	}
+
+	return doc, len(doc) > 0
+}
+
+// lookupKey returns the value of the first of keys found in doc, with the
+// object holding it. A key is looked up as is, then as a dot-separated path.
+func lookupKey(doc map[string]any, keys []string) (map[string]any, string, any, bool) {
+	for _, key := range keys {
+		if value, ok := doc[key]; ok {
+			return doc, key, value, true
+		}
+
+		parts := strings.Split(key, ".")
+		if len(parts) == 1 {
+			continue
+		}
+
+		parent := doc
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := parent[part].(map[string]any)
+			if !ok {
+				parent = nil
+				break
+			}
+			parent = child
+		}
+		if parent == nil {
+			continue
+		}
+
+		last := parts[len(parts)-1]
+		if value, ok := parent[last]; ok {
+			return parent, last, value, true
+		}
+	}
+
+	return nil, "", nil, false
+}
+
+// bodyTimestamp reads an RFC3339 timestamp or an epoch, possibly with a
+// fractional part.
+func bodyTimestamp(value any) (time.Time, bool) {
+	s := fmt.Sprint(value)
+
+	for _, layout := range rfc3339Layouts {
+		if timestamp, err := time.Parse(layout, s); err == nil {
+			return timestamp, true
+		}
+	}
+
+	if sec, nsec, err := utils.GetUnixSecNsec(s); err == nil && sec > 0 {
+		return time.Unix(sec, nsec).UTC(), true
+	}
+
+	if f, err := strconv.ParseFloat(s, 64); err == nil && f > 0 {
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), true
+	}
+
+	return time.Time{}, false
+}
+
+// bodyTraceID reads a W3C or an X-Ray trace ID.
+func bodyTraceID(s string) (trace.TraceID, bool) {
+	if id, err := trace.TraceIDFromHex(s); err == nil {
+		return id, true
+	}
+	if id, err := utils.ParseTraceID(s); err == nil {
+		return id, true
+	}
+	return trace.TraceID{}, false
+}
+
+// severityOf maps a level name, or a bunyan/pino numeric level, to a
+// severity, 0 if the level is unknown.
+func severityOf(level string) log.Severity {
+	switch strings.ToLower(level) {
+	case "trace", "10":
+		return log.SeverityTrace
+	case "debug", "dbug", "20":
+		return log.SeverityDebug
+	case "info", "information", "notice", "30":
+		return log.SeverityInfo
+	case "warn", "warning", "40":
+		return log.SeverityWarn
+	case "error", "err", "eror", "50":
+		return log.SeverityError
+	case "fatal", "critical", "crit", "panic", "alert", "emerg", "emergency", "60":
+		return log.SeverityFatal
+	default:
+		return 0
+	}
+}
+
+// bodyLimits applies PARSE_BODY_MAX_ATTRIBUTES and PARSE_BODY_MAX_DEPTH.
+type bodyLimits struct {
+	keys     int
+	maxDepth int
+	dropped  int
+}
+
+// take reports whether one more key may be kept.
+func (l *bodyLimits) take() bool {
+	if l.keys <= 0 {
+		l.dropped++
+		return false
+	}
+	l.keys--
+	return true
+}
+
+// value converts a decoded value found at the given depth.
+func (l *bodyLimits) value(v any, depth int) log.Value {
+	switch value := v.(type) {
+	case map[string]any:
+		if depth >= l.maxDepth {
+			return jsonString(value)
+		}
+
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		kvs := make([]log.KeyValue, 0, len(value))
+		for _, key := range keys {
+			if !l.take() {
+				continue
+			}
+			kvs = append(kvs, log.KeyValue{Key: key, Value: l.value(value[key], depth+1)})
+		}
+		return log.MapValue(kvs...)
+	case []any:
+		if depth >= l.maxDepth {
+			return jsonString(value)
+		}
+
+		values := make([]log.Value, 0, len(value))
+		for _, item := range value {
+			values = append(values, l.value(item, depth+1))
+		}
+		return log.SliceValue(values...)
+	default:
+		return otelclient.JSONValue(value)
+	}
+}
+
+func jsonString(v any) log.Value {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return log.StringValue(fmt.Sprint(v))
+	}
+	return log.StringValue(string(data))
+}
@@ -0,0 +1,68 @@
+package promtail
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+
+	"oteltail/internal/config"
+	"oteltail/internal/otelclient"
+)
+
+func TestBodyTimestamp(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  time.Time
+	}{
+		{name: "rfc3339", value: "2024-03-01T12:00:00.5Z", want: time.Date(2024, 3, 1, 12, 0, 0, 5e8, time.UTC)},
+		{name: "seconds", value: json.Number("1709294400"), want: time.Unix(1709294400, 0)},
+		{name: "milliseconds", value: json.Number("1709294400123"), want: time.Unix(1709294400, 123e6)},
+		{name: "fractional seconds", value: json.Number("1709294400.25"), want: time.Unix(1709294400, 25e7)},
+		{name: "float", value: 1709294400.5, want: time.Unix(1709294400, 5e8)},
+		{name: "zero", value: json.Number("0")},
+		{name: "zero float", value: 0.0},
+		{name: "negative", value: json.Number("-1709294400")},
+		{name: "negative fractional", value: json.Number("-1.5")},
+		{name: "not a timestamp", value: "yesterday"},
+		{name: "nil", value: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := bodyTimestamp(tt.value)
+			if ok != !tt.want.IsZero() {
+				t.Fatalf("bodyTimestamp(%v) ok = %v, want %v", tt.value, ok, !tt.want.IsZero())
+			}
+			if ok && !got.Equal(tt.want) {
+				t.Errorf("bodyTimestamp(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBodyInvalidTimestamp(t *testing.T) {
+	ctx := config.WithConfig(context.Background(), &config.Configuration{
+		ParseBody:              PARSE_BODY_JSON,
+		ParseBodyLogTypes:      []string{"cloudwatch"},
+		ParseBodyTimestampKeys: []string{"ts"},
+		ParseBodyMessageKeys:   []string{"msg"},
+		ParseBodyMaxAttributes: 64,
+		ParseBodyMaxDepth:      5,
+	})
+	received := time.Unix(1709294400, 0)
+
+	for _, line := range []string{`{"ts":0,"msg":"x"}`, `{"ts":-1,"msg":"x"}`} {
+		e := parseBody(ctx, otelclient.LogEntry{
+			Labels: model.LabelSet{"__aws_log_type": "cloudwatch"},
+			Entry:  logproto.Entry{Line: line, Timestamp: received},
+		})
+		if !e.Entry.Timestamp.Equal(received) {
+			t.Errorf("%s: timestamp = %v, want the received time %v", line, e.Entry.Timestamp, received)
+		}
+	}
+}
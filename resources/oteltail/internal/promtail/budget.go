@@ -0,0 +1,76 @@
+package promtail
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"oteltail/internal/config"
+)
+
+const (
+	// DEADLINE_ACTION_ERROR fails the invocation when the deadline is reached,
+	// the retried event is processed from the start.
+	DEADLINE_ACTION_ERROR = "error"
+	// DEADLINE_ACTION_CHECKPOINT also fails the invocation but records how far
+	// each S3 object was read, so that a retry on the same execution
+	// environment skips the records already sent.
+	DEADLINE_ACTION_CHECKPOINT = "checkpoint"
+)
+
+// ErrDeadlineReached is returned when the invocation stops reading its input
+// to keep DEADLINE_SAFETY_MARGIN for exporting the records already read. The
+// event was not fully processed and must be retried.
+var ErrDeadlineReached = errors.New("deadline reached before the event was fully processed")
+
+// deadlineReached reports whether the time left before the Lambda deadline is
+// within the safety margin.
+func deadlineReached(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return false
+	}
+
+	return time.Until(deadline) < config.GetConfig(ctx).DeadlineSafetyMargin
+}
+
+// cursor tracks the records read from an S3 object.
+type cursor struct {
+	// key identifies the object in the checkpoint store.
+	key string
+	// skip is the number of records sent by a previous invocation.
+	skip int
+	// read is the number of records read so far.
+	read int
+}
+
+func newCursor(ctx context.Context, key string) *cursor {
+	c := &cursor{key: key}
+
+	if config.GetConfig(ctx).DeadlineAction == DEADLINE_ACTION_CHECKPOINT {
+		c.skip = checkpoints.position(ctx, key)
+	}
+
+	return c
+}
+
+// next is called before reading each record. It reports whether the record
+// must be sent, or ErrDeadlineReached once the reading must stop.
+func (c *cursor) next(ctx context.Context) (bool, error) {
+	if deadlineReached(ctx) {
+		if config.GetConfig(ctx).DeadlineAction == DEADLINE_ACTION_CHECKPOINT {
+			checkpoints.save(c.key, max(c.read, c.skip))
+		}
+		return false, ErrDeadlineReached
+	}
+
+	c.read++
+	return c.read > c.skip, nil
+}
+
+// done marks the object as fully read.
+func (c *cursor) done(ctx context.Context) {
+	if config.GetConfig(ctx).DeadlineAction == DEADLINE_ACTION_CHECKPOINT {
+		checkpoints.clear(c.key)
+	}
+}
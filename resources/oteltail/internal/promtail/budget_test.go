@@ -0,0 +1,235 @@
+package promtail
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"oteltail/internal/config"
+	"oteltail/internal/otelclient"
+)
+
+// countingClient counts the records it is sent.
+type countingClient struct {
+	records int
+}
+
+func (c *countingClient) SendToOtel(_ context.Context, b *otelclient.Batch) error {
+	c.records += b.LineCount
+	return nil
+}
+
+// deadlineContext returns a context whose deadline is within the safety
+// margin if reached is set.
+func deadlineContext(t *testing.T, cfg *config.Configuration, reached bool) context.Context {
+	t.Helper()
+
+	cfg.LogBatchSize = 100
+	cfg.LogBatchBytes = 1 << 20
+	cfg.LogMaxRecordBytes = 1 << 20
+	cfg.DeadlineSafetyMargin = time.Minute
+
+	timeout := time.Hour
+	if reached {
+		timeout = time.Second
+	}
+	ctx, cancel := context.WithTimeout(config.WithConfig(context.Background(), cfg), timeout)
+	t.Cleanup(cancel)
+
+	return ctx
+}
+
+func gzipJSON(t *testing.T, v any) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDeadlineReached(t *testing.T) {
+	logs := events.CloudwatchLogsData{
+		LogGroup:  "/aws/lambda/app",
+		LogEvents: []events.CloudwatchLogsLogEvent{{Timestamp: 1700000000000, Message: "line"}},
+	}
+	cwEvent := &events.CloudwatchLogsEvent{AWSLogs: events.CloudwatchLogsRawData{
+		Data: base64.StdEncoding.EncodeToString(gzipJSON(t, logs)),
+	}}
+	kinesisEvent := &events.KinesisEvent{Records: []events.KinesisEventRecord{{
+		EventSourceArn: "arn:aws:kinesis:eu-west-1:123456789012:stream/logs",
+		Kinesis:        events.KinesisRecord{Data: []byte("line")},
+	}}}
+	kinesisCwEvent := &events.KinesisEvent{Records: []events.KinesisEventRecord{{
+		EventSourceArn: "arn:aws:kinesis:eu-west-1:123456789012:stream/logs",
+		Kinesis:        events.KinesisRecord{Data: gzipJSON(t, logs)},
+	}}}
+
+	tests := []struct {
+		name    string
+		process func(context.Context, otelclient.Client) error
+	}{
+		{"cloudwatch", func(ctx context.Context, c otelclient.Client) error {
+			return ProcessCWEvent(ctx, cwEvent, c)
+		}},
+		{"kinesis", func(ctx context.Context, c otelclient.Client) error {
+			return ProcessKinesisEvent(ctx, kinesisEvent, c)
+		}},
+		{"kinesis cloudwatch", func(ctx context.Context, c otelclient.Client) error {
+			return ProcessKinesisCwEvent(ctx, kinesisCwEvent, c)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &countingClient{}
+			if err := tt.process(deadlineContext(t, &config.Configuration{}, false), client); err != nil {
+				t.Fatal(err)
+			}
+			if client.records != 1 {
+				t.Fatalf("sent %d records before the deadline, want 1", client.records)
+			}
+
+			client = &countingClient{}
+			err := tt.process(deadlineContext(t, &config.Configuration{}, true), client)
+			if !errors.Is(err, ErrDeadlineReached) {
+				t.Errorf("process = %v, want %v", err, ErrDeadlineReached)
+			}
+			if client.records != 0 {
+				t.Errorf("sent %d records past the deadline, want 0", client.records)
+			}
+		})
+	}
+}
+
+// useCheckpoints replaces the checkpoint store for the duration of the test.
+func useCheckpoints(t *testing.T) {
+	t.Helper()
+
+	saved := checkpoints
+	checkpoints = &checkpointStore{}
+	t.Cleanup(func() { checkpoints = saved })
+}
+
+func TestCursor(t *testing.T) {
+	useCheckpoints(t)
+
+	cfg := &config.Configuration{
+		DeadlineAction: DEADLINE_ACTION_CHECKPOINT,
+		CheckpointPath: filepath.Join(t.TempDir(), "checkpoints.json"),
+	}
+	ctx := deadlineContext(t, cfg, false)
+	late := deadlineContext(t, cfg, true)
+
+	checkpoints.loaded = true
+	checkpoints.positions = map[string]int{"bucket/key": 2}
+
+	cur := newCursor(ctx, "bucket/key")
+	var sent []bool
+	for i := 0; i < 3; i++ {
+		send, err := cur.next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, send)
+	}
+	if sent[0] || sent[1] || !sent[2] {
+		t.Errorf("sent = %v, want the records sent by the previous invocation skipped", sent)
+	}
+
+	if _, err := cur.next(late); !errors.Is(err, ErrDeadlineReached) {
+		t.Fatalf("next = %v, want %v", err, ErrDeadlineReached)
+	}
+	if got := checkpoints.pending["bucket/key"]; got != 3 {
+		t.Errorf("checkpoint = %d, want 3", got)
+	}
+
+	// stopped before reaching the previous position, which is kept
+	cur = newCursor(ctx, "bucket/key")
+	if _, err := cur.next(late); !errors.Is(err, ErrDeadlineReached) {
+		t.Fatalf("next = %v, want %v", err, ErrDeadlineReached)
+	}
+	if got := checkpoints.pending["bucket/key"]; got != 2 {
+		t.Errorf("checkpoint = %d, want 2", got)
+	}
+
+	cur.done(ctx)
+	if got := checkpoints.pending["bucket/key"]; got >= 0 {
+		t.Errorf("checkpoint = %d after the object was read, want it cleared", got)
+	}
+}
+
+func TestCursorWithoutCheckpoints(t *testing.T) {
+	useCheckpoints(t)
+
+	cfg := &config.Configuration{DeadlineAction: DEADLINE_ACTION_ERROR}
+	checkpoints.loaded = true
+	checkpoints.positions = map[string]int{"bucket/key": 2}
+
+	cur := newCursor(deadlineContext(t, cfg, false), "bucket/key")
+	if send, err := cur.next(deadlineContext(t, cfg, false)); err != nil || !send {
+		t.Errorf("next = %v, %v, want the record sent", send, err)
+	}
+	if _, err := cur.next(deadlineContext(t, cfg, true)); !errors.Is(err, ErrDeadlineReached) {
+		t.Errorf("next = %v, want %v", err, ErrDeadlineReached)
+	}
+	if len(checkpoints.pending) != 0 {
+		t.Errorf("pending = %v, want no checkpoint", checkpoints.pending)
+	}
+}
+
+func TestCommitCheckpoints(t *testing.T) {
+	useCheckpoints(t)
+
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+	ctx := config.WithConfig(context.Background(), &config.Configuration{CheckpointPath: path})
+
+	checkpoints.save("bucket/a", 10)
+	checkpoints.save("bucket/b", 20)
+	if err := CommitCheckpoints(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoints.clear("bucket/a")
+	checkpoints.save("bucket/c", 5)
+	if err := CommitCheckpoints(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// discarded, e.g. because the records could not be exported
+	checkpoints.save("bucket/d", 1)
+	DiscardCheckpoints()
+	if err := CommitCheckpoints(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// a new execution environment reads them back
+	checkpoints = &checkpointStore{}
+	for key, want := range map[string]int{"bucket/a": 0, "bucket/b": 20, "bucket/c": 5, "bucket/d": 0} {
+		if got := checkpoints.position(ctx, key); got != want {
+			t.Errorf("position(%s) = %d, want %d", key, got, want)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files next to the checkpoints, want the temporary files removed", len(entries))
+	}
+}
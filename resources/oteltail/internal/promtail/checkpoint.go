@@ -0,0 +1,130 @@
+package promtail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"oteltail/internal/config"
+	"oteltail/internal/logger"
+)
+
+// checkpointStore keeps the number of records already sent from partially
+// read S3 objects. It lives in /tmp so it only survives between invocations
+// served by the same execution environment; a retry landing elsewhere reads
+// the object from the start.
+type checkpointStore struct {
+	mu        sync.Mutex
+	loaded    bool
+	positions map[string]int
+	// pending holds the changes of the current invocation, a negative
+	// position removes the checkpoint.
+	pending map[string]int
+}
+
+var checkpoints = &checkpointStore{}
+
+// position returns the number of records sent from the object by previous
+// invocations.
+func (s *checkpointStore) position(ctx context.Context, key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.load(ctx)
+
+	return s.positions[key]
+}
+
+func (s *checkpointStore) save(key string, position int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending == nil {
+		s.pending = make(map[string]int)
+	}
+	s.pending[key] = position
+}
+
+func (s *checkpointStore) clear(key string) {
+	s.save(key, -1)
+}
+
+// load reads the checkpoint file once, s.mu must be held.
+func (s *checkpointStore) load(ctx context.Context) {
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	s.positions = make(map[string]int)
+
+	content, err := os.ReadFile(config.GetConfig(ctx).CheckpointPath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.GetLogger(ctx).WarnContext(ctx, "unable to read checkpoints", "error", err)
+		}
+		return
+	}
+
+	if err := json.Unmarshal(content, &s.positions); err != nil {
+		logger.GetLogger(ctx).WarnContext(ctx, "ignoring invalid checkpoints", "error", err)
+		s.positions = make(map[string]int)
+	}
+}
+
+// CommitCheckpoints persists the checkpoints of the invocation. It must only
+// be called once the records read by the invocation were exported.
+func CommitCheckpoints(ctx context.Context) error {
+	s := checkpoints
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	s.load(ctx)
+	for key, position := range s.pending {
+		if position < 0 {
+			delete(s.positions, key)
+		} else {
+			s.positions[key] = position
+		}
+	}
+	s.pending = nil
+
+	content, err := json.Marshal(s.positions)
+	if err != nil {
+		return err
+	}
+
+	// write then rename so that a crash never leaves a truncated file
+	path := config.GetConfig(ctx).CheckpointPath
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// DiscardCheckpoints drops the checkpoints of the invocation, e.g. because
+// its records could not be exported.
+func DiscardCheckpoints() {
+	checkpoints.mu.Lock()
+	defer checkpoints.mu.Unlock()
+
+	checkpoints.pending = nil
+}
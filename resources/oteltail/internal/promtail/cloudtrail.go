@@ -20,7 +20,7 @@ func parseCloudtrailRecord(record Record) (logproto.Entry, error) {
 	if val, ok := record.Content["eventTime"]; ok {
 		time, err := time.Parse(time.RFC3339, val.(string))
 		if err != nil {
-			return logproto.Entry{}, err
+			return logproto.Entry{Line: string(document)}, err
 		} else {
 			timestamp = time
 		}
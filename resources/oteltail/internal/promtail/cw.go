@@ -2,6 +2,7 @@ package promtail
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -14,10 +15,31 @@ import (
 	"oteltail/internal/utils"
 )
 
-func parseCWEvent(ctx context.Context, b *otelclient.Batch, ev *events.CloudwatchLogsEvent) error {
+var cloudwatchSource = &source{
+	name: "cloudwatch",
+	detect: func(ev map[string]interface{}) bool {
+		return hasKeys(ev, "awslogs")
+	},
+	process: func(ctx context.Context, ev map[string]interface{}, oClient otelclient.Client, _ Handler) error {
+		var evt events.CloudwatchLogsEvent
+		if err := decodeEvent(ev, &evt); err != nil {
+			return err
+		}
+		return ProcessCWEvent(ctx, &evt, oClient)
+	},
+}
+
+func parseCWEvent(ctx context.Context, b *otelclient.Batch, perr *parseErrors, ev *events.CloudwatchLogsEvent) error {
 	data, err := ev.AWSLogs.Parse()
 	if err != nil {
-		return err
+		// the payload is the bad record, as it was received
+		return perr.handle(ctx, b, otelclient.LogEntry{
+			Labels: model.LabelSet{model.LabelName("__aws_log_type"): model.LabelValue("cloudwatch")},
+			Entry: logproto.Entry{
+				Line:      ev.AWSLogs.Data,
+				Timestamp: time.Now(),
+			},
+		}, err)
 	}
 
 	labels := model.LabelSet{
@@ -33,12 +55,16 @@ func parseCWEvent(ctx context.Context, b *otelclient.Batch, ev *events.Cloudwatc
 	labels = utils.ApplyResourceAttributes(ctx, labels)
 
 	for _, event := range data.LogEvents {
+		if deadlineReached(ctx) {
+			return ErrDeadlineReached
+		}
+
 		timestamp := time.UnixMilli(event.Timestamp)
 
-		if err := b.Add(ctx, otelclient.LogEntry{Labels: labels, Entry: logproto.Entry{
+		if err := b.Add(ctx, parseCWLog(ctx, otelclient.LogEntry{Labels: labels, Entry: logproto.Entry{
 			Line:      event.Message,
 			Timestamp: timestamp,
-		}}); err != nil {
+		}})); err != nil {
 			return err
 		}
 	}
@@ -52,9 +78,13 @@ func ProcessCWEvent(ctx context.Context, ev *events.CloudwatchLogsEvent, oClient
 		return err
 	}
 
-	err = parseCWEvent(ctx, batch, ev)
+	perr := newParseErrors("cloudwatch", nil)
+	err = parseCWEvent(ctx, batch, perr, ev)
+	if ferr := perr.flush(ctx); ferr != nil {
+		return errors.Join(err, ferr)
+	}
 	if err != nil {
-		return fmt.Errorf("error parsing log event: %s", err)
+		return fmt.Errorf("error parsing log event: %w", err)
 	}
 
 	err = oClient.SendToOtel(ctx, batch)
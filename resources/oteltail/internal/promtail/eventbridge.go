@@ -1,12 +1,22 @@
 package promtail
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"oteltail/internal/otelclient"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/log"
+
+	"oteltail/internal/config"
+	"oteltail/internal/logger"
+	"oteltail/internal/otelclient"
+	"oteltail/internal/utils"
 )
 
 // S3Detail encodes the message structure in EventBridge s3 notifications.
@@ -21,19 +31,33 @@ type S3Detail struct {
 
 type S3ObjectDetail struct {
 	Key       string `json:"key"`
-	Size      int    `json:"size"`
+	Size      int64  `json:"size"`
 	ETag      string `json:"etag"`
 	VersionID string `json:"version-id"`
 	Sequencer string `json:"sequencer"`
 }
 
+var eventBridgeSource = &source{
+	name: "eventbridge",
+	detect: func(ev map[string]interface{}) bool {
+		return hasKeys(ev, "detail-type", "source", "detail")
+	},
+	process: func(ctx context.Context, ev map[string]interface{}, oClient otelclient.Client, _ Handler) error {
+		var evt events.CloudWatchEvent
+		if err := decodeEvent(ev, &evt); err != nil {
+			return err
+		}
+		return ProcessEventBridgeEvent(ctx, &evt, oClient, ProcessS3Event)
+	},
+}
+
 type s3EventProcessor func(ctx context.Context, ev *events.S3Event, oClient otelclient.Client) error
 
 func ProcessEventBridgeEvent(ctx context.Context, ev *events.CloudWatchEvent, oClient otelclient.Client, process s3EventProcessor) error {
-	// lambda-promtail should only be used with S3 object creation events, since those indicate that a new file has been
-	// added to bucket, and need to be fetched and parsed accordingly.
+	// S3 object creation events indicate that a new file has been added to bucket, and need to be fetched and parsed
+	// accordingly. Any other event is forwarded as is.
 	if !(ev.Source == "aws.s3" && ev.DetailType == "Object Created") {
-		return fmt.Errorf("event bridge event type not supported")
+		return processGenericEventBridgeEvent(ctx, ev, oClient)
 	}
 
 	var eventDetail S3Detail
@@ -41,7 +65,8 @@ func ProcessEventBridgeEvent(ctx context.Context, ev *events.CloudWatchEvent, oC
 		return err
 	}
 
-	// TODO(thepalbi): how to fill bucket owner?
+	// S3 delivers EventBridge notifications to the default bus of the account owning the bucket, so the event
+	// account is the bucket owner.
 	var s3Event = events.S3Event{
 		Records: []events.S3EventRecord{
 			{
@@ -49,9 +74,16 @@ func ProcessEventBridgeEvent(ctx context.Context, ev *events.CloudWatchEvent, oC
 				S3: events.S3Entity{
 					Bucket: events.S3Bucket{
 						Name: eventDetail.Bucket.Name,
+						OwnerIdentity: events.S3UserIdentity{
+							PrincipalID: ev.AccountID,
+						},
 					},
 					Object: events.S3Object{
-						Key: eventDetail.Object.Key,
+						Key:       eventDetail.Object.Key,
+						Size:      eventDetail.Object.Size,
+						ETag:      eventDetail.Object.ETag,
+						VersionID: eventDetail.Object.VersionID,
+						Sequencer: eventDetail.Object.Sequencer,
 					},
 				},
 			},
@@ -60,3 +92,104 @@ func ProcessEventBridgeEvent(ctx context.Context, ev *events.CloudWatchEvent, oC
 
 	return process(ctx, &s3Event, oClient)
 }
+
+// eventBridgeAllowed applies the EVENTBRIDGE_ALLOW and EVENTBRIDGE_DENY rules,
+// deny rules take precedence and an empty allow list allows every event.
+func eventBridgeAllowed(ctx context.Context, ev *events.CloudWatchEvent) bool {
+	cfg := config.GetConfig(ctx)
+
+	for _, rule := range cfg.EventBridgeDeny {
+		if rule.Matches(ev.Source, ev.DetailType) {
+			return false
+		}
+	}
+
+	if len(cfg.EventBridgeAllow) == 0 {
+		return true
+	}
+
+	for _, rule := range cfg.EventBridgeAllow {
+		if rule.Matches(ev.Source, ev.DetailType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseEventBridgeEvent(ctx context.Context, b otelclient.BatchIf, perr *parseErrors, ev *events.CloudWatchEvent) error {
+	labels := model.LabelSet{
+		model.LabelName("__aws_log_type"):                model.LabelValue("eventbridge"),
+		model.LabelName("__aws_eventbridge_source"):      model.LabelValue(ev.Source),
+		model.LabelName("__aws_eventbridge_detail_type"): model.LabelValue(ev.DetailType),
+		model.LabelName("__aws_eventbridge_account"):     model.LabelValue(ev.AccountID),
+		model.LabelName("__aws_eventbridge_region"):      model.LabelValue(ev.Region),
+	}
+
+	labels = utils.ApplyResourceAttributes(ctx, labels)
+
+	resources := make([]log.Value, 0, len(ev.Resources))
+	for _, resource := range ev.Resources {
+		resources = append(resources, log.StringValue(resource))
+	}
+
+	attributes := []log.KeyValue{
+		log.String("__aws_eventbridge_id", ev.ID),
+		log.Slice("__aws_eventbridge_resources", resources...),
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(ev.Detail))
+	decoder.UseNumber()
+
+	timestamp := ev.Time
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	var detail any
+	if err := decoder.Decode(&detail); err != nil {
+		return perr.handle(ctx, b, otelclient.LogEntry{
+			Labels:     labels,
+			Attributes: attributes,
+			Entry: logproto.Entry{
+				Line:      string(ev.Detail),
+				Timestamp: timestamp,
+			},
+		}, err)
+	}
+
+	return b.Add(ctx, otelclient.LogEntry{
+		Labels:     labels,
+		Attributes: attributes,
+		Body:       otelclient.JSONValue(detail),
+		Entry: logproto.Entry{
+			Line:      string(ev.Detail),
+			Timestamp: timestamp,
+		},
+	})
+}
+
+func processGenericEventBridgeEvent(ctx context.Context, ev *events.CloudWatchEvent, oClient otelclient.Client) error {
+	eblog := logger.GetLogger(ctx)
+
+	if !eventBridgeAllowed(ctx, ev) {
+		eblog.DebugContext(ctx, "eventbridge event filtered", "source", ev.Source, "detail_type", ev.DetailType)
+		return nil
+	}
+
+	batch, err := otelclient.NewBatch(ctx, oClient)
+	if err != nil {
+		return err
+	}
+
+	perr := newParseErrors(fmt.Sprintf("eventbridge:%s", ev.ID), nil)
+	err = parseEventBridgeEvent(ctx, batch, perr, ev)
+	if ferr := perr.flush(ctx); ferr != nil {
+		return errors.Join(err, ferr)
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing eventbridge event: %s", err)
+	}
+
+	return oClient.SendToOtel(ctx, batch)
+}
@@ -9,6 +9,8 @@ import (
 // Stream helps transmit each recordss within a channel.
 type Stream struct {
 	records chan Record
+	// done is closed by Stop when the reader of records gives up.
+	done chan struct{}
 }
 
 // Represents a Record in the Json Stream. If there is not error, error is nil
@@ -21,6 +23,23 @@ type Record struct {
 func NewJSONStream(recordChan chan Record) Stream {
 	return Stream{
 		records: recordChan,
+		done:    make(chan struct{}),
+	}
+}
+
+// Stop makes Start return, closing its reader, when the records are no
+// longer read. It must be called once.
+func (s Stream) Stop() {
+	close(s.done)
+}
+
+// send transmits the record, it returns false once the stream is stopped.
+func (s Stream) send(record Record) bool {
+	select {
+	case s.records <- record:
+		return true
+	case <-s.done:
+		return false
 	}
 }
 
@@ -34,7 +53,7 @@ func (s Stream) Start(r io.ReadCloser, tokenCountToTarget int) {
 	for i := 0; i < tokenCountToTarget; i++ {
 		_, err := decoder.Token()
 		if err != nil {
-			s.records <- Record{Error: fmt.Errorf("failed decoding beginning token: %w", err)}
+			s.send(Record{Error: fmt.Errorf("failed decoding beginning token: %w", err)})
 			return
 		}
 	}
@@ -44,10 +63,12 @@ func (s Stream) Start(r io.ReadCloser, tokenCountToTarget int) {
 	for decoder.More() {
 		var content map[string]any
 		if err := decoder.Decode(&content); err != nil {
-			s.records <- Record{Error: fmt.Errorf("failed decoding record %d: %w", i, err)}
+			s.send(Record{Error: fmt.Errorf("failed decoding record %d: %w", i, err)})
+			return
+		}
+		if !s.send(Record{Content: content}) {
 			return
 		}
-		s.records <- Record{Content: content}
 		i++
 	}
 }
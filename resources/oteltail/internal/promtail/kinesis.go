@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"time"
@@ -18,12 +20,33 @@ import (
 	"oteltail/internal/utils"
 )
 
-func parseKinesisEvent(ctx context.Context, b otelclient.BatchIf, ev *events.KinesisEvent) error {
+var kinesisSource = &source{
+	name: "kinesis",
+	detect: func(ev map[string]interface{}) bool {
+		return recordsEventSource(ev, "eventSource") == "aws:kinesis"
+	},
+	process: func(ctx context.Context, ev map[string]interface{}, oClient otelclient.Client, _ Handler) error {
+		var evt events.KinesisEvent
+		if err := decodeEvent(ev, &evt); err != nil {
+			return err
+		}
+		if config.GetConfig(ctx).ParseKinesisCwLogs {
+			return ProcessKinesisCwEvent(ctx, &evt, oClient)
+		}
+		return ProcessKinesisEvent(ctx, &evt, oClient)
+	},
+}
+
+func parseKinesisEvent(ctx context.Context, b otelclient.BatchIf, perr *parseErrors, ev *events.KinesisEvent) error {
 	if ev == nil {
 		return nil
 	}
 
 	for _, record := range ev.Records {
+		if deadlineReached(ctx) {
+			return ErrDeadlineReached
+		}
+
 		timestamp := time.Unix(record.Kinesis.ApproximateArrivalTimestamp.Unix(), 0)
 
 		labels := model.LabelSet{
@@ -34,20 +57,23 @@ func parseKinesisEvent(ctx context.Context, b otelclient.BatchIf, ev *events.Kin
 		labels = utils.ApplyResourceAttributes(ctx, labels)
 
 		// Check if the data is gzipped by inspecting the 'data' field
-		if isGzipped(record.Kinesis.Data) {
-			uncompressedData, err := ungzipData(record.Kinesis.Data)
+		data := record.Kinesis.Data
+		if isGzipped(data) {
+			uncompressedData, err := ungzipData(data)
 			if err != nil {
-				return err
+				if err := perr.handle(ctx, b, badKinesisRecord(labels, record, timestamp), kinesisRecordError(record, err)); err != nil {
+					return err
+				}
+				continue
 			}
-			b.Add(ctx, otelclient.LogEntry{Labels: labels, Entry: logproto.Entry{
-				Line:      string(uncompressedData),
-				Timestamp: timestamp,
-			}})
-		} else {
-			b.Add(ctx, otelclient.LogEntry{Labels: labels, Entry: logproto.Entry{
-				Line:      string(record.Kinesis.Data),
-				Timestamp: timestamp,
-			}})
+			data = uncompressedData
+		}
+
+		if err := b.Add(ctx, parseBody(ctx, otelclient.LogEntry{Labels: labels, Entry: logproto.Entry{
+			Line:      string(data),
+			Timestamp: timestamp,
+		}})); err != nil {
+			return err
 		}
 	}
 
@@ -73,17 +99,29 @@ func cwParse(rawData []byte, ev *events.CloudwatchLogsData) (err error) {
 	return err
 }
 
-func parseKinesisCwEvent(ctx context.Context, b otelclient.BatchIf, ev *events.KinesisEvent) error {
+func parseKinesisCwEvent(ctx context.Context, b otelclient.BatchIf, perr *parseErrors, ev *events.KinesisEvent) error {
 	if ev == nil {
 		return nil
 	}
 
 	for _, record := range ev.Records {
+		if deadlineReached(ctx) {
+			return ErrDeadlineReached
+		}
+
 		var cwEvents events.CloudwatchLogsData
 
 		err := cwParse(record.Kinesis.Data, &cwEvents)
 		if err != nil {
-			return err
+			labels := model.LabelSet{
+				model.LabelName("__aws_log_type"):                 model.LabelValue("cloudwatch"),
+				model.LabelName("__aws_kinesis_event_source_arn"): model.LabelValue(record.EventSourceArn),
+			}
+			timestamp := time.Unix(record.Kinesis.ApproximateArrivalTimestamp.Unix(), 0)
+			if err := perr.handle(ctx, b, badKinesisRecord(labels, record, timestamp), kinesisRecordError(record, err)); err != nil {
+				return err
+			}
+			continue
 		}
 
 		labels := model.LabelSet{
@@ -101,10 +139,10 @@ func parseKinesisCwEvent(ctx context.Context, b otelclient.BatchIf, ev *events.K
 		for _, event := range cwEvents.LogEvents {
 			timestamp := time.UnixMilli(event.Timestamp)
 
-			if err := b.Add(ctx, otelclient.LogEntry{Labels: labels, Entry: logproto.Entry{
+			if err := b.Add(ctx, parseCWLog(ctx, otelclient.LogEntry{Labels: labels, Entry: logproto.Entry{
 				Line:      event.Message,
 				Timestamp: timestamp,
-			}}); err != nil {
+			}})); err != nil {
 				return err
 			}
 		}
@@ -113,10 +151,39 @@ func parseKinesisCwEvent(ctx context.Context, b otelclient.BatchIf, ev *events.K
 	return nil
 }
 
+// badKinesisRecord is the record sent or dead-lettered in place of a record
+// which could not be decoded, its line is the base64 encoded data.
+func badKinesisRecord(labels model.LabelSet, record events.KinesisEventRecord, timestamp time.Time) otelclient.LogEntry {
+	return otelclient.LogEntry{Labels: labels, Entry: logproto.Entry{
+		Line:      base64.StdEncoding.EncodeToString(record.Kinesis.Data),
+		Timestamp: timestamp,
+	}}
+}
+
+// kinesisRecordError adds the sequence number of the record to err, the
+// parse errors of an event are reported under the ARN of its stream.
+func kinesisRecordError(record events.KinesisEventRecord, err error) error {
+	return fmt.Errorf("record %s: %w", record.Kinesis.SequenceNumber, err)
+}
+
+// newKinesisParseErrors returns the parse errors of the records of ev, which
+// all come from the same stream.
+func newKinesisParseErrors(ev *events.KinesisEvent) *parseErrors {
+	source := "kinesis"
+	if ev != nil && len(ev.Records) > 0 {
+		source = ev.Records[0].EventSourceArn
+	}
+	return newParseErrors(source, nil)
+}
+
 func ProcessKinesisEvent(ctx context.Context, ev *events.KinesisEvent, oClient otelclient.Client) error {
 	batch, _ := otelclient.NewBatch(ctx, oClient)
 
-	err := parseKinesisEvent(ctx, batch, ev)
+	perr := newKinesisParseErrors(ev)
+	err := parseKinesisEvent(ctx, batch, perr, ev)
+	if ferr := perr.flush(ctx); ferr != nil {
+		return errors.Join(err, ferr)
+	}
 	if err != nil {
 		return err
 	}
@@ -131,7 +198,11 @@ func ProcessKinesisEvent(ctx context.Context, ev *events.KinesisEvent, oClient o
 func ProcessKinesisCwEvent(ctx context.Context, ev *events.KinesisEvent, oClient otelclient.Client) error {
 	batch, _ := otelclient.NewBatch(ctx, oClient)
 
-	err := parseKinesisCwEvent(ctx, batch, ev)
+	perr := newKinesisParseErrors(ev)
+	err := parseKinesisCwEvent(ctx, batch, perr, ev)
+	if ferr := perr.flush(ctx); ferr != nil {
+		return errors.Join(err, ferr)
+	}
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,218 @@
+package promtail
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/log"
+
+	"oteltail/internal/config"
+	"oteltail/internal/otelclient"
+	"oteltail/internal/utils"
+)
+
+// lambdaLogGroupPrefix is the prefix of the log groups of Lambda functions,
+// followed by the function name.
+const lambdaLogGroupPrefix = "/aws/lambda/"
+
+var (
+	// lambdaPlatformRegex matches the START, END and REPORT lines of the text
+	// log format.
+	lambdaPlatformRegex = regexp.MustCompile(`^(START|END|REPORT) RequestId: ([0-9a-f-]+)`)
+	// lambdaTextRegex matches the lines of the runtimes in the text log
+	// format: timestamp, request ID, optional level and message.
+	lambdaTextRegex = regexp.MustCompile(`^(\S+)\t([0-9a-f-]{36})\t(?:(TRACE|DEBUG|INFO|WARN|ERROR|FATAL)\t)?(?s:(.*))$`)
+	// lambdaPythonRegex matches the lines of the Python runtime in the text
+	// log format: level, timestamp, request ID and message.
+	lambdaPythonRegex = regexp.MustCompile(`^\[([A-Z]+)\]\t(\S+)\t([0-9a-f-]{36})\t(?s:(.*))$`)
+)
+
+// lambdaReportAttributes maps the fields of REPORT lines, and the metrics of
+// platform.report events, to attributes.
+var lambdaReportAttributes = map[string]string{
+	"Duration":          "aws.lambda.duration_ms",
+	"Billed Duration":   "aws.lambda.billed_duration_ms",
+	"Memory Size":       "aws.lambda.memory_size_mb",
+	"Max Memory Used":   "aws.lambda.max_memory_used_mb",
+	"Init Duration":     "aws.lambda.init_duration_ms",
+	"Restore Duration":  "aws.lambda.restore_duration_ms",
+	"durationMs":        "aws.lambda.duration_ms",
+	"billedDurationMs":  "aws.lambda.billed_duration_ms",
+	"memorySizeMB":      "aws.lambda.memory_size_mb",
+	"maxMemoryUsedMB":   "aws.lambda.max_memory_used_mb",
+	"initDurationMs":    "aws.lambda.init_duration_ms",
+	"restoreDurationMs": "aws.lambda.restore_duration_ms",
+}
+
+// parseCWLog parses the message of a CloudWatch Logs event: with
+// PARSE_LAMBDA_LOGS the logs of Lambda functions are recognised, PARSE_BODY
+// applies to the others.
+func parseCWLog(ctx context.Context, e otelclient.LogEntry) otelclient.LogEntry {
+	group := string(e.Labels[model.LabelName("__aws_cloudwatch_log_group")])
+
+	if config.GetConfig(ctx).ParseLambdaLogs && strings.HasPrefix(group, lambdaLogGroupPrefix) {
+		return parseLambdaLog(ctx, e, strings.TrimPrefix(group, lambdaLogGroupPrefix))
+	}
+
+	return parseBody(ctx, e)
+}
+
+// parseLambdaLog recognises the platform lines, the lines of the runtimes in
+// the text log format and the JSON log format of a Lambda function. The
+// request ID becomes the faas.invocation_id attribute and the fields of the
+// REPORT lines aws.lambda.* attributes. Every entry gets the faas.name
+// attribute.
+func parseLambdaLog(ctx context.Context, e otelclient.LogEntry, function string) otelclient.LogEntry {
+	// the attributes are shared by the entries of a log group
+	e.Attributes = append(e.Attributes[:len(e.Attributes):len(e.Attributes)], log.String("faas.name", function))
+
+	line := strings.TrimRight(e.Entry.Line, "\n")
+
+	if match := lambdaPlatformRegex.FindStringSubmatch(line); match != nil {
+		return lambdaPlatformLine(e, line, strings.ToLower(match[1]), match[2])
+	}
+
+	if match := lambdaTextRegex.FindStringSubmatch(line); match != nil {
+		return lambdaTextLine(e, match[1], match[2], match[3], match[4])
+	}
+
+	if match := lambdaPythonRegex.FindStringSubmatch(line); match != nil {
+		return lambdaTextLine(e, match[2], match[3], match[1], match[4])
+	}
+
+	if doc, ok := decodeJSONBody(line); ok {
+		return lambdaJSONLine(ctx, e, doc)
+	}
+
+	return e
+}
+
+// lambdaPlatformLine parses a START, END or REPORT line, e.g.
+//
+//	REPORT RequestId: 8f507cfc-...	Duration: 102.25 ms	Billed Duration: 103 ms	Memory Size: 128 MB	Max Memory Used: 70 MB	Init Duration: 150.12 ms
+func lambdaPlatformLine(e otelclient.LogEntry, line string, event string, requestID string) otelclient.LogEntry {
+	e.Attributes = append(e.Attributes,
+		log.String("aws.lambda.platform_event", event),
+		log.String("faas.invocation_id", requestID),
+	)
+
+	// START RequestId: ... Version: $LATEST
+	if _, version, ok := strings.Cut(line, " Version: "); ok && event == "start" {
+		e.Attributes = append(e.Attributes, log.String("faas.version", strings.TrimSpace(version)))
+	}
+
+	for _, field := range strings.Split(line, "\t") {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), ": ")
+		if !ok {
+			continue
+		}
+
+		if key == "XRAY TraceId" {
+			if id, err := utils.ParseTraceID(value); err == nil {
+				e.TraceID = id
+			}
+			continue
+		}
+
+		name, ok := lambdaReportAttributes[key]
+		if !ok {
+			continue
+		}
+		number, _, _ := strings.Cut(value, " ")
+		if f, err := strconv.ParseFloat(number, 64); err == nil {
+			e.Attributes = append(e.Attributes, log.Float64(name, f))
+		}
+	}
+
+	return e
+}
+
+// lambdaTextLine sets the fields of a line of the text log format.
+func lambdaTextLine(e otelclient.LogEntry, timestamp string, requestID string, level string, message string) otelclient.LogEntry {
+	if t, ok := bodyTimestamp(timestamp); ok {
+		e.Entry.Timestamp = t
+	}
+	if level != "" {
+		e.SeverityText = level
+		e.Severity = severityOf(level)
+	}
+
+	e.Attributes = append(e.Attributes, log.String("faas.invocation_id", requestID))
+	e.Body = log.StringValue(message)
+
+	return e
+}
+
+// lambdaJSONLine parses a line of the JSON log format, either a platform
+// event, e.g. {"time": ..., "type": "platform.report", "record": {...}}, or
+// a line of the runtime, e.g. {"timestamp": ..., "level": "INFO",
+// "requestId": ..., "message": ...}.
+func lambdaJSONLine(ctx context.Context, e otelclient.LogEntry, doc map[string]any) otelclient.LogEntry {
+	cfg := config.GetConfig(ctx)
+
+	if event, ok := doc["type"].(string); ok && strings.HasPrefix(event, "platform.") {
+		e.Attributes = append(e.Attributes, log.String("aws.lambda.platform_event", strings.TrimPrefix(event, "platform.")))
+
+		if t, ok := bodyTimestamp(doc["time"]); ok {
+			e.Entry.Timestamp = t
+		}
+
+		record, _ := doc["record"].(map[string]any)
+		if requestID, ok := record["requestId"].(string); ok {
+			e.Attributes = append(e.Attributes, log.String("faas.invocation_id", requestID))
+		}
+		if version, ok := record["version"].(string); ok {
+			e.Attributes = append(e.Attributes, log.String("faas.version", version))
+		}
+
+		metrics, _ := record["metrics"].(map[string]any)
+		for key, value := range metrics {
+			name, ok := lambdaReportAttributes[key]
+			if !ok {
+				continue
+			}
+			if number, ok := value.(json.Number); ok {
+				if f, err := number.Float64(); err == nil {
+					e.Attributes = append(e.Attributes, log.Float64(name, f))
+				}
+			}
+		}
+
+		if tracing, ok := record["tracing"].(map[string]any); ok {
+			if value, ok := tracing["value"].(string); ok {
+				if id, ok := bodyTraceID(xrayRoot(value)); ok {
+					e.TraceID = id
+				}
+			}
+		}
+
+		return e
+	}
+
+	if requestID, ok := doc["requestId"].(string); ok {
+		e.Attributes = append(e.Attributes, log.String("faas.invocation_id", requestID))
+		delete(doc, "requestId")
+	}
+
+	return structuredBody(cfg, e, doc, bodyKeys{
+		timestamp: []string{"timestamp"},
+		level:     []string{"level"},
+		traceID:   cfg.ParseBodyTraceIDKeys,
+		message:   []string{"message"},
+	})
+}
+
+// xrayRoot returns the trace ID of an X-Ray trace header, e.g.
+// Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1.
+func xrayRoot(header string) string {
+	for _, part := range strings.Split(header, ";") {
+		if root, ok := strings.CutPrefix(part, "Root="); ok {
+			return root
+		}
+	}
+	return header
+}
@@ -0,0 +1,223 @@
+package promtail
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/log"
+
+	"oteltail/internal/config"
+	"oteltail/internal/otelclient"
+)
+
+// attributeMap returns the string and float attributes of the entry.
+func attributeMap(e otelclient.LogEntry) map[string]any {
+	attrs := make(map[string]any, len(e.Attributes))
+	for _, kv := range e.Attributes {
+		switch kv.Value.Kind() {
+		case log.KindFloat64:
+			attrs[kv.Key] = kv.Value.AsFloat64()
+		default:
+			attrs[kv.Key] = kv.Value.AsString()
+		}
+	}
+	return attrs
+}
+
+func TestParseLambdaLog(t *testing.T) {
+	ctx := config.WithConfig(context.Background(), &config.Configuration{
+		ParseLambdaLogs:        true,
+		ParseBodyMaxAttributes: 64,
+		ParseBodyMaxDepth:      5,
+	})
+	received := time.Date(2024, 3, 1, 12, 0, 1, 0, time.UTC)
+	requestID := "8f507cfc-8f2b-4b35-9d5c-26d2f7c1a3b4"
+
+	tests := []struct {
+		name      string
+		line      string
+		attrs     map[string]any
+		body      string
+		severity  log.Severity
+		timestamp time.Time
+		traceID   string
+	}{
+		{
+			name: "start",
+			line: "START RequestId: " + requestID + " Version: $LATEST\n",
+			attrs: map[string]any{
+				"aws.lambda.platform_event": "start",
+				"faas.invocation_id":        requestID,
+				"faas.version":              "$LATEST",
+			},
+		},
+		{
+			name: "end",
+			line: "END RequestId: " + requestID + "\n",
+			attrs: map[string]any{
+				"aws.lambda.platform_event": "end",
+				"faas.invocation_id":        requestID,
+			},
+		},
+		{
+			name: "report",
+			line: "REPORT RequestId: " + requestID + "\tDuration: 102.25 ms\tBilled Duration: 103 ms\tMemory Size: 128 MB\tMax Memory Used: 70 MB\t\n",
+			attrs: map[string]any{
+				"aws.lambda.platform_event":     "report",
+				"faas.invocation_id":            requestID,
+				"aws.lambda.duration_ms":        102.25,
+				"aws.lambda.billed_duration_ms": 103.0,
+				"aws.lambda.memory_size_mb":     128.0,
+				"aws.lambda.max_memory_used_mb": 70.0,
+			},
+		},
+		{
+			name: "report cold start traced",
+			line: "REPORT RequestId: " + requestID + "\tDuration: 2.27 ms\tBilled Duration: 3 ms\tMemory Size: 128 MB\tMax Memory Used: 38 MB\tInit Duration: 141.22 ms\t\n" +
+				"XRAY TraceId: 1-5759e988-bd862e3fe1be46a994272793\tSegmentId: 53995c3f42cd8ad8\tSampled: true\t\n",
+			attrs: map[string]any{
+				"aws.lambda.platform_event":     "report",
+				"faas.invocation_id":            requestID,
+				"aws.lambda.duration_ms":        2.27,
+				"aws.lambda.billed_duration_ms": 3.0,
+				"aws.lambda.memory_size_mb":     128.0,
+				"aws.lambda.max_memory_used_mb": 38.0,
+				"aws.lambda.init_duration_ms":   141.22,
+			},
+			traceID: "5759e988bd862e3fe1be46a994272793",
+		},
+		{
+			name:      "text",
+			line:      "2024-03-01T12:00:00.123Z\t" + requestID + "\tINFO\tprocessing order 42\n",
+			attrs:     map[string]any{"faas.invocation_id": requestID},
+			body:      "processing order 42",
+			severity:  log.SeverityInfo,
+			timestamp: time.Date(2024, 3, 1, 12, 0, 0, 123e6, time.UTC),
+		},
+		{
+			name:      "text multiline",
+			line:      "2024-03-01T12:00:00.123Z\t" + requestID + "\tERROR\tInvoke Error\n    at handler (/var/task/index.js:3:9)\n",
+			attrs:     map[string]any{"faas.invocation_id": requestID},
+			body:      "Invoke Error\n    at handler (/var/task/index.js:3:9)",
+			severity:  log.SeverityError,
+			timestamp: time.Date(2024, 3, 1, 12, 0, 0, 123e6, time.UTC),
+		},
+		{
+			name:      "text without level",
+			line:      "2024-03-01T12:00:00.123Z\t" + requestID + "\tprocessing order 42\n",
+			attrs:     map[string]any{"faas.invocation_id": requestID},
+			body:      "processing order 42",
+			timestamp: time.Date(2024, 3, 1, 12, 0, 0, 123e6, time.UTC),
+		},
+		{
+			name:      "python",
+			line:      "[WARNING]\t2024-03-01T12:00:00.123Z\t" + requestID + "\tretrying the payment\n",
+			attrs:     map[string]any{"faas.invocation_id": requestID},
+			body:      "retrying the payment",
+			severity:  log.SeverityWarn,
+			timestamp: time.Date(2024, 3, 1, 12, 0, 0, 123e6, time.UTC),
+		},
+		{
+			name: "json platform.report",
+			line: `{"time":"2024-03-01T12:00:00.123Z","type":"platform.report","record":{"requestId":"` + requestID + `",` +
+				`"metrics":{"durationMs":102.25,"billedDurationMs":103,"memorySizeMB":128,"maxMemoryUsedMB":70,"initDurationMs":150.12},` +
+				`"tracing":{"spanId":"53995c3f42cd8ad8","type":"X-Amzn-Trace-Id","value":"Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"},` +
+				`"status":"success"}}`,
+			attrs: map[string]any{
+				"aws.lambda.platform_event":     "report",
+				"faas.invocation_id":            requestID,
+				"aws.lambda.duration_ms":        102.25,
+				"aws.lambda.billed_duration_ms": 103.0,
+				"aws.lambda.memory_size_mb":     128.0,
+				"aws.lambda.max_memory_used_mb": 70.0,
+				"aws.lambda.init_duration_ms":   150.12,
+			},
+			timestamp: time.Date(2024, 3, 1, 12, 0, 0, 123e6, time.UTC),
+			traceID:   "5759e988bd862e3fe1be46a994272793",
+		},
+		{
+			name:      "json runtime",
+			line:      `{"timestamp":"2024-03-01T12:00:00.123Z","level":"ERROR","requestId":"` + requestID + `","message":"payment failed"}`,
+			attrs:     map[string]any{"faas.invocation_id": requestID},
+			body:      "payment failed",
+			severity:  log.SeverityError,
+			timestamp: time.Date(2024, 3, 1, 12, 0, 0, 123e6, time.UTC),
+		},
+		{
+			name: "unrecognised",
+			line: "plain line",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := parseCWLog(ctx, otelclient.LogEntry{
+				Labels: model.LabelSet{"__aws_cloudwatch_log_group": "/aws/lambda/orders"},
+				Entry:  logproto.Entry{Line: tt.line, Timestamp: received},
+			})
+
+			want := map[string]any{"faas.name": "orders"}
+			for k, v := range tt.attrs {
+				want[k] = v
+			}
+			got := attributeMap(e)
+			if len(got) != len(want) {
+				t.Errorf("attributes = %v, want %v", got, want)
+			}
+			for k, v := range want {
+				if got[k] != v {
+					t.Errorf("%s = %v, want %v", k, got[k], v)
+				}
+			}
+
+			if tt.body != "" && e.Body.AsString() != tt.body {
+				t.Errorf("body = %q, want %q", e.Body.AsString(), tt.body)
+			}
+			if tt.body == "" && !e.Body.Empty() {
+				t.Errorf("body = %v, want the line", e.Body)
+			}
+			if e.Severity != tt.severity {
+				t.Errorf("severity = %v, want %v", e.Severity, tt.severity)
+			}
+
+			wantTimestamp := tt.timestamp
+			if wantTimestamp.IsZero() {
+				wantTimestamp = received
+			}
+			if !e.Entry.Timestamp.Equal(wantTimestamp) {
+				t.Errorf("timestamp = %v, want %v", e.Entry.Timestamp, wantTimestamp)
+			}
+
+			traceID := ""
+			if e.TraceID.IsValid() {
+				traceID = e.TraceID.String()
+			}
+			if traceID != tt.traceID {
+				t.Errorf("trace ID = %q, want %q", traceID, tt.traceID)
+			}
+		})
+	}
+}
+
+func TestParseCWLogOtherGroups(t *testing.T) {
+	for _, parse := range []bool{false, true} {
+		ctx := config.WithConfig(context.Background(), &config.Configuration{ParseLambdaLogs: parse})
+
+		line := "START RequestId: 8f507cfc-8f2b-4b35-9d5c-26d2f7c1a3b4 Version: $LATEST"
+		group := "/aws/lambda/orders"
+		if parse {
+			group = "/ecs/orders"
+		}
+
+		e := parseCWLog(ctx, otelclient.LogEntry{
+			Labels: model.LabelSet{"__aws_cloudwatch_log_group": model.LabelValue(group)},
+			Entry:  logproto.Entry{Line: line},
+		})
+		if len(e.Attributes) != 0 {
+			t.Errorf("PARSE_LAMBDA_LOGS=%v %s: attributes = %v, want the line left alone", parse, group, e.Attributes)
+		}
+	}
+}
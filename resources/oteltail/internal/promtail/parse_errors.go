@@ -0,0 +1,96 @@
+package promtail
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/log"
+
+	"oteltail/internal/config"
+	"oteltail/internal/deadletter"
+	"oteltail/internal/logger"
+	"oteltail/internal/otelclient"
+)
+
+const (
+	// PARSE_ERROR_POLICY_FAIL fails the whole source on the first bad record.
+	PARSE_ERROR_POLICY_FAIL = "fail"
+	// PARSE_ERROR_POLICY_SKIP drops the bad records.
+	PARSE_ERROR_POLICY_SKIP = "skip"
+	// PARSE_ERROR_POLICY_RAW sends the bad records as they were read, with the
+	// observed time as timestamp and a parse_error attribute.
+	PARSE_ERROR_POLICY_RAW = "raw"
+	// PARSE_ERROR_POLICY_DEADLETTER writes the bad records to DEADLETTER_URL.
+	PARSE_ERROR_POLICY_DEADLETTER = "deadletter"
+)
+
+// parseErrors applies PARSE_ERROR_POLICY to the records of a source which
+// could not be parsed.
+type parseErrors struct {
+	source      string
+	labels      map[string]string
+	count       int
+	deadLetters []deadletter.Record
+}
+
+func newParseErrors(source string, labels map[string]string) *parseErrors {
+	return &parseErrors{
+		source: source,
+		labels: labels,
+	}
+}
+
+// handle is called with the record which failed to parse, as it would have
+// been sent. It only returns an error under the fail policy.
+func (p *parseErrors) handle(ctx context.Context, b otelclient.BatchIf, entry otelclient.LogEntry, err error) error {
+	policy := config.GetConfig(ctx).ParseErrorPolicy
+	if policy == PARSE_ERROR_POLICY_FAIL {
+		return err
+	}
+
+	p.count++
+
+	switch policy {
+	case PARSE_ERROR_POLICY_RAW:
+		entry.Entry.Timestamp = time.Now()
+		// copy the attributes, they are shared by the records of the source
+		entry.Attributes = append(entry.Attributes[:len(entry.Attributes):len(entry.Attributes)], log.String("parse_error", err.Error()))
+		return b.Add(ctx, entry)
+	case PARSE_ERROR_POLICY_DEADLETTER:
+		p.deadLetters = append(p.deadLetters, deadletter.Record{
+			Source: p.source,
+			Line:   entry.Entry.Line,
+			Error:  err.Error(),
+			Labels: p.labels,
+			Time:   time.Now(),
+		})
+	}
+
+	return nil
+}
+
+// flush reports the bad records of the source and writes the dead letters.
+func (p *parseErrors) flush(ctx context.Context) error {
+	if p.count == 0 {
+		return nil
+	}
+
+	logger.GetLogger(ctx).WarnContext(ctx, "records could not be parsed", "source", p.source, "count", p.count, "policy", config.GetConfig(ctx).ParseErrorPolicy)
+
+	if len(p.deadLetters) == 0 {
+		return nil
+	}
+
+	sink, err := otelclient.DeadLetterSink(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := sink.Write(ctx, p.deadLetters); err != nil {
+		return fmt.Errorf("failed to dead-letter %d records of %s: %w", len(p.deadLetters), p.source, err)
+	}
+	p.deadLetters = nil
+
+	return nil
+}
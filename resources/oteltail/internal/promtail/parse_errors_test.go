@@ -0,0 +1,166 @@
+package promtail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+
+	"oteltail/internal/config"
+	"oteltail/internal/deadletter"
+	"oteltail/internal/otelclient"
+)
+
+func parseErrorContext(policy string, deadLetterURL string) context.Context {
+	return config.WithConfig(context.Background(), &config.Configuration{
+		LogBatchSize:      100,
+		LogBatchBytes:     1 << 20,
+		LogMaxRecordBytes: 1 << 20,
+		ParseErrorPolicy:  policy,
+		DeadLetterURL:     deadLetterURL,
+	})
+}
+
+// batchEntries returns the entries added to b.
+func batchEntries(b *otelclient.Batch) []otelclient.LogEntry {
+	var entries []otelclient.LogEntry
+	for _, stream := range b.Streams {
+		entries = append(entries, stream.Entries...)
+	}
+	return entries
+}
+
+func TestParseErrorPolicy(t *testing.T) {
+	errBad := errors.New("no timestamp")
+	entry := otelclient.LogEntry{
+		Labels: model.LabelSet{"__aws_log_type": "s3_lb"},
+		Entry: logproto.Entry{
+			Line:      "bad line",
+			Timestamp: time.Unix(0, 0),
+		},
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		ctx := parseErrorContext(PARSE_ERROR_POLICY_FAIL, "")
+		b, _ := otelclient.NewBatch(ctx, nil)
+		perr := newParseErrors("s3://bucket/key", nil)
+
+		if err := perr.handle(ctx, b, entry, errBad); !errors.Is(err, errBad) {
+			t.Errorf("handle = %v, want %v", err, errBad)
+		}
+		if b.LineCount != 0 {
+			t.Errorf("batch has %d records, want 0", b.LineCount)
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		ctx := parseErrorContext(PARSE_ERROR_POLICY_SKIP, "")
+		b, _ := otelclient.NewBatch(ctx, nil)
+		perr := newParseErrors("s3://bucket/key", nil)
+
+		if err := perr.handle(ctx, b, entry, errBad); err != nil {
+			t.Fatal(err)
+		}
+		if err := perr.flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if b.LineCount != 0 {
+			t.Errorf("batch has %d records, want 0", b.LineCount)
+		}
+		if perr.count != 1 {
+			t.Errorf("count = %d, want 1", perr.count)
+		}
+	})
+
+	t.Run("raw", func(t *testing.T) {
+		ctx := parseErrorContext(PARSE_ERROR_POLICY_RAW, "")
+		b, _ := otelclient.NewBatch(ctx, nil)
+		perr := newParseErrors("s3://bucket/key", nil)
+
+		if err := perr.handle(ctx, b, entry, errBad); err != nil {
+			t.Fatal(err)
+		}
+
+		entries := batchEntries(b)
+		if len(entries) != 1 {
+			t.Fatalf("batch has %d records, want 1", len(entries))
+		}
+		got := entries[0]
+		if got.Entry.Line != entry.Entry.Line {
+			t.Errorf("line = %q, want %q", got.Entry.Line, entry.Entry.Line)
+		}
+		if !got.Entry.Timestamp.After(entry.Entry.Timestamp) {
+			t.Errorf("timestamp = %v, want the observed time", got.Entry.Timestamp)
+		}
+		if len(got.Attributes) != 1 || got.Attributes[0].Key != "parse_error" || got.Attributes[0].Value.AsString() != errBad.Error() {
+			t.Errorf("attributes = %v, want parse_error=%q", got.Attributes, errBad)
+		}
+	})
+
+	t.Run("deadletter", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "deadletter.jsonl")
+		ctx := parseErrorContext(PARSE_ERROR_POLICY_DEADLETTER, "file://"+path)
+		b, _ := otelclient.NewBatch(ctx, nil)
+		labels := map[string]string{"bucket": "bucket", "key": "key"}
+		perr := newParseErrors("s3://bucket/key", labels)
+
+		if err := perr.handle(ctx, b, entry, errBad); err != nil {
+			t.Fatal(err)
+		}
+		if err := perr.flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if b.LineCount != 0 {
+			t.Errorf("batch has %d records, want 0", b.LineCount)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != 1 {
+			t.Fatalf("dead-letter file has %d records, want 1", len(lines))
+		}
+
+		var record deadletter.Record
+		if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Source != "s3://bucket/key" || record.Line != entry.Entry.Line || record.Error != errBad.Error() || record.Labels["key"] != "key" {
+			t.Errorf("record = %+v", record)
+		}
+	})
+}
+
+func TestParseErrorPolicyEventBridge(t *testing.T) {
+	ctx := parseErrorContext(PARSE_ERROR_POLICY_RAW, "")
+	b, _ := otelclient.NewBatch(ctx, nil)
+	ev := &events.CloudWatchEvent{
+		ID:         "id",
+		Source:     "custom",
+		DetailType: "Custom",
+		Detail:     json.RawMessage(`{"truncated":`),
+	}
+	perr := newParseErrors("eventbridge:id", nil)
+
+	if err := parseEventBridgeEvent(ctx, b, perr, ev); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := batchEntries(b)
+	if len(entries) != 1 {
+		t.Fatalf("batch has %d records, want 1", len(entries))
+	}
+	if entries[0].Entry.Line != string(ev.Detail) {
+		t.Errorf("line = %q, want %q", entries[0].Entry.Line, ev.Detail)
+	}
+}
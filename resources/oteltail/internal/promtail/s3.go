@@ -4,10 +4,15 @@ import (
 	"bufio"
 	"compress/gzip"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -16,6 +21,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/grafana/loki/pkg/logproto"
 	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/log"
+	"golang.org/x/sync/errgroup"
 
 	"oteltail/internal/config"
 	"oteltail/internal/logger"
@@ -40,6 +47,18 @@ type parserConfig struct {
 	ownerLabelKey string
 	// file is gzip compressed
 	gzipCompressed bool
+	// detect gzip compression from the object content instead of gzipCompressed
+	detectCompression bool
+	// how each line is decoded, one of text, json or csv
+	lineFormat string
+	// json key or csv column holding the timestamp
+	timestampField string
+	// csv column names, taken from the last skipped header line when empty
+	csvColumns []string
+	// export filename labels as __custom_<name> labels
+	customLabels bool
+	// maps filename regex group names to label names, replaces the __custom_ labels
+	labelMapping map[string]string
 }
 
 const (
@@ -52,6 +71,10 @@ const (
 	LB_ALB_TYPE                string = "app"
 	WAF_LOG_TYPE               string = "WAFLogs"
 	CUSTOM                     string = "custom"
+
+	LINE_FORMAT_TEXT string = "text"
+	LINE_FORMAT_JSON string = "json"
+	LINE_FORMAT_CSV  string = "csv"
 )
 
 var (
@@ -132,17 +155,76 @@ var (
 		CUSTOM: {
 			logTypeLabel:   "custom",
 			gzipCompressed: false,
+			customLabels:   true,
 		},
 	}
 )
 
 var (
-	s3Clients map[string]*s3.Client
+	s3ClientsMu sync.Mutex
+	s3Clients   map[string]*s3.Client
 )
 
+var s3Source = &source{
+	name: "s3",
+	detect: func(ev map[string]interface{}) bool {
+		return recordsEventSource(ev, "eventSource") == "aws:s3"
+	},
+	process: func(ctx context.Context, ev map[string]interface{}, oClient otelclient.Client, _ Handler) error {
+		var evt events.S3Event
+		if err := decodeEvent(ev, &evt); err != nil {
+			return err
+		}
+		return ProcessS3Event(ctx, &evt, oClient)
+	},
+}
+
+// s3TestSource ignores the test event sent when setting up S3 Notification
+// on a bucket, see: https://docs.aws.amazon.com/AmazonS3/latest/userguide/notification-content-structure.html
+var s3TestSource = &source{
+	name: "s3_test",
+	detect: func(ev map[string]interface{}) bool {
+		return ev["Event"] == "s3:TestEvent"
+	},
+	process: func(ctx context.Context, ev map[string]interface{}, oClient otelclient.Client, _ Handler) error {
+		return nil
+	},
+}
+
+var sqsSource = &source{
+	name: "sqs",
+	detect: func(ev map[string]interface{}) bool {
+		return recordsEventSource(ev, "eventSource") == "aws:sqs"
+	},
+	process: func(ctx context.Context, ev map[string]interface{}, oClient otelclient.Client, next Handler) error {
+		var evt events.SQSEvent
+		if err := decodeEvent(ev, &evt); err != nil {
+			return err
+		}
+		return ProcessSQSEvent(ctx, &evt, next)
+	},
+}
+
+var snsSource = &source{
+	name: "sns",
+	detect: func(ev map[string]interface{}) bool {
+		return recordsEventSource(ev, "EventSource") == "aws:sns"
+	},
+	process: func(ctx context.Context, ev map[string]interface{}, oClient otelclient.Client, next Handler) error {
+		var evt events.SNSEvent
+		if err := decodeEvent(ev, &evt); err != nil {
+			return err
+		}
+		return ProcessSNSEvent(ctx, &evt, next)
+	},
+}
+
 func getS3Client(ctx context.Context, region string) (*s3.Client, error) {
 	var s3Client *s3.Client
 
+	s3ClientsMu.Lock()
+	defer s3ClientsMu.Unlock()
+
 	if s3Clients == nil {
 		s3Clients = make(map[string]*s3.Client)
 	}
@@ -160,9 +242,9 @@ func getS3Client(ctx context.Context, region string) (*s3.Client, error) {
 	return s3Client, nil
 }
 
-func parseS3Log(ctx context.Context, b *otelclient.Batch, labels map[string]string, obj io.ReadCloser) error {
+func parseS3Log(ctx context.Context, b *otelclient.Batch, labels map[string]string, attrs []log.KeyValue, cur *cursor, perr *parseErrors, obj io.ReadCloser) error {
 
-	log := logger.GetLogger(ctx)
+	s3log := logger.GetLogger(ctx)
 
 	parser, ok := parsers[labels["type"]]
 	if !ok {
@@ -172,21 +254,11 @@ func parseS3Log(ctx context.Context, b *otelclient.Batch, labels map[string]stri
 		return fmt.Errorf("could not find parser for type %s", labels["type"])
 	}
 
-	//
-	var reader io.ReadCloser
-	var err error
-
-	if parsers[labels["type"]].gzipCompressed {
-		reader, err = gzip.NewReader(obj)
-		if err != nil {
-			return err
-		}
-	} else {
-		reader = obj
+	reader, err := decompress(parser, obj)
+	if err != nil {
+		return err
 	}
 
-	scanner := bufio.NewScanner(reader)
-
 	ls := model.LabelSet{
 		model.LabelName("__aws_log_type"): model.LabelValue(parser.logTypeLabel),
 	}
@@ -200,7 +272,7 @@ func parseS3Log(ctx context.Context, b *otelclient.Batch, labels map[string]stri
 		ls[model.LabelName(fmt.Sprintf("__aws_%s_owner", parser.logTypeLabel))] = model.LabelValue(labels[parser.ownerLabelKey])
 	}
 
-	if labels["type"] == CUSTOM {
+	if parser.customLabels {
 		for key, value := range labels {
 			if key != "type" && key != "" && value != "" {
 				switch key {
@@ -211,7 +283,11 @@ func parseS3Log(ctx context.Context, b *otelclient.Batch, labels map[string]stri
 				case "key":
 					ls[model.LabelName("__aws_bucket_key")] = model.LabelValue(labels["key"])
 				default:
-					ls[model.LabelName(fmt.Sprintf("__custom_%s", key))] = model.LabelValue(labels[key])
+					if len(parser.labelMapping) == 0 {
+						ls[model.LabelName(fmt.Sprintf("__custom_%s", key))] = model.LabelValue(labels[key])
+					} else if name, ok := parser.labelMapping[key]; ok {
+						ls[model.LabelName(name)] = model.LabelValue(labels[key])
+					}
 				}
 			}
 		}
@@ -224,22 +300,39 @@ func parseS3Log(ctx context.Context, b *otelclient.Batch, labels map[string]stri
 		records := make(chan Record)
 		jsonStream := NewJSONStream(records)
 		go jsonStream.Start(reader, parser.skipHeaderCount)
+		// on an early return, e.g. at the deadline, stop the producer so that
+		// it does not leak with the object body
+		defer jsonStream.Stop()
 		// Stream json file
 		for record := range jsonStream.records {
 			if record.Error != nil {
 				return record.Error
 			}
+			if send, err := cur.next(ctx); err != nil {
+				return err
+			} else if !send {
+				continue
+			}
 			trailEntry, err := parseCloudtrailRecord(record)
 			if err != nil {
-				return err
+				if err := perr.handle(ctx, b, otelclient.LogEntry{Entry: trailEntry, Labels: ls, Attributes: attrs}, err); err != nil {
+					return err
+				}
+				continue
 			}
-			if err := b.Add(ctx, otelclient.LogEntry{Entry: trailEntry, Labels: ls}); err != nil {
+			if err := b.Add(ctx, otelclient.LogEntry{Entry: trailEntry, Labels: ls, Attributes: attrs}); err != nil {
 				return err
 			}
 		}
 		return nil
 	}
 
+	if parser.lineFormat == LINE_FORMAT_CSV {
+		return parseCSVLog(ctx, b, parser, labels, ls, attrs, cur, perr, reader)
+	}
+
+	scanner := bufio.NewScanner(reader)
+
 	var lineCount int
 	for scanner.Scan() {
 		log_line := scanner.Text()
@@ -247,14 +340,36 @@ func parseS3Log(ctx context.Context, b *otelclient.Batch, labels map[string]stri
 		if lineCount <= parser.skipHeaderCount {
 			continue
 		}
+		if send, err := cur.next(ctx); err != nil {
+			return err
+		} else if !send {
+			continue
+		}
 		if config.GetConfig(ctx).PrintLogLine {
-			log.InfoContext(ctx, log_line)
+			s3log.InfoContext(ctx, log_line)
 		}
 
-		timestamp := time.Now()
+		entry := otelclient.LogEntry{Labels: ls, Attributes: attrs, Entry: logproto.Entry{
+			Line: log_line,
+		}}
+
+		var (
+			value   string
+			found   bool
+			extract = true
+		)
 
 		//
-		if parser.timestampRegex != nil {
+		if parser.lineFormat == LINE_FORMAT_JSON && parser.timestampField != "" {
+
+			value, found, err = jsonField(log_line, parser.timestampField)
+			if err != nil {
+				if err := perr.handle(ctx, b, entry, err); err != nil {
+					return err
+				}
+				continue
+			}
+		} else if parser.timestampRegex != nil {
 
 			match := parser.timestampRegex.FindStringSubmatch(log_line)
 
@@ -264,28 +379,33 @@ func parseS3Log(ctx context.Context, b *otelclient.Batch, labels map[string]stri
 					match[1] += "Z"
 				}
 
-				switch parser.timestampType {
-				case "string":
-					timestamp, err = time.Parse(parser.timestampFormat, match[1])
-					if err != nil {
-						return err
-					}
-				case "unix":
-					sec, nsec, err := utils.GetUnixSecNsec(match[1])
-					if err != nil {
-						return err
-					}
-					timestamp = time.Unix(sec, nsec).UTC()
-				default:
-					log.Warn(fmt.Sprintf("timestamp type of %s parser unknown, using current time", labels["type"]))
+				value, found = match[1], true
+			}
+		} else {
+			// the parser does not read timestamps from the records
+			extract = false
+		}
+
+		entry.Entry.Timestamp = time.Now()
+		if extract {
+			timestamp, source, err := parser.extractTimestamp(ctx, labels, value, found)
+			if errors.Is(err, errSkipRecord) {
+				continue
+			}
+			if err != nil {
+				if err := perr.handle(ctx, b, entry, err); err != nil {
+					return err
 				}
+				continue
 			}
+			entry.Entry.Timestamp = timestamp
+			entry.Attributes = withTimestampSource(entry.Attributes, source)
+			entry = parseS3Body(ctx, entry, source)
+		} else {
+			entry = parseBody(ctx, entry)
 		}
 
-		if err := b.Add(ctx, otelclient.LogEntry{Labels: ls, Entry: logproto.Entry{
-			Line:      log_line,
-			Timestamp: timestamp,
-		}}); err != nil {
+		if err := b.Add(ctx, entry); err != nil {
 			return err
 		}
 	}
@@ -293,6 +413,142 @@ func parseS3Log(ctx context.Context, b *otelclient.Batch, labels map[string]stri
 	return nil
 }
 
+// parseCSVLog sends each csv record as a json object keyed by column name.
+func parseCSVLog(ctx context.Context, b *otelclient.Batch, parser parserConfig, labels map[string]string, ls model.LabelSet, attrs []log.KeyValue, cur *cursor, perr *parseErrors, reader io.Reader) error {
+
+	s3log := logger.GetLogger(ctx)
+
+	r := csv.NewReader(reader)
+	r.FieldsPerRecord = -1
+
+	columns := parser.csvColumns
+
+	var rowCount int
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rowCount++
+		if rowCount <= parser.skipHeaderCount {
+			if len(parser.csvColumns) == 0 {
+				columns = row
+			}
+			continue
+		}
+		if send, err := cur.next(ctx); err != nil {
+			return err
+		} else if !send {
+			continue
+		}
+
+		fields := make(map[string]string, len(row))
+		for i, value := range row {
+			if i < len(columns) {
+				fields[columns[i]] = value
+			} else {
+				fields[fmt.Sprintf("column_%d", i+1)] = value
+			}
+		}
+
+		document, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+
+		if config.GetConfig(ctx).PrintLogLine {
+			s3log.InfoContext(ctx, string(document))
+		}
+
+		entry := otelclient.LogEntry{Labels: ls, Attributes: attrs, Entry: logproto.Entry{
+			Line: string(document),
+		}}
+
+		entry.Entry.Timestamp = time.Now()
+
+		if parser.timestampField != "" {
+			value, found := fields[parser.timestampField]
+			timestamp, source, err := parser.extractTimestamp(ctx, labels, value, found)
+			if errors.Is(err, errSkipRecord) {
+				continue
+			}
+			if err != nil {
+				if err := perr.handle(ctx, b, entry, err); err != nil {
+					return err
+				}
+				continue
+			}
+			entry.Entry.Timestamp = timestamp
+			entry.Attributes = withTimestampSource(entry.Attributes, source)
+			entry = parseS3Body(ctx, entry, source)
+		} else {
+			entry = parseBody(ctx, entry)
+		}
+
+		if err := b.Add(ctx, entry); err != nil {
+			return err
+		}
+	}
+}
+
+// timestamp converts a timestamp extracted from a log line according to the
+// parser timestamp type and format.
+func (p parserConfig) timestamp(ctx context.Context, value string) (time.Time, error) {
+	switch p.timestampType {
+	case "string":
+		return time.Parse(p.timestampFormat, value)
+	case "unix":
+		// custom parsers read the value from any field, check it is an epoch
+		timestamp, ok := parseEpoch(value)
+		if !ok {
+			return time.Time{}, fmt.Errorf("invalid unix timestamp %q", value)
+		}
+		return timestamp, nil
+	default:
+		logger.GetLogger(ctx).Warn(fmt.Sprintf("timestamp type of %s parser unknown, using current time", p.logTypeLabel))
+		return time.Now(), nil
+	}
+}
+
+// jsonField returns the top level key of a json encoded line as a string.
+func jsonField(line string, key string) (string, bool, error) {
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+
+	var document map[string]any
+	if err := decoder.Decode(&document); err != nil {
+		return "", false, err
+	}
+
+	value, ok := document[key]
+	if !ok || value == nil {
+		return "", false, nil
+	}
+
+	return fmt.Sprint(value), true, nil
+}
+
+// decompress wraps the object body according to the parser compression.
+func decompress(parser parserConfig, obj io.ReadCloser) (io.ReadCloser, error) {
+	if parser.detectCompression {
+		br := bufio.NewReader(obj)
+		magic, _ := br.Peek(2)
+		if isGzipped(magic) {
+			return gzip.NewReader(br)
+		}
+		return io.NopCloser(br), nil
+	}
+
+	if parser.gzipCompressed {
+		return gzip.NewReader(obj)
+	}
+
+	return obj, nil
+}
+
 func getLabels(ctx context.Context, record events.S3EventRecord) (map[string]string, error) {
 
 	labels := make(map[string]string)
@@ -301,7 +557,8 @@ func getLabels(ctx context.Context, record events.S3EventRecord) (map[string]str
 	labels["bucket"] = record.S3.Bucket.Name
 	labels["bucket_owner"] = record.S3.Bucket.OwnerIdentity.PrincipalID
 	labels["bucket_region"] = record.AWSRegion
-	for key, p := range parsers {
+	for _, key := range parserNames() {
+		p := parsers[key]
 		if p.filenameRegex != nil && p.filenameRegex.MatchString(labels["key"]) {
 			if labels["type"] == "" {
 				labels["type"] = key
@@ -334,73 +591,274 @@ func getLabels(ctx context.Context, record events.S3EventRecord) (map[string]str
 	return labels, nil
 }
 
+// accountIDRegex matches AWS account IDs, as opposed to the canonical user IDs
+// S3 notifications carry as the bucket owner principal.
+var accountIDRegex = regexp.MustCompile(`^\d{12}$`)
+
+// expectedBucketOwner returns the account expected to own the bucket the
+// object is fetched from, validated against S3_EXPECTED_BUCKET_OWNERS.
+func expectedBucketOwner(ctx context.Context, labels map[string]string) (string, error) {
+	owner := labels["bucket_owner"]
+	if !accountIDRegex.MatchString(owner) {
+		owner = ""
+	}
+
+	allowed := config.GetConfig(ctx).S3ExpectedBucketOwners
+	if len(allowed) == 0 {
+		return owner, nil
+	}
+
+	if owner == "" {
+		if len(allowed) == 1 {
+			return allowed[0], nil
+		}
+		return "", fmt.Errorf("owner of bucket %s is unknown and cannot be validated", labels["bucket"])
+	}
+
+	if !slices.Contains(allowed, owner) {
+		return "", fmt.Errorf("bucket %s is owned by unexpected account %s", labels["bucket"], owner)
+	}
+
+	return owner, nil
+}
+
+// objectAttributes returns the record attributes identifying the S3 object
+// the records were read from.
+func objectAttributes(obj events.S3Object, owner string) []log.KeyValue {
+	var attrs []log.KeyValue
+
+	if owner != "" {
+		attrs = append(attrs, log.String("__aws_bucket_owner", owner))
+	}
+	if obj.Size > 0 {
+		attrs = append(attrs, log.Int64("__aws_s3_object_size", obj.Size))
+	}
+	if obj.ETag != "" {
+		attrs = append(attrs, log.String("__aws_s3_object_etag", obj.ETag))
+	}
+	if obj.VersionID != "" {
+		attrs = append(attrs, log.String("__aws_s3_object_version_id", obj.VersionID))
+	}
+
+	return attrs
+}
+
 func ProcessS3Event(ctx context.Context, ev *events.S3Event, oClient otelclient.Client) error {
-	log := logger.GetLogger(ctx)
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+
+	// a failed object does not cancel the others, which are read and
+	// checkpointed as far as they get
+	g := new(errgroup.Group)
+	g.SetLimit(config.GetConfig(ctx).S3FetchConcurrency)
+
+	for _, record := range ev.Records {
+		record := record
+		g.Go(func() error {
+			if err := processS3Object(ctx, record, oClient); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+
+	_ = g.Wait()
+	return errors.Join(errs...)
+}
+
+// processS3Object fetches and parses a single object. Each object uses its own
+// batch so its records are sent in the order they appear in the object.
+func processS3Object(ctx context.Context, record events.S3EventRecord, oClient otelclient.Client) error {
+	s3log := logger.GetLogger(ctx)
+
+	if deadlineReached(ctx) {
+		return ErrDeadlineReached
+	}
 
 	batch, err := otelclient.NewBatch(ctx, oClient)
 	if err != nil {
 		return err
 	}
-	for _, record := range ev.Records {
-		labels, err := getLabels(ctx, record)
-		if err != nil {
-			return err
-		}
-		log.Info(fmt.Sprintf("fetching s3 file: %s", labels["key"]))
-		s3Client, err := getS3Client(ctx, labels["bucket_region"])
-		if err != nil {
-			return err
-		}
-		obj, err := s3Client.GetObject(ctx,
-			&s3.GetObjectInput{
-				Bucket:              aws.String(labels["bucket"]),
-				Key:                 aws.String(labels["key"]),
-				ExpectedBucketOwner: aws.String(labels["bucketOwner"]),
-			})
-		if err != nil {
-			return fmt.Errorf("failed to get object %s from bucket %s on account %s\n, %s", labels["key"], labels["bucket"], labels["bucketOwner"], err)
-		}
-		err = parseS3Log(ctx, batch, labels, obj.Body)
-		if err != nil {
-			return err
-		}
+	labels, err := getLabels(ctx, record)
+	if err != nil {
+		return err
+	}
+	s3log.Info(fmt.Sprintf("fetching s3 file: %s", labels["key"]))
+	s3Client, err := getS3Client(ctx, labels["bucket_region"])
+	if err != nil {
+		return err
+	}
+	owner, err := expectedBucketOwner(ctx, labels)
+	if err != nil {
+		return err
+	}
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(labels["bucket"]),
+		Key:    aws.String(labels["key"]),
+	}
+	if owner != "" {
+		input.ExpectedBucketOwner = aws.String(owner)
 	}
+	if record.S3.Object.VersionID != "" {
+		input.VersionId = aws.String(record.S3.Object.VersionID)
+	}
+	obj, err := s3Client.GetObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to get object %s from bucket %s on account %s\n, %s", labels["key"], labels["bucket"], owner, err)
+	}
+	defer obj.Body.Close()
 
-	err = oClient.SendToOtel(ctx, batch)
+	cur := newCursor(ctx, checkpointKey(record.S3))
+	perr := newParseErrors(fmt.Sprintf("s3://%s/%s", labels["bucket"], labels["key"]), labels)
+	err = parseS3Log(ctx, batch, labels, objectAttributes(record.S3.Object, owner), cur, perr, obj.Body)
+	if ferr := perr.flush(ctx); ferr != nil {
+		return errors.Join(err, ferr)
+	}
+	if errors.Is(err, ErrDeadlineReached) {
+		// send what was read before giving up
+		if serr := oClient.SendToOtel(ctx, batch); serr != nil {
+			return serr
+		}
+		s3log.WarnContext(ctx, "deadline reached while reading s3 file", "key", labels["key"], "records", cur.read)
+		return err
+	}
 	if err != nil {
 		return err
 	}
+	cur.done(ctx)
 
-	return nil
+	return oClient.SendToOtel(ctx, batch)
 }
 
-func ProcessSNSEvent(ctx context.Context, evt *events.SNSEvent, handler func(ctx context.Context, ev map[string]interface{}) error) error {
+// checkpointKey identifies an object version in the checkpoint store.
+func checkpointKey(entity events.S3Entity) string {
+	key := entity.Bucket.Name + "/" + entity.Object.Key
+	if entity.Object.VersionID != "" {
+		return key + "?versionId=" + entity.Object.VersionID
+	}
+	if entity.Object.ETag != "" {
+		return key + "?etag=" + entity.Object.ETag
+	}
+	return key
+}
+
+func ProcessSNSEvent(ctx context.Context, evt *events.SNSEvent, handler Handler) error {
+	records := make([]nestedRecord, 0, len(evt.Records))
 	for _, record := range evt.Records {
-		event, err := stringToRawEvent(record.SNS.Message)
-		if err != nil {
-			return err
-		}
-		err = handler(ctx, event)
-		if err != nil {
-			return err
-		}
+		records = append(records, nestedRecord{id: record.SNS.MessageID, body: record.SNS.Message})
 	}
-	return nil
+	return processNestedRecords(ctx, records, handler)
 }
 
-func ProcessSQSEvent(ctx context.Context, evt *events.SQSEvent, handler func(ctx context.Context, ev map[string]interface{}) error) error {
+func ProcessSQSEvent(ctx context.Context, evt *events.SQSEvent, handler Handler) error {
+	records := make([]nestedRecord, 0, len(evt.Records))
 	for _, record := range evt.Records {
-		// retrieve nested
-		event, err := stringToRawEvent(record.Body)
-		if err != nil {
-			return err
-		}
-		err = handler(ctx, event)
-		if err != nil {
-			return err
-		}
+		records = append(records, nestedRecord{id: record.MessageId, body: record.Body})
 	}
-	return nil
+	return processNestedRecords(ctx, records, handler)
+}
+
+// nestedRecord is a message wrapping another event, e.g. an S3 notification
+// delivered through SQS.
+type nestedRecord struct {
+	id   string
+	body string
+}
+
+// FailedRecordsError is returned when some of the records of an SQS or SNS
+// event failed while the others were processed.
+type FailedRecordsError struct {
+	// IDs are the message IDs of the failed records.
+	IDs []string
+	Err error
+}
+
+func (e *FailedRecordsError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FailedRecordsError) Unwrap() error {
+	return e.Err
+}
+
+// SQSEventResponse is the partial batch response of an SQS handler, the
+// version of aws-lambda-go in use does not define it in its events package.
+type SQSEventResponse struct {
+	BatchItemFailures []SQSBatchItemFailure `json:"batchItemFailures"`
+}
+
+type SQSBatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// SQSEventResponse reports the failed records so that SQS only redelivers
+// them. The event source mapping must have ReportBatchItemFailures in its
+// FunctionResponseTypes, otherwise SQS ignores the response and deletes all
+// the messages.
+func (e *FailedRecordsError) SQSEventResponse() SQSEventResponse {
+	var resp SQSEventResponse
+	for _, id := range e.IDs {
+		resp.BatchItemFailures = append(resp.BatchItemFailures, SQSBatchItemFailure{ItemIdentifier: id})
+	}
+	return resp
+}
+
+// processNestedRecords hands the events wrapped by the records to handler
+// concurrently. A failing record does not stop the others, a
+// *FailedRecordsError with all the failed records is returned. The records
+// of the failed ones are not counted by the LOG_METRICS.
+//
+// Up to RECORD_CONCURRENCY records are processed at once, each fetching up
+// to S3_FETCH_CONCURRENCY objects, so that up to their product objects are
+// read at the same time.
+func processNestedRecords(ctx context.Context, records []nestedRecord, handler Handler) error {
+	var (
+		mu     sync.Mutex
+		errs   []error
+		failed []string
+	)
+
+	g := new(errgroup.Group)
+	g.SetLimit(config.GetConfig(ctx).RecordConcurrency)
+
+	for _, record := range records {
+		record := record
+		g.Go(func() error {
+			if deadlineReached(ctx) {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("record %s: %w", record.id, ErrDeadlineReached))
+				failed = append(failed, record.id)
+				mu.Unlock()
+				return nil
+			}
+			// the metrics of a failed record are counted when it is
+			// delivered again
+			rctx := otelclient.WithMetricScope(ctx)
+			event, err := stringToRawEvent(record.body)
+			if err == nil {
+				err = handler(rctx, event)
+			}
+			otelclient.EndMetricScope(rctx, err == nil)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("record %s: %w", record.id, err))
+				failed = append(failed, record.id)
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return &FailedRecordsError{IDs: failed, Err: errors.Join(errs...)}
 }
 
 func stringToRawEvent(body string) (map[string]interface{}, error) {
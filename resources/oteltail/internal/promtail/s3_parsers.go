@@ -0,0 +1,159 @@
+package promtail
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"oteltail/internal/config"
+	"oteltail/internal/logger"
+)
+
+var (
+	// names of the parsers loaded from config, in definition order
+	customParserNames []string
+
+	loadS3ParsersOnce sync.Once
+	loadS3ParsersErr  error
+)
+
+// named layouts accepted by timestamp_format in addition to Go time layouts
+var timestampLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"DateTime":    time.DateTime,
+}
+
+// LoadS3Parsers merges the custom S3 parsers defined in the configuration
+// into the built-in parsers. The parsers are only loaded once per process.
+func LoadS3Parsers(ctx context.Context) error {
+	loadS3ParsersOnce.Do(func() {
+		log := logger.GetLogger(ctx)
+
+		for _, pc := range config.GetConfig(ctx).S3Parsers {
+			if _, ok := parsers[pc.Name]; ok {
+				loadS3ParsersErr = fmt.Errorf("parser %s already defined", pc.Name)
+				return
+			}
+
+			parser, err := newParserConfig(pc)
+			if err != nil {
+				loadS3ParsersErr = fmt.Errorf("invalid parser %s: %w", pc.Name, err)
+				return
+			}
+
+			parsers[pc.Name] = parser
+			customParserNames = append(customParserNames, pc.Name)
+
+			log.InfoContext(ctx, "loaded custom S3 parser", "name", pc.Name, "format", parser.lineFormat)
+		}
+	})
+
+	return loadS3ParsersErr
+}
+
+func newParserConfig(pc config.S3ParserConfig) (parserConfig, error) {
+	var err error
+
+	parser := parserConfig{
+		logTypeLabel:    pc.Name,
+		timestampType:   pc.TimestampType,
+		timestampFormat: pc.TimestampFormat,
+		timestampField:  pc.TimestampField,
+		skipHeaderCount: pc.SkipHeaderCount,
+		ownerLabelKey:   pc.OwnerLabelKey,
+		lineFormat:      pc.LineFormat,
+		csvColumns:      pc.CSVColumns,
+		customLabels:    true,
+		labelMapping:    pc.Labels,
+	}
+
+	if pc.LogTypeLabel != "" {
+		parser.logTypeLabel = pc.LogTypeLabel
+	}
+
+	parser.filenameRegex, err = regexp.Compile(pc.KeyRegex)
+	if err != nil {
+		return parser, err
+	}
+
+	if pc.TimestampRegex != "" {
+		parser.timestampRegex, err = regexp.Compile(pc.TimestampRegex)
+		if err != nil {
+			return parser, err
+		}
+		if parser.timestampRegex.NumSubexp() < 1 {
+			return parser, fmt.Errorf("timestamp_regex must contain a capture group")
+		}
+	}
+
+	if parser.timestampType == "" {
+		parser.timestampType = "string"
+	}
+
+	if layout, ok := timestampLayouts[parser.timestampFormat]; ok {
+		parser.timestampFormat = layout
+	} else if parser.timestampFormat == "" {
+		parser.timestampFormat = time.RFC3339
+	}
+
+	switch pc.Compression {
+	case "", "auto":
+		parser.detectCompression = true
+	case "gzip":
+		parser.gzipCompressed = true
+	case "none":
+	default:
+		return parser, fmt.Errorf("unknown compression %q", pc.Compression)
+	}
+
+	switch parser.lineFormat {
+	case "":
+		parser.lineFormat = LINE_FORMAT_TEXT
+	case LINE_FORMAT_TEXT, LINE_FORMAT_JSON, LINE_FORMAT_CSV:
+	default:
+		return parser, fmt.Errorf("unknown line format %q", parser.lineFormat)
+	}
+
+	if parser.lineFormat == LINE_FORMAT_CSV && len(parser.csvColumns) == 0 && parser.skipHeaderCount == 0 {
+		return parser, fmt.Errorf("csv parsers need csv_columns or a header line to skip")
+	}
+
+	for group, label := range parser.labelMapping {
+		if !model.LabelName(label).IsValid() {
+			return parser, fmt.Errorf("invalid label name %s for group %s", label, group)
+		}
+	}
+
+	return parser, nil
+}
+
+// parserNames returns the parser keys in the order they are matched against
+// an object key: the configured parsers first, then the built-in ones.
+func parserNames() []string {
+	custom := make(map[string]bool, len(customParserNames))
+	for _, name := range customParserNames {
+		custom[name] = true
+	}
+
+	var builtin []string
+	for name := range parsers {
+		if !custom[name] {
+			builtin = append(builtin, name)
+		}
+	}
+	sort.Strings(builtin)
+
+	return append(append([]string{}, customParserNames...), builtin...)
+}
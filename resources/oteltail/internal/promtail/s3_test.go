@@ -0,0 +1,116 @@
+package promtail
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"oteltail/internal/config"
+)
+
+func TestParserTimestampUnix(t *testing.T) {
+	p := parserConfig{logTypeLabel: "custom", timestampType: "unix"}
+
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{value: "1709296200", want: time.Unix(1709296200, 0)},
+		{value: "1709296200123", want: time.UnixMilli(1709296200123)},
+		{value: "0"},
+		{value: "-1709296200"},
+		{value: "2024"},
+		{value: "not a number"},
+	}
+
+	for _, tt := range tests {
+		got, err := p.timestamp(context.Background(), tt.value)
+		if tt.want.IsZero() {
+			if err == nil {
+				t.Errorf("timestamp(%q) = %v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("timestamp(%q): %v", tt.value, err)
+		} else if !got.Equal(tt.want) {
+			t.Errorf("timestamp(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+// useS3Client makes the objects of region be fetched from the server at url
+// for the duration of the test.
+func useS3Client(t *testing.T, region, url string) {
+	t.Helper()
+
+	s3ClientsMu.Lock()
+	if s3Clients == nil {
+		s3Clients = make(map[string]*s3.Client)
+	}
+	s3Clients[region] = s3.New(s3.Options{
+		Region:      region,
+		Credentials: aws.AnonymousCredentials{},
+		// the signing region is set up front, the resolver sets it on its
+		// first call otherwise, racing with the concurrent fetches
+		EndpointResolver: s3.EndpointResolverFromURL(url, func(e *aws.Endpoint) { e.SigningRegion = region }),
+		UsePathStyle:     true,
+		Retryer:          aws.NopRetryer{},
+	})
+	s3ClientsMu.Unlock()
+
+	t.Cleanup(func() {
+		s3ClientsMu.Lock()
+		delete(s3Clients, region)
+		s3ClientsMu.Unlock()
+	})
+}
+
+func TestProcessS3EventFailedObject(t *testing.T) {
+	missing := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/missing.log") {
+			defer close(missing)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// answered once the other object has failed
+		<-missing
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("first\nsecond\n"))
+	}))
+	defer srv.Close()
+	useS3Client(t, "test-region", srv.URL)
+
+	ctx := deadlineContext(t, &config.Configuration{
+		S3FetchConcurrency: 2,
+		CustomS3PathRegex:  `.*`,
+	}, false)
+
+	record := func(key string) events.S3EventRecord {
+		return events.S3EventRecord{
+			AWSRegion: "test-region",
+			S3: events.S3Entity{
+				Bucket: events.S3Bucket{Name: "bucket"},
+				Object: events.S3Object{Key: key},
+			},
+		}
+	}
+	ev := &events.S3Event{Records: []events.S3EventRecord{record("missing.log"), record("present.log")}}
+
+	client := &countingClient{}
+	err := ProcessS3Event(ctx, ev, client)
+	if err == nil || !strings.Contains(err.Error(), "missing.log") {
+		t.Errorf("ProcessS3Event = %v, want the error of missing.log", err)
+	}
+	if client.records != 2 {
+		t.Errorf("sent %d records, want the 2 of present.log", client.records)
+	}
+}
@@ -0,0 +1,195 @@
+package promtail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/common/model"
+
+	"oteltail/internal/otelclient"
+	"oteltail/internal/utils"
+)
+
+// Handler processes a raw lambda event. Sources wrapping other events, such as
+// SQS and SNS, hand the nested event back to it.
+type Handler func(ctx context.Context, ev map[string]interface{}) error
+
+// Source is an event source oteltail can ingest.
+type Source interface {
+	// Name identifies the source in logs and errors.
+	Name() string
+	// Detect reports whether the raw event was emitted by this source. It should
+	// only look at fields which uniquely identify the source so that at most one
+	// registered source matches any event.
+	Detect(ev map[string]interface{}) bool
+	// Labels returns the labels shared by the records of the raw event. They
+	// are added to the labels Process builds for each record, which take
+	// precedence, and to those of the nested events.
+	Labels(ev map[string]interface{}) model.LabelSet
+	// Process decodes the raw event, builds the labels for its records and
+	// sends them through the client.
+	Process(ctx context.Context, ev map[string]interface{}, oClient otelclient.Client, next Handler) error
+}
+
+var (
+	sourcesMu sync.RWMutex
+	sources   []Source
+)
+
+// builtinSources are the sources of oteltail, in the order they are
+// detected. They come before the sources added with RegisterSource.
+var builtinSources = []Source{
+	cloudwatchSource,
+	eventBridgeSource,
+	kinesisSource,
+	s3Source,
+	s3TestSource,
+	sqsSource,
+	snsSource,
+}
+
+func init() {
+	for _, s := range builtinSources {
+		RegisterSource(s)
+	}
+}
+
+// RegisterSource adds a source to the registry. Sources are detected in the
+// order they were registered, after the built-in ones, and the first match
+// wins. Registering two sources with the same name panics.
+func RegisterSource(s Source) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+
+	for _, existing := range sources {
+		if existing.Name() == s.Name() {
+			panic(fmt.Sprintf("source %q already registered", s.Name()))
+		}
+	}
+
+	sources = append(sources, s)
+}
+
+// unregisterSource removes the source name from the registry, it lets the
+// tests clean up the sources they register.
+func unregisterSource(name string) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+
+	for i, s := range sources {
+		if s.Name() == name {
+			sources = append(sources[:i:i], sources[i+1:]...)
+			return
+		}
+	}
+}
+
+// DetectSource returns the registered source which emitted the raw event.
+func DetectSource(ev map[string]interface{}) (Source, error) {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+
+	for _, s := range sources {
+		if s.Detect(ev) {
+			return s, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown event type!")
+}
+
+// ProcessEvent processes the raw event with the source which emitted it,
+// adding the labels of the source to its records. Nested events are
+// dispatched to their own source.
+func ProcessEvent(ctx context.Context, s Source, ev map[string]interface{}, oClient otelclient.Client) error {
+	return processEvent(ctx, s, ev, oClient, Dispatch(oClient))
+}
+
+func processEvent(ctx context.Context, s Source, ev map[string]interface{}, oClient otelclient.Client, next Handler) error {
+	if labels := s.Labels(ev); len(labels) > 0 {
+		ctx = otelclient.WithLabels(ctx, utils.ApplyResourceAttributes(ctx, labels))
+	}
+	return s.Process(ctx, ev, oClient, next)
+}
+
+// source implements Source from plain functions, it is used by the built-in
+// sources. labels may be nil.
+type source struct {
+	name    string
+	detect  func(ev map[string]interface{}) bool
+	labels  func(ev map[string]interface{}) model.LabelSet
+	process func(ctx context.Context, ev map[string]interface{}, oClient otelclient.Client, next Handler) error
+}
+
+func (s *source) Name() string {
+	return s.name
+}
+
+func (s *source) Detect(ev map[string]interface{}) bool {
+	return s.detect(ev)
+}
+
+func (s *source) Labels(ev map[string]interface{}) model.LabelSet {
+	if s.labels == nil {
+		return nil
+	}
+	return s.labels(ev)
+}
+
+func (s *source) Process(ctx context.Context, ev map[string]interface{}, oClient otelclient.Client, next Handler) error {
+	return s.process(ctx, ev, oClient, next)
+}
+
+// Dispatch returns a Handler processing events with the registered source
+// which emitted them. Nested events are dispatched the same way, so all the
+// records of an invocation are sent through oClient.
+func Dispatch(oClient otelclient.Client) Handler {
+	var handler Handler
+	handler = func(ctx context.Context, ev map[string]interface{}) error {
+		s, err := DetectSource(ev)
+		if err != nil {
+			return err
+		}
+		return processEvent(ctx, s, ev, oClient, handler)
+	}
+	return handler
+}
+
+// decodeEvent converts the raw event into its typed representation.
+func decodeEvent(ev map[string]interface{}, v interface{}) error {
+	j, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(j, v)
+}
+
+// recordsEventSource returns the event source of the first record of a
+// batched event, e.g. "aws:s3" or "aws:sqs". The key differs between services.
+func recordsEventSource(ev map[string]interface{}, key string) string {
+	records, ok := ev["Records"].([]interface{})
+	if !ok || len(records) == 0 {
+		return ""
+	}
+
+	record, ok := records[0].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	eventSource, _ := record[key].(string)
+	return eventSource
+}
+
+// hasKeys reports whether all the keys are present in the raw event.
+func hasKeys(ev map[string]interface{}, keys ...string) bool {
+	for _, key := range keys {
+		if _, ok := ev[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package promtail
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+
+	"oteltail/internal/otelclient"
+)
+
+// registerSource registers s for the duration of the test.
+func registerSource(t *testing.T, s Source) {
+	t.Helper()
+	RegisterSource(s)
+	t.Cleanup(func() { unregisterSource(s.Name()) })
+}
+
+func TestDetectSourceBuiltinFirst(t *testing.T) {
+	// a custom source matching the events of a built-in one does not take
+	// them over
+	registerSource(t, &source{
+		name: "test_s3",
+		detect: func(ev map[string]interface{}) bool {
+			return recordsEventSource(ev, "eventSource") == "aws:s3"
+		},
+		process: func(context.Context, map[string]interface{}, otelclient.Client, Handler) error {
+			return nil
+		},
+	})
+
+	s, err := DetectSource(map[string]interface{}{
+		"Records": []interface{}{map[string]interface{}{"eventSource": "aws:s3"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name() != "s3" {
+		t.Errorf("source = %s, want s3", s.Name())
+	}
+}
+
+func TestProcessEventLabels(t *testing.T) {
+	ctx := parseErrorContext(PARSE_ERROR_POLICY_FAIL, "")
+	b, _ := otelclient.NewBatch(ctx, nil)
+
+	registerSource(t, &source{
+		name: "test_wrapper",
+		detect: func(ev map[string]interface{}) bool {
+			return ev["test"] == "wrapper"
+		},
+		labels: func(map[string]interface{}) model.LabelSet {
+			return model.LabelSet{"team": "a", "env": "dev"}
+		},
+		process: func(ctx context.Context, _ map[string]interface{}, _ otelclient.Client, next Handler) error {
+			return next(ctx, map[string]interface{}{"test": "nested"})
+		},
+	})
+	registerSource(t, &source{
+		name: "test_nested",
+		detect: func(ev map[string]interface{}) bool {
+			return ev["test"] == "nested"
+		},
+		labels: func(map[string]interface{}) model.LabelSet {
+			return model.LabelSet{"env": "prod", "__aws_log_type": "nested"}
+		},
+		process: func(ctx context.Context, _ map[string]interface{}, _ otelclient.Client, _ Handler) error {
+			return b.Add(ctx, otelclient.LogEntry{
+				Labels: model.LabelSet{"__aws_log_type": "record"},
+				Entry:  logproto.Entry{Line: "line", Timestamp: time.Unix(0, 0)},
+			})
+		},
+	})
+
+	ev := map[string]interface{}{"test": "wrapper"}
+	s, err := DetectSource(ev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ProcessEvent(ctx, s, ev, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := batchEntries(b)
+	if len(entries) != 1 {
+		t.Fatalf("batch has %d records, want 1", len(entries))
+	}
+
+	want := model.LabelSet{"team": "a", "env": "prod", "__aws_log_type": "record"}
+	if !entries[0].Labels.Equal(want) {
+		t.Errorf("labels = %v, want %v", entries[0].Labels, want)
+	}
+}
+
+func TestUnregisterSource(t *testing.T) {
+	ev := map[string]interface{}{"test": "unregister"}
+
+	registerSource(t, &source{
+		name: "test_unregister",
+		detect: func(ev map[string]interface{}) bool {
+			return ev["test"] == "unregister"
+		},
+	})
+	if _, err := DetectSource(ev); err != nil {
+		t.Fatal(err)
+	}
+
+	unregisterSource("test_unregister")
+	if s, err := DetectSource(ev); err == nil {
+		t.Errorf("source = %s after it was unregistered", s.Name())
+	}
+
+	// the name can be registered again
+	registerSource(t, &source{
+		name:   "test_unregister",
+		detect: func(map[string]interface{}) bool { return false },
+	})
+}
@@ -0,0 +1,172 @@
+package promtail
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/log"
+
+	"oteltail/internal/config"
+)
+
+const (
+	// TIMESTAMP_FALLBACK_OBSERVED uses the time the record was read.
+	TIMESTAMP_FALLBACK_OBSERVED = "observed"
+	// TIMESTAMP_FALLBACK_SKIP drops the record.
+	TIMESTAMP_FALLBACK_SKIP = "skip"
+	// TIMESTAMP_FALLBACK_ERROR hands the record to PARSE_ERROR_POLICY.
+	TIMESTAMP_FALLBACK_ERROR = "error"
+)
+
+// Values of the timestamp_fallback attribute, which marks the records whose
+// timestamp was not read with the parser format.
+const (
+	timestampSourceRFC3339  = "rfc3339"
+	timestampSourceEpoch    = "epoch"
+	timestampSourceS3Key    = "s3_key"
+	timestampSourceObserved = "observed"
+	// timestampSourceBody marks the records whose timestamp was read from the
+	// body by PARSE_BODY in place of a fallback.
+	timestampSourceBody = "body"
+)
+
+// errSkipRecord is returned by extractTimestamp when the record must be
+// dropped.
+var errSkipRecord = errors.New("record skipped")
+
+// rfc3339Layouts are the RFC3339 variants tried when the parser format fails.
+var rfc3339Layouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// keyDateRegex matches the date of an object key, either as a path, e.g.
+// 2024/01/31/23, a date, e.g. 2024-01-31T23, or hive partitions, e.g.
+// year=2024/month=01/day=31/hour=23.
+var keyDateRegex = regexp.MustCompile(`(?:year=)?(\d{4})[/-](?:month=)?(\d{2})[/-](?:day=)?(\d{2})(?:[/T](?:hour=)?(\d{2}))?`)
+
+// extractTimestamp returns the timestamp of a record. value is what the
+// parser extracted from the record, if found. The parser format is tried
+// first, then the RFC3339 variants, the epoch in seconds, milliseconds,
+// microseconds or nanoseconds, and finally the date of the object key. If
+// all fail, TIMESTAMP_FALLBACK applies. The returned source is empty when the
+// parser format was used.
+func (p parserConfig) extractTimestamp(ctx context.Context, labels map[string]string, value string, found bool) (time.Time, string, error) {
+	var parseErr error
+
+	if found {
+		timestamp, err := p.timestamp(ctx, value)
+		if err == nil {
+			return timestamp, "", nil
+		}
+		parseErr = err
+
+		for _, layout := range rfc3339Layouts {
+			if timestamp, err := time.Parse(layout, value); err == nil {
+				return timestamp, timestampSourceRFC3339, nil
+			}
+		}
+
+		if timestamp, ok := parseEpoch(value); ok {
+			return timestamp, timestampSourceEpoch, nil
+		}
+	}
+
+	if timestamp, ok := keyTimestamp(labels); ok {
+		return timestamp, timestampSourceS3Key, nil
+	}
+
+	switch config.GetConfig(ctx).TimestampFallback {
+	case TIMESTAMP_FALLBACK_SKIP:
+		return time.Time{}, "", errSkipRecord
+	case TIMESTAMP_FALLBACK_ERROR:
+		if parseErr == nil {
+			parseErr = errors.New("no timestamp found")
+		}
+		return time.Time{}, "", parseErr
+	default:
+		return time.Now(), timestampSourceObserved, nil
+	}
+}
+
+// parseEpoch reads an epoch in seconds, milliseconds, microseconds or
+// nanoseconds, told apart by their 10, 13, 16 or 19 digits. Other integers,
+// such as a year, are not taken for an epoch.
+func parseEpoch(value string) (time.Time, bool) {
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || i <= 0 {
+		return time.Time{}, false
+	}
+
+	switch len(value) {
+	case 10:
+		return time.Unix(i, 0).UTC(), true
+	case 13:
+		return time.UnixMilli(i).UTC(), true
+	case 16:
+		return time.UnixMicro(i).UTC(), true
+	case 19:
+		return time.Unix(0, i).UTC(), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// keyTimestamp returns the date of the object, from the year, month, day and
+// hour groups of the parser key regex or from the key itself.
+func keyTimestamp(labels map[string]string) (time.Time, bool) {
+	parts := []string{labels["year"], labels["month"], labels["day"], labels["hour"]}
+
+	if parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		match := keyDateRegex.FindStringSubmatch(labels["key"])
+		if match == nil {
+			return time.Time{}, false
+		}
+		parts = match[1:]
+	}
+
+	var values [4]int
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return time.Time{}, false
+		}
+		values[i] = v
+	}
+
+	if values[1] < 1 || values[1] > 12 || values[2] < 1 || values[2] > 31 || values[3] > 23 {
+		return time.Time{}, false
+	}
+
+	return time.Date(values[0], time.Month(values[1]), values[2], values[3], 0, 0, 0, time.UTC), true
+}
+
+// withTimestampSource marks a record whose timestamp was not read with the
+// parser format.
+func withTimestampSource(attrs []log.KeyValue, source string) []log.KeyValue {
+	if source == "" {
+		return attrs
+	}
+	// copy the attributes, they are shared by the records of the source
+	return append(attrs[:len(attrs):len(attrs)], log.String("timestamp_fallback", source))
+}
+
+// withoutTimestampSource returns a copy of the attributes without the mark
+// of withTimestampSource.
+func withoutTimestampSource(attrs []log.KeyValue) []log.KeyValue {
+	res := make([]log.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		if kv.Key != "timestamp_fallback" {
+			res = append(res, kv)
+		}
+	}
+	return res
+}
@@ -0,0 +1,90 @@
+package promtail
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"oteltail/internal/config"
+)
+
+func TestExtractTimestamp(t *testing.T) {
+	p := parserConfig{
+		logTypeLabel:    "test",
+		timestampType:   "string",
+		timestampFormat: "02/Jan/2006:15:04:05 -0700",
+	}
+	key := map[string]string{"key": "logs/2024/03/01/12/object.log"}
+	keyTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		labels     map[string]string
+		value      string
+		found      bool
+		fallback   string
+		want       time.Time
+		wantSource string
+		wantErr    bool
+	}{
+		{name: "parser format", value: "01/Mar/2024:12:30:00 +0000", found: true, want: time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)},
+		{name: "rfc3339", value: "2024-03-01T12:30:00.5Z", found: true, want: time.Date(2024, 3, 1, 12, 30, 0, 5e8, time.UTC), wantSource: timestampSourceRFC3339},
+		{name: "epoch seconds", value: "1709296200", found: true, want: time.Unix(1709296200, 0), wantSource: timestampSourceEpoch},
+		{name: "epoch milliseconds", value: "1709296200123", found: true, want: time.UnixMilli(1709296200123), wantSource: timestampSourceEpoch},
+		{name: "epoch microseconds", value: "1709296200123456", found: true, want: time.UnixMicro(1709296200123456), wantSource: timestampSourceEpoch},
+		{name: "epoch nanoseconds", value: "1709296200123456789", found: true, want: time.Unix(0, 1709296200123456789), wantSource: timestampSourceEpoch},
+		{name: "zero", labels: key, value: "0", found: true, want: keyTime, wantSource: timestampSourceS3Key},
+		{name: "negative", labels: key, value: "-1709296200", found: true, want: keyTime, wantSource: timestampSourceS3Key},
+		{name: "year is not an epoch", labels: key, value: "2024", found: true, want: keyTime, wantSource: timestampSourceS3Key},
+		{name: "short integer is not an epoch", labels: key, value: "200", found: true, want: keyTime, wantSource: timestampSourceS3Key},
+		{name: "not found", labels: key, want: keyTime, wantSource: timestampSourceS3Key},
+		{name: "key groups", labels: map[string]string{"year": "2023", "month": "12", "day": "31"}, want: time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC), wantSource: timestampSourceS3Key},
+		{name: "skip", value: "garbage", found: true, fallback: TIMESTAMP_FALLBACK_SKIP, wantErr: true},
+		{name: "error", value: "garbage", found: true, fallback: TIMESTAMP_FALLBACK_ERROR, wantErr: true},
+		{name: "error without value", fallback: TIMESTAMP_FALLBACK_ERROR, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := config.WithConfig(context.Background(), &config.Configuration{
+				TimestampFallback: tt.fallback,
+			})
+
+			got, source, err := p.extractTimestamp(ctx, tt.labels, tt.value, tt.found)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("extractTimestamp = %v, want an error", got)
+				}
+				if skip := tt.fallback == TIMESTAMP_FALLBACK_SKIP; errors.Is(err, errSkipRecord) != skip {
+					t.Errorf("extractTimestamp error = %v, skipped %v", err, skip)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("timestamp = %v, want %v", got, tt.want)
+			}
+			if source != tt.wantSource {
+				t.Errorf("source = %q, want %q", source, tt.wantSource)
+			}
+		})
+	}
+
+	t.Run("observed", func(t *testing.T) {
+		ctx := config.WithConfig(context.Background(), &config.Configuration{
+			TimestampFallback: TIMESTAMP_FALLBACK_OBSERVED,
+		})
+
+		before := time.Now()
+		got, source, err := p.extractTimestamp(ctx, nil, "0", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Before(before) || source != timestampSourceObserved {
+			t.Errorf("extractTimestamp = %v, %q, want the observed time", got, source)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+// Package auth provides per-RPC credentials authenticating the exporters
+// with the backend. The credentials are used by the gRPC exporter through
+// grpc.WithPerRPCCredentials and by HTTP exporters through Transport.
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// Headers sends static headers, e.g. API keys, with every request.
+type Headers map[string]string
+
+// Compile time check Headers implements credentials.PerRPCCredentials.
+var _ credentials.PerRPCCredentials = Headers(nil)
+
+func (h Headers) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return h, nil
+}
+
+func (h Headers) RequireTransportSecurity() bool {
+	return false
+}
+
+// requestSigner is implemented by the credentials which sign the whole
+// request rather than adding headers to it.
+type requestSigner interface {
+	signRequest(req *http.Request) error
+}
+
+// Transport returns a RoundTripper adding the credentials to the requests
+// sent through next, http.DefaultTransport if nil.
+func Transport(next http.RoundTripper, creds ...credentials.PerRPCCredentials) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &transport{
+		next:  next,
+		creds: creds,
+	}
+}
+
+type transport struct {
+	next  http.RoundTripper
+	creds []credentials.PerRPCCredentials
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request it is given
+	req = req.Clone(req.Context())
+
+	for _, c := range t.creds {
+		if signer, ok := c.(requestSigner); ok {
+			if err := signer.signRequest(req); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		md, err := c.GetRequestMetadata(req.Context(), req.URL.String())
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range md {
+			req.Header.Set(name, value)
+		}
+	}
+
+	return t.next.RoundTrip(req)
+}
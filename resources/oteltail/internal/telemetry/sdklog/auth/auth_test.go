@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// tokenServer is an OAuth2 token endpoint issuing tokens valid for
+// expiresIn seconds, it counts the tokens it issues.
+func tokenServer(t *testing.T, expiresIn int) (*httptest.Server, *int32) {
+	var issued int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "client_credentials" {
+			http.Error(w, "invalid_request", http.StatusBadRequest)
+			return
+		}
+		n := atomic.AddInt32(&issued, 1)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d}`, n, expiresIn)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &issued
+}
+
+func TestOAuth2CachesToken(t *testing.T) {
+	srv, issued := tokenServer(t, 3600)
+	creds := NewOAuth2(clientcredentials.Config{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		TokenURL:     srv.URL,
+	})
+
+	for i := 0; i < 3; i++ {
+		md, err := creds.GetRequestMetadata(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := md["authorization"]; got != "Bearer token-1" {
+			t.Errorf("authorization = %q, want %q", got, "Bearer token-1")
+		}
+	}
+
+	if n := atomic.LoadInt32(issued); n != 1 {
+		t.Errorf("%d tokens requested, want 1", n)
+	}
+}
+
+func TestOAuth2RefreshesExpiringToken(t *testing.T) {
+	// the token expires within the expiry delta of the oauth2 package, it is
+	// refreshed on every request
+	srv, issued := tokenServer(t, 5)
+	creds := NewOAuth2(clientcredentials.Config{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		TokenURL:     srv.URL,
+	})
+
+	for _, want := range []string{"Bearer token-1", "Bearer token-2"} {
+		md, err := creds.GetRequestMetadata(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := md["authorization"]; got != want {
+			t.Errorf("authorization = %q, want %q", got, want)
+		}
+	}
+
+	if n := atomic.LoadInt32(issued); n != 2 {
+		t.Errorf("%d tokens requested, want 2", n)
+	}
+}
+
+func TestBearerTokenFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := NewBearerTokenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertToken := func(want string) {
+		t.Helper()
+		md, err := creds.GetRequestMetadata(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := md["authorization"]; got != "Bearer "+want {
+			t.Errorf("authorization = %q, want %q", got, "Bearer "+want)
+		}
+	}
+
+	assertToken("first")
+
+	// a token of the same size is picked up by its modification time
+	if err := os.WriteFile(path, []byte("other\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	assertToken("other")
+
+	// and a token of another size by its size
+	if err := os.WriteFile(path, []byte("rotated\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	assertToken("rotated")
+
+	// an empty file is an error rather than an empty token
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := creds.GetRequestMetadata(context.Background()); err == nil {
+		t.Error("empty token file accepted")
+	}
+}
+
+func TestNewBearerTokenFileMissing(t *testing.T) {
+	if _, err := NewBearerTokenFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing token file accepted")
+	}
+}
+
+func TestTransportSigV4SignsBody(t *testing.T) {
+	awsCfg := aws.Config{
+		Region: "eu-west-1",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	}
+
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{header: r.Header.Clone(), body: body}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: Transport(nil, NewSigV4(awsCfg, "aps", ""))}
+
+	const payload = `{"streams":[]}`
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/loki/api/v1/push", strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	got := <-requests
+	if string(got.body) != payload {
+		t.Fatalf("body = %q, want %q", got.body, payload)
+	}
+
+	hash := sha256.Sum256(got.body)
+	payloadHash := hex.EncodeToString(hash[:])
+	if h := got.header.Get("X-Amz-Content-Sha256"); h != payloadHash {
+		t.Errorf("X-Amz-Content-Sha256 = %q, want the hash of the body %q", h, payloadHash)
+	}
+
+	// sign the request the server received again, from the body it read, the
+	// signature must be the same
+	signingTime, err := time.Parse("20060102T150405Z", got.header.Get("X-Amz-Date"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := http.NewRequest(http.MethodPost, srv.URL+"/loki/api/v1/push", bytes.NewReader(got.body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected.Header.Set("Content-Type", "application/json")
+	expected.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	creds, _ := awsCfg.Credentials.Retrieve(context.Background())
+	if err := v4.NewSigner().SignHTTP(context.Background(), creds, expected, payloadHash, "aps", "eu-west-1", signingTime); err != nil {
+		t.Fatal(err)
+	}
+
+	if a, want := got.header.Get("Authorization"), expected.Header.Get("Authorization"); a != want {
+		t.Errorf("Authorization = %q, want %q", a, want)
+	}
+	if !strings.Contains(got.header.Get("Authorization"), "x-amz-content-sha256") {
+		t.Errorf("Authorization %q does not sign the payload hash", got.header.Get("Authorization"))
+	}
+}
+
+func TestSigV4GRPCUnsignedPayload(t *testing.T) {
+	awsCfg := aws.Config{
+		Region: "eu-west-1",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, nil
+		}),
+	}
+
+	md, err := NewSigV4(awsCfg, "aps", "").GetRequestMetadata(context.Background(), "https://collector:4317")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h := md["x-amz-content-sha256"]; h != unsignedPayload {
+		t.Errorf("x-amz-content-sha256 = %q, want %q", h, unsignedPayload)
+	}
+	if !strings.HasPrefix(md["authorization"], "AWS4-HMAC-SHA256 Credential=AKID/") {
+		t.Errorf("authorization = %q", md["authorization"])
+	}
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// BearerTokenFile sends the token read from a file as a bearer token. The
+// file is read again when its modification time or size changes, so that
+// rotated tokens, e.g. mounted secrets, are picked up.
+type BearerTokenFile struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+// Compile time check *BearerTokenFile implements credentials.PerRPCCredentials.
+var _ credentials.PerRPCCredentials = (*BearerTokenFile)(nil)
+
+// NewBearerTokenFile creates credentials reading the token from path. The
+// file is read once to fail early if it is missing.
+func NewBearerTokenFile(path string) (*BearerTokenFile, error) {
+	b := &BearerTokenFile{path: path}
+
+	if _, err := b.Token(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Token returns the current token.
+func (b *BearerTokenFile) Token() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return "", err
+	}
+
+	if b.token != "" && info.ModTime().Equal(b.modTime) && info.Size() == b.size {
+		return b.token, nil
+	}
+
+	content, err := os.ReadFile(b.path)
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("empty bearer token in %s", b.path)
+	}
+
+	b.token = token
+	b.modTime = info.ModTime()
+	b.size = info.Size()
+
+	return b.token, nil
+}
+
+func (b *BearerTokenFile) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	token, err := b.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+// RequireTransportSecurity prevents sending the token in clear text.
+func (b *BearerTokenFile) RequireTransportSecurity() bool {
+	return true
+}
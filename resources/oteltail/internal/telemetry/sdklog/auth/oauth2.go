@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"google.golang.org/grpc/credentials"
+)
+
+// OAuth2 sends an access token obtained with the OAuth2 client credentials
+// flow. The token is cached until shortly before it expires.
+type OAuth2 struct {
+	source oauth2.TokenSource
+}
+
+// Compile time check *OAuth2 implements credentials.PerRPCCredentials.
+var _ credentials.PerRPCCredentials = (*OAuth2)(nil)
+
+// NewOAuth2 creates credentials requesting tokens from cfg.TokenURL.
+func NewOAuth2(cfg clientcredentials.Config) *OAuth2 {
+	return &OAuth2{
+		// the token source outlives the requests, it must not use their
+		// context
+		source: cfg.TokenSource(context.Background()),
+	}
+}
+
+func (o *OAuth2) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	token, err := o.source.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"authorization": token.Type() + " " + token.AccessToken}, nil
+}
+
+// RequireTransportSecurity prevents sending the token in clear text.
+func (o *OAuth2) RequireTransportSecurity() bool {
+	return true
+}
@@ -2,6 +2,7 @@ package sdklog
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -46,6 +47,11 @@ type BatchLogProcessorOptions struct {
 	// The default value of MaxExportBatchSize is 512.
 	MaxExportBatchSize int
 
+	// MaxExportBatchBytes is the maximum estimated encoded size of a batch,
+	// see EstimateSize. A batch is exported before a log would push it over
+	// the limit. Zero, the default, disables the limit.
+	MaxExportBatchBytes int
+
 	// BlockOnQueueFull blocks onEnd() and onStart() method if the queue is full
 	// AND if BlockOnQueueFull is set to true.
 	// Blocking option should be used carefully as it can severely affect the performance of an
@@ -63,12 +69,25 @@ type batchLogProcessor struct {
 	dropped uint32
 
 	batch      []*LogData
+	batchBytes int
 	batchMutex sync.Mutex
 	timer      *time.Timer
 	stopWait   sync.WaitGroup
 	stopOnce   sync.Once
 	stopCh     chan struct{}
 	stopped    atomic.Bool
+	flushCh    chan flushRequest
+
+	// errs holds the errors of the exports done since the last flush.
+	errsMu sync.Mutex
+	errs   []error
+}
+
+// flushRequest asks processQueue to export everything enqueued so far within
+// the lifetime of ctx.
+type flushRequest struct {
+	ctx  context.Context
+	done chan error
 }
 
 var _ LogProcessor = (*batchLogProcessor)(nil)
@@ -99,12 +118,13 @@ func NewBatchLogProcessor(exporter LogExporter, options ...BatchLogProcessorOpti
 		opt(&o)
 	}
 	bsp := &batchLogProcessor{
-		e:      exporter,
-		o:      o,
-		batch:  make([]*LogData, 0, o.MaxExportBatchSize),
-		timer:  time.NewTimer(o.BatchTimeout),
-		queue:  make(chan *LogData, o.MaxQueueSize),
-		stopCh: make(chan struct{}),
+		e:       exporter,
+		o:       o,
+		batch:   make([]*LogData, 0, o.MaxExportBatchSize),
+		timer:   time.NewTimer(o.BatchTimeout),
+		queue:   make(chan *LogData, o.MaxQueueSize),
+		stopCh:  make(chan struct{}),
+		flushCh: make(chan flushRequest),
 	}
 
 	bsp.stopWait.Add(1)
@@ -148,6 +168,31 @@ func (bsp *batchLogProcessor) Shutdown(ctx context.Context) error {
 	return err
 }
 
+// ForceFlush exports all the logs enqueued before the call and waits until
+// the export completes or the context is done. It returns the errors of all
+// the exports done since the previous flush, including the background ones.
+func (bsp *batchLogProcessor) ForceFlush(ctx context.Context) error {
+	if bsp.stopped.Load() || bsp.e == nil {
+		return nil
+	}
+
+	done := make(chan error, 1)
+	select {
+	case bsp.flushCh <- flushRequest{ctx: ctx, done: done}:
+	case <-bsp.stopCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // WithMaxQueueSize returns a BatchSpanProcessorOption that configures the
 // maximum queue size allowed for a BatchSpanProcessor.
 func WithMaxQueueSize(size int) BatchLogProcessorOption {
@@ -164,6 +209,14 @@ func WithMaxExportBatchSize(size int) BatchLogProcessorOption {
 	}
 }
 
+// WithMaxExportBatchBytes returns a BatchLogProcessorOption that configures
+// the maximum estimated encoded size of a batch.
+func WithMaxExportBatchBytes(size int) BatchLogProcessorOption {
+	return func(o *BatchLogProcessorOptions) {
+		o.MaxExportBatchBytes = size
+	}
+}
+
 // WithBatchTimeout returns a BatchSpanProcessorOption that configures the
 // maximum delay allowed for a BatchSpanProcessor before it will export any
 // held span (whether the queue is full or not).
@@ -212,6 +265,7 @@ func (bsp *batchLogProcessor) exportSpans(ctx context.Context) error {
 		// It is up to the exporter to implement any type of retry logic if a batch is failing
 		// to be exported, since it is specific to the protocol and backend being sent to.
 		bsp.batch = bsp.batch[:0]
+		bsp.batchBytes = 0
 
 		if err != nil {
 			return err
@@ -234,19 +288,22 @@ func (bsp *batchLogProcessor) processQueue() {
 			return
 		case <-bsp.timer.C:
 			if err := bsp.exportSpans(ctx); err != nil {
-				otel.Handle(err)
+				bsp.handleError(err)
 			}
+		case req := <-bsp.flushCh:
+			err := bsp.flushQueue(req.ctx)
+			req.done <- errors.Join(append(bsp.takeErrors(), err)...)
 		case sd := <-bsp.queue:
-			bsp.batchMutex.Lock()
-			bsp.batch = append(bsp.batch, sd)
-			shouldExport := len(bsp.batch) >= bsp.o.MaxExportBatchSize
-			bsp.batchMutex.Unlock()
+			shouldExport, err := bsp.addToBatch(ctx, sd)
+			if err != nil {
+				bsp.handleError(err)
+			}
 			if shouldExport {
 				if !bsp.timer.Stop() {
 					<-bsp.timer.C
 				}
 				if err := bsp.exportSpans(ctx); err != nil {
-					otel.Handle(err)
+					bsp.handleError(err)
 				}
 			}
 		}
@@ -261,10 +318,10 @@ func (bsp *batchLogProcessor) drainQueue() {
 	for {
 		select {
 		case sd := <-bsp.queue:
-			bsp.batchMutex.Lock()
-			bsp.batch = append(bsp.batch, sd)
-			shouldExport := len(bsp.batch) == bsp.o.MaxExportBatchSize
-			bsp.batchMutex.Unlock()
+			shouldExport, err := bsp.addToBatch(ctx, sd)
+			if err != nil {
+				otel.Handle(err)
+			}
 
 			if shouldExport {
 				if err := bsp.exportSpans(ctx); err != nil {
@@ -281,6 +338,81 @@ func (bsp *batchLogProcessor) drainQueue() {
 	}
 }
 
+// flushQueue exports the logs currently enqueued and the pending batch. It is
+// a subroutine of processQueue. A failed batch does not stop the flush, the
+// errors of all the batches are returned.
+func (bsp *batchLogProcessor) flushQueue(ctx context.Context) error {
+	var errs []error
+	for {
+		select {
+		case sd := <-bsp.queue:
+			shouldExport, err := bsp.addToBatch(ctx, sd)
+			if err != nil {
+				errs = append(errs, err)
+			}
+
+			if shouldExport {
+				if err := bsp.exportSpans(ctx); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		default:
+			if err := bsp.exportSpans(ctx); err != nil {
+				errs = append(errs, err)
+			}
+			return errors.Join(errs...)
+		}
+	}
+}
+
+// addToBatch appends the log to the batch, exporting the batch first if the
+// log would push it over MaxExportBatchBytes. It reports whether the batch is
+// full and must be exported.
+func (bsp *batchLogProcessor) addToBatch(ctx context.Context, ld *LogData) (bool, error) {
+	var err error
+
+	size := EstimateSize(ld)
+
+	bsp.batchMutex.Lock()
+	overflow := bsp.o.MaxExportBatchBytes > 0 && len(bsp.batch) > 0 && bsp.batchBytes+size > bsp.o.MaxExportBatchBytes
+	bsp.batchMutex.Unlock()
+
+	if overflow {
+		err = bsp.exportSpans(ctx)
+	}
+
+	bsp.batchMutex.Lock()
+	defer bsp.batchMutex.Unlock()
+
+	bsp.batch = append(bsp.batch, ld)
+	bsp.batchBytes += size
+
+	full := len(bsp.batch) >= bsp.o.MaxExportBatchSize ||
+		(bsp.o.MaxExportBatchBytes > 0 && bsp.batchBytes >= bsp.o.MaxExportBatchBytes)
+
+	return full, err
+}
+
+// handleError reports the error of a background export and keeps it for the
+// next ForceFlush.
+func (bsp *batchLogProcessor) handleError(err error) {
+	otel.Handle(err)
+
+	bsp.errsMu.Lock()
+	bsp.errs = append(bsp.errs, err)
+	bsp.errsMu.Unlock()
+}
+
+// takeErrors returns and clears the errors of the background exports.
+func (bsp *batchLogProcessor) takeErrors() []error {
+	bsp.errsMu.Lock()
+	defer bsp.errsMu.Unlock()
+
+	errs := bsp.errs
+	bsp.errs = nil
+	return errs
+}
+
 func (bsp *batchLogProcessor) enqueue(log *LogData) {
 	ctx := context.TODO()
 
@@ -0,0 +1,97 @@
+package sdklog
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/log"
+)
+
+// batchExporter records the number of logs of each export.
+type batchExporter struct {
+	batches []int
+}
+
+func (e *batchExporter) ExportLogs(_ context.Context, logs []*LogData) error {
+	e.batches = append(e.batches, len(logs))
+	return nil
+}
+
+func (e *batchExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+func logOfSize(t *testing.T, size int) *LogData {
+	t.Helper()
+
+	ld := &LogData{}
+	ld.SetBody(log.StringValue(""))
+	ld.SetBody(log.StringValue(strings.Repeat("a", size-EstimateSize(ld))))
+	if got := EstimateSize(ld); got != size {
+		t.Fatalf("log of %d bytes, want %d", got, size)
+	}
+	return ld
+}
+
+func TestAddToBatchBytes(t *testing.T) {
+	tests := []struct {
+		name  string
+		sizes []int
+		// full is whether the batch is full after each log.
+		full []bool
+		// exported are the batches exported before a log overflowed them.
+		exported []int
+		pending  int
+	}{
+		{"under", []int{100, 100}, []bool{false, false}, nil, 2},
+		{"overflow", []int{100, 100, 100}, []bool{false, false, false}, []int{2}, 1},
+		{"exactly full", []int{100, 150}, []bool{false, true}, nil, 2},
+		// a log over the limit is sent alone rather than dropped
+		{"oversized", []int{100, 400}, []bool{false, true}, []int{1}, 1},
+		{"oversized first", []int{400}, []bool{true}, nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := &batchExporter{}
+			bsp := &batchLogProcessor{
+				e:     exporter,
+				o:     BatchLogProcessorOptions{MaxExportBatchSize: 100, MaxExportBatchBytes: 250},
+				timer: time.NewTimer(time.Hour),
+			}
+			defer bsp.timer.Stop()
+
+			size := 0
+			for i, s := range tt.sizes {
+				full, err := bsp.addToBatch(context.Background(), logOfSize(t, s))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if full != tt.full[i] {
+					t.Errorf("log %d: full = %v, want %v", i, full, tt.full[i])
+				}
+				size += s
+			}
+
+			if len(exporter.batches) != len(tt.exported) {
+				t.Fatalf("exported %v, want %v", exporter.batches, tt.exported)
+			}
+			for i, n := range exporter.batches {
+				if n != tt.exported[i] {
+					t.Errorf("exported %v, want %v", exporter.batches, tt.exported)
+				}
+				// the exported logs are all of 100 bytes
+				size -= n * 100
+			}
+
+			if len(bsp.batch) != tt.pending {
+				t.Errorf("%d logs in the batch, want %d", len(bsp.batch), tt.pending)
+			}
+			if bsp.batchBytes != size {
+				t.Errorf("batch of %d bytes, want %d", bsp.batchBytes, size)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"go.opentelemetry.io/otel/log/embedded"
 	"go.opentelemetry.io/otel/sdk/instrumentation"
 	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var _ log.Logger = &logger{}
@@ -27,9 +28,17 @@ func (l logger) Emit(ctx context.Context, r log.Record) {
 
 	traceid, _ := utils.ParseTraceID(lc.AwsRequestID)
 
+	// a trace read from the record takes precedence over the request
+	var spanid trace.SpanID
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		traceid = sc.TraceID()
+		spanid = sc.SpanID()
+	}
+
 	log := &LogData{
 		Record:   r,
 		TraceID:  traceid,
+		SpanID:   spanid,
 		Resource: l.resource,
 	}
 
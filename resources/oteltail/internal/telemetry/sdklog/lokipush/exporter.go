@@ -0,0 +1,240 @@
+// Package lokipush exports logs with the Loki push API, for deployments
+// running Loki without an OpenTelemetry collector in front of it.
+package lokipush
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/golang/snappy"
+	"github.com/grafana/loki/pkg/logproto"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/log"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+
+	"oteltail/internal/telemetry/sdklog"
+	"oteltail/internal/utils"
+)
+
+// Exporter pushes the logs as a snappy compressed logproto.PushRequest.
+//
+// The stream labels are the string attributes prefixed with __, the labels
+// oteltail attaches to the records, without the prefix, e.g. aws_log_type,
+// and the service_name resource attribute. Other attributes are not sent.
+type Exporter struct {
+	cfg    config
+	client *http.Client
+}
+
+// Compile time check *Exporter implements sdklog.LogExporter.
+var _ sdklog.LogExporter = (*Exporter)(nil)
+
+// New creates an Exporter pushing to endpoint, the URL of the push API, e.g.
+// http://loki:3100/loki/api/v1/push.
+func New(endpoint string, opts ...Option) *Exporter {
+	cfg := newConfig(endpoint, opts...)
+
+	return &Exporter{
+		cfg: cfg,
+		client: &http.Client{
+			Transport: cfg.transport,
+			Timeout:   cfg.timeout,
+		},
+	}
+}
+
+// ExportLogs pushes the logs, grouped in streams by labels.
+func (e *Exporter) ExportLogs(ctx context.Context, logs []*sdklog.LogData) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	request := pushRequest(logs)
+
+	buf, err := request.Marshal()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.endpoint, bytes.NewReader(snappy.Encode(nil, buf)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	if e.cfg.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", e.cfg.tenantID)
+	}
+	if e.cfg.username != "" {
+		req.SetBasicAuth(e.cfg.username, e.cfg.password)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("failed to push %d logs to %s: %s: %s", len(logs), e.cfg.endpoint, resp.Status, strings.TrimSpace(string(msg)))
+
+	if permanent(resp.StatusCode) {
+		// pushing the same logs again would be rejected the same way and fail
+		// every retry of the invocation
+		if e.cfg.rejected != nil {
+			return e.cfg.rejected(ctx, logs, err)
+		}
+		slog.Error("dropping logs rejected by loki", "endpoint", e.cfg.endpoint, "count", len(logs), "error", err)
+		return nil
+	}
+
+	return err
+}
+
+// permanent reports whether Loki rejected the entries of the push for good,
+// e.g. entries too old, a stream over its limits or a push too large. Other
+// statuses, such as 401, 403 or 404, come from the credentials or the
+// endpoint and the push is accepted once they are fixed, as it is after the
+// 429 of rate limiting.
+func permanent(statusCode int) bool {
+	return statusCode == http.StatusBadRequest || statusCode == http.StatusRequestEntityTooLarge
+}
+
+// Shutdown closes the idle connections.
+func (e *Exporter) Shutdown(context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// pushRequest groups the logs by labels, with the entries of each stream
+// ordered by timestamp. The streams are keyed by utils.LabelsMapToString, as
+// those of otelclient.Batch, but the Batch is not reused: otelclient imports
+// this package, and adding to a Batch applies the rate limits and metrics
+// again and may flush it.
+func pushRequest(logs []*sdklog.LogData) *logproto.PushRequest {
+	streams := make(map[string]*logproto.Stream)
+	var keys []string
+
+	for _, ld := range logs {
+		labels := streamLabels(ld)
+		key := utils.LabelsMapToString(labels)
+
+		stream, ok := streams[key]
+		if !ok {
+			stream = &logproto.Stream{Labels: key}
+			streams[key] = stream
+			keys = append(keys, key)
+		}
+
+		timestamp := ld.Timestamp()
+		if timestamp.IsZero() {
+			timestamp = ld.ObservedTimestamp()
+		}
+
+		stream.Entries = append(stream.Entries, logproto.Entry{
+			Timestamp: timestamp,
+			Line:      line(ld.Body()),
+		})
+	}
+
+	request := &logproto.PushRequest{
+		Streams: make([]logproto.Stream, 0, len(keys)),
+	}
+	for _, key := range keys {
+		stream := streams[key]
+		sort.SliceStable(stream.Entries, func(i, j int) bool {
+			return stream.Entries[i].Timestamp.Before(stream.Entries[j].Timestamp)
+		})
+		request.Streams = append(request.Streams, *stream)
+	}
+
+	return request
+}
+
+// streamLabels returns the Loki labels of a record.
+func streamLabels(ld *sdklog.LogData) model.LabelSet {
+	labels := model.LabelSet{}
+
+	if ld.Resource != nil {
+		if name, ok := ld.Resource.Set().Value(semconv.ServiceNameKey); ok {
+			labels["service_name"] = model.LabelValue(name.AsString())
+		}
+	}
+
+	ld.WalkAttributes(func(kv log.KeyValue) bool {
+		if !strings.HasPrefix(kv.Key, "__") || kv.Value.Kind() != log.KindString {
+			return true
+		}
+
+		name := model.LabelName(sanitizeLabelName(strings.TrimPrefix(kv.Key, "__")))
+		if name.IsValid() {
+			labels[name] = model.LabelValue(kv.Value.AsString())
+		}
+		return true
+	})
+
+	return labels
+}
+
+// sanitizeLabelName replaces the characters Loki does not accept in label
+// names with underscores.
+func sanitizeLabelName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// line returns the log line of a body, structured bodies are encoded as
+// JSON.
+func line(v log.Value) string {
+	if v.Kind() == log.KindString {
+		return v.AsString()
+	}
+
+	// the values of a log.Value are always encodable
+	b, _ := json.Marshal(valueToAny(v))
+	return string(b)
+}
+
+func valueToAny(v log.Value) any {
+	switch v.Kind() {
+	case log.KindBool:
+		return v.AsBool()
+	case log.KindFloat64:
+		return v.AsFloat64()
+	case log.KindInt64:
+		return v.AsInt64()
+	case log.KindString:
+		return v.AsString()
+	case log.KindBytes:
+		return v.AsBytes()
+	case log.KindSlice:
+		slice := v.AsSlice()
+		result := make([]any, len(slice))
+		for i, item := range slice {
+			result[i] = valueToAny(item)
+		}
+		return result
+	case log.KindMap:
+		result := make(map[string]any)
+		for _, kv := range v.AsMap() {
+			result[kv.Key] = valueToAny(kv.Value)
+		}
+		return result
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,161 @@
+package lokipush
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/grafana/loki/pkg/logproto"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+
+	"oteltail/internal/telemetry/sdklog"
+)
+
+func logData(body string, timestamp time.Time, attrs ...log.KeyValue) *sdklog.LogData {
+	var ld sdklog.LogData
+	ld.SetBody(log.StringValue(body))
+	ld.SetTimestamp(timestamp)
+	ld.AddAttributes(attrs...)
+	return &ld
+}
+
+func TestExportLogsStatus(t *testing.T) {
+	tests := []struct {
+		status  int
+		wantErr bool
+	}{
+		{status: http.StatusNoContent},
+		// the entries are rejected for good, the logs are dropped
+		{status: http.StatusBadRequest},
+		{status: http.StatusRequestEntityTooLarge},
+		// the credentials or the endpoint are wrong, the push is retried
+		{status: http.StatusUnauthorized, wantErr: true},
+		{status: http.StatusForbidden, wantErr: true},
+		{status: http.StatusNotFound, wantErr: true},
+		{status: http.StatusTooManyRequests, wantErr: true},
+		{status: http.StatusInternalServerError, wantErr: true},
+		{status: http.StatusServiceUnavailable, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			ld := logData("line", time.Unix(1, 0), log.String("__aws_log_type", "cloudwatch"))
+
+			err := New(srv.URL).ExportLogs(context.Background(), []*sdklog.LogData{ld})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExportLogs = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExportLogsRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "entry too far behind", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	errSink := errors.New("sink unavailable")
+	var rejected []*sdklog.LogData
+	e := New(srv.URL, WithRejected(func(_ context.Context, logs []*sdklog.LogData, err error) error {
+		rejected = logs
+		return errSink
+	}))
+
+	ld := logData("line", time.Unix(1, 0), log.String("__aws_log_type", "cloudwatch"))
+	if err := e.ExportLogs(context.Background(), []*sdklog.LogData{ld}); !errors.Is(err, errSink) {
+		t.Errorf("ExportLogs = %v, want the error of the rejected handler", err)
+	}
+	if len(rejected) != 1 || rejected[0] != ld {
+		t.Errorf("rejected %v, want the pushed logs", rejected)
+	}
+}
+
+func TestExportLogsPayload(t *testing.T) {
+	var (
+		request  logproto.PushRequest
+		header   http.Header
+		username string
+		password string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		username, password, _ = r.BasicAuth()
+
+		compressed, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		buf, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Error(err)
+		}
+		if err := request.Unmarshal(buf); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	res := resource.NewSchemaless(semconv.ServiceNameKey.String("oteltail"))
+	logs := []*sdklog.LogData{
+		logData("second", time.Unix(2, 0), log.String("__aws_log_type", "cloudwatch"), log.String("__aws_cloudwatch.log_group", "/app"), log.String("level", "info")),
+		logData("s3", time.Unix(1, 0), log.String("__aws_log_type", "s3_lb")),
+		logData("first", time.Unix(1, 0), log.String("__aws_log_type", "cloudwatch"), log.String("__aws_cloudwatch.log_group", "/app")),
+	}
+	for _, ld := range logs {
+		ld.Resource = res
+	}
+
+	e := New(srv.URL, WithTenantID("team-a"), WithBasicAuth("user", "secret"))
+	if err := e.ExportLogs(context.Background(), logs); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := header.Get("X-Scope-OrgID"); got != "team-a" {
+		t.Errorf("X-Scope-OrgID = %q, want team-a", got)
+	}
+	if got := header.Get("Content-Type"); got != "application/x-protobuf" {
+		t.Errorf("Content-Type = %q, want application/x-protobuf", got)
+	}
+	if username != "user" || password != "secret" {
+		t.Errorf("basic auth = %q:%q, want user:secret", username, password)
+	}
+
+	want := []struct {
+		labels string
+		lines  []string
+	}{
+		{labels: `{aws_cloudwatch_log_group="/app", aws_log_type="cloudwatch", service_name="oteltail"}`, lines: []string{"first", "second"}},
+		{labels: `{aws_log_type="s3_lb", service_name="oteltail"}`, lines: []string{"s3"}},
+	}
+	if len(request.Streams) != len(want) {
+		t.Fatalf("pushed %d streams, want %d: %v", len(request.Streams), len(want), request.Streams)
+	}
+	for i, stream := range request.Streams {
+		if stream.Labels != want[i].labels {
+			t.Errorf("stream %d labels = %s, want %s", i, stream.Labels, want[i].labels)
+		}
+		if len(stream.Entries) != len(want[i].lines) {
+			t.Errorf("stream %d has %d entries, want %d", i, len(stream.Entries), len(want[i].lines))
+			continue
+		}
+		for j, entry := range stream.Entries {
+			if entry.Line != want[i].lines[j] {
+				t.Errorf("stream %d entry %d = %q, want %q", i, j, entry.Line, want[i].lines[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package lokipush
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"oteltail/internal/telemetry/sdklog"
+)
+
+// DefaultTimeout bounds each push unless WithTimeout is used.
+const DefaultTimeout = 10 * time.Second
+
+// Option configures the Exporter.
+type Option func(cfg *config)
+
+type config struct {
+	endpoint  string
+	tenantID  string
+	username  string
+	password  string
+	timeout   time.Duration
+	transport http.RoundTripper
+	rejected  RejectedFunc
+}
+
+// RejectedFunc is called with the logs of a push Loki rejected for good and
+// the error of the push. The export fails with the error it returns.
+type RejectedFunc func(ctx context.Context, logs []*sdklog.LogData, err error) error
+
+func newConfig(endpoint string, opts ...Option) config {
+	cfg := config{
+		endpoint:  endpoint,
+		timeout:   DefaultTimeout,
+		transport: http.DefaultTransport,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithTenantID sets the X-Scope-OrgID header of multi-tenant Loki
+// deployments.
+func WithTenantID(tenantID string) Option {
+	return func(cfg *config) {
+		cfg.tenantID = tenantID
+	}
+}
+
+// WithBasicAuth authenticates the pushes with HTTP basic auth, as expected
+// by Grafana Cloud and most Loki gateways.
+func WithBasicAuth(username, password string) Option {
+	return func(cfg *config) {
+		cfg.username = username
+		cfg.password = password
+	}
+}
+
+// WithTimeout bounds each push. By default DefaultTimeout is used.
+func WithTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.timeout = d
+	}
+}
+
+// WithRejected hands the logs Loki rejects for good, e.g. to a dead-letter
+// sink. By default they are logged and dropped.
+func WithRejected(fn RejectedFunc) Option {
+	return func(cfg *config) {
+		cfg.rejected = fn
+	}
+}
+
+// WithTransport sets the RoundTripper used for the pushes, e.g. one with a
+// custom TLS configuration or an auth.Transport. By default
+// http.DefaultTransport is used.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(cfg *config) {
+		cfg.transport = rt
+	}
+}
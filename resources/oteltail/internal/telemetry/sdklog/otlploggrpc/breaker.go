@@ -0,0 +1,176 @@
+package otlploggrpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/status"
+)
+
+// ErrCircuitOpen is returned instead of exporting while the collector is
+// considered down. It is a transient error: the invocation should fail and
+// be retried by the event source once the collector recovers.
+var ErrCircuitOpen = errors.New("collector circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker stops the exports after failures consecutive failed exports. It
+// stays open for openTimeout, doubled after each failed probe up to
+// maxOpenTimeout, or for the throttle delay requested by the collector if
+// longer. Once the delay elapsed a single export probes the collector, the
+// others still fail fast, and closes the breaker if it succeeds. The outcome
+// of the exports admitted before the breaker opened is ignored, only the
+// probe decides.
+type breaker struct {
+	failures       int
+	openTimeout    time.Duration
+	maxOpenTimeout time.Duration
+
+	mu        sync.Mutex
+	state     breakerState
+	failed    int
+	openFor   time.Duration
+	openUntil time.Time
+	// generation is incremented each time the breaker opens.
+	generation uint64
+}
+
+// admission is an export allowed by the breaker.
+type admission struct {
+	// probe is set for the single export of a half-open breaker.
+	probe bool
+	// generation is that of the breaker when the export was allowed.
+	generation uint64
+}
+
+func newBreaker(failures int, openTimeout, maxOpenTimeout time.Duration) *breaker {
+	if maxOpenTimeout < openTimeout {
+		maxOpenTimeout = openTimeout
+	}
+
+	return &breaker{
+		failures:       failures,
+		openTimeout:    openTimeout,
+		maxOpenTimeout: maxOpenTimeout,
+	}
+}
+
+// allow reports whether an export may be sent, and returns its admission to
+// hand to done.
+func (b *breaker) allow() (admission, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Now().Before(b.openUntil) {
+			return admission{}, false
+		}
+		b.state = breakerHalfOpen
+		return admission{probe: true, generation: b.generation}, true
+	case breakerHalfOpen:
+		// a probe is in flight
+		return admission{}, false
+	default:
+		return admission{generation: b.generation}, true
+	}
+}
+
+// open reports whether exports currently fail fast.
+func (b *breaker) open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state == breakerHalfOpen || (b.state == breakerOpen && time.Now().Before(b.openUntil))
+}
+
+// done records the outcome of an export allowed by allow.
+func (b *breaker) done(err error, a admission, endpoint string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !a.probe && a.generation != b.generation {
+		// sent before the breaker opened, it tells nothing about the
+		// collector since then
+		return
+	}
+
+	if err == nil || !outage(err) {
+		if b.state != breakerClosed {
+			slog.Info("collector circuit breaker closed", "endpoint", endpoint)
+		}
+		b.state = breakerClosed
+		b.failed = 0
+		b.openFor = 0
+		return
+	}
+
+	b.failed++
+	if !a.probe && b.failed < b.failures {
+		return
+	}
+
+	switch {
+	case b.openFor == 0:
+		b.openFor = b.openTimeout
+	case a.probe:
+		b.openFor = min(2*b.openFor, b.maxOpenTimeout)
+	}
+
+	delay := b.openFor
+	if throttle := throttleOf(err); throttle > delay {
+		delay = throttle
+	}
+
+	b.state = breakerOpen
+	b.openUntil = time.Now().Add(delay)
+	b.generation++
+	slog.Warn("collector circuit breaker open", "endpoint", endpoint, "for", delay.String(), "error", err)
+}
+
+// outage reports whether err, returned once the retries were exhausted,
+// means the collector is unreachable or overloaded rather than the request
+// being invalid.
+func outage(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	s, ok := statusOf(err)
+	if !ok {
+		return false
+	}
+
+	retry, _ := retryableGRPCStatus(s)
+	return retry
+}
+
+// throttleOf returns the delay requested by the collector with RetryInfo.
+func throttleOf(err error) time.Duration {
+	s, ok := statusOf(err)
+	if !ok {
+		return 0
+	}
+
+	_, d := throttleDelay(s)
+	return d
+}
+
+// statusOf returns the gRPC status of err, which may be wrapped by the retry
+// logic.
+func statusOf(err error) (*status.Status, bool) {
+	var se interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &se) {
+		return nil, false
+	}
+	return se.GRPCStatus(), true
+}
@@ -0,0 +1,146 @@
+package otlploggrpc
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var errUnavailable = status.Error(codes.Unavailable, "collector down")
+
+// trip fails n exports.
+func trip(t *testing.T, b *breaker, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		a, ok := b.allow()
+		if !ok {
+			t.Fatalf("export %d not allowed", i)
+		}
+		b.done(errUnavailable, a, "test")
+	}
+}
+
+// probe waits for the breaker to be half-open and returns the admission of
+// its probe.
+func probe(t *testing.T, b *breaker) admission {
+	t.Helper()
+	time.Sleep(time.Until(b.openUntil))
+	a, ok := b.allow()
+	if !ok || !a.probe {
+		t.Fatalf("allow = %v, %v, want a probe", a, ok)
+	}
+	return a
+}
+
+func TestBreakerOpensAfterFailures(t *testing.T) {
+	b := newBreaker(3, time.Hour, time.Hour)
+
+	trip(t, b, 2)
+	if b.open() {
+		t.Fatal("open after 2 failures, want 3")
+	}
+
+	// the collector rejecting a request is not an outage
+	a, _ := b.allow()
+	b.done(status.Error(codes.InvalidArgument, "invalid"), a, "test")
+	trip(t, b, 2)
+	if b.open() {
+		t.Fatal("open, want the failures reset by the rejected request")
+	}
+
+	trip(t, b, 1)
+	if !b.open() {
+		t.Fatal("closed after 3 failures")
+	}
+	if _, ok := b.allow(); ok {
+		t.Error("export allowed while open")
+	}
+}
+
+func TestBreakerSingleProbe(t *testing.T) {
+	b := newBreaker(1, time.Millisecond, time.Millisecond)
+	trip(t, b, 1)
+
+	probe(t, b)
+	if _, ok := b.allow(); ok {
+		t.Error("second export allowed while the probe is in flight")
+	}
+	if !b.open() {
+		t.Error("half-open breaker not reported open")
+	}
+}
+
+func TestBreakerProbeDoubles(t *testing.T) {
+	b := newBreaker(1, 10*time.Millisecond, 25*time.Millisecond)
+	trip(t, b, 1)
+
+	for _, want := range []time.Duration{20 * time.Millisecond, 25 * time.Millisecond, 25 * time.Millisecond} {
+		b.done(errUnavailable, probe(t, b), "test")
+		if b.openFor != want {
+			t.Errorf("open for %v after a failed probe, want %v", b.openFor, want)
+		}
+	}
+}
+
+func TestBreakerThrottle(t *testing.T) {
+	b := newBreaker(1, time.Millisecond, time.Millisecond)
+
+	s, err := status.New(codes.Unavailable, "slow down").WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, _ := b.allow()
+	b.done(s.Err(), a, "test")
+
+	if until := time.Until(b.openUntil); until < 59*time.Minute {
+		t.Errorf("open for %v, want the hour requested by the collector", until)
+	}
+}
+
+func TestBreakerClosesOnSuccess(t *testing.T) {
+	b := newBreaker(1, time.Millisecond, time.Millisecond)
+	trip(t, b, 1)
+
+	b.done(nil, probe(t, b), "test")
+
+	if b.open() || b.state != breakerClosed || b.failed != 0 || b.openFor != 0 {
+		t.Errorf("breaker state %v, %d failed, open for %v, want closed and reset", b.state, b.failed, b.openFor)
+	}
+	if a, ok := b.allow(); !ok || a.probe {
+		t.Errorf("allow = %v, %v, want a regular export", a, ok)
+	}
+}
+
+func TestBreakerIgnoresExportsAdmittedBeforeOpening(t *testing.T) {
+	b := newBreaker(2, time.Millisecond, time.Millisecond)
+
+	late, _ := b.allow()
+	trip(t, b, 2)
+	a := probe(t, b)
+	openUntil := b.openUntil
+
+	// the export admitted before the breaker opened fails while the probe
+	// is in flight
+	b.done(errUnavailable, late, "test")
+	if b.state != breakerHalfOpen || !b.openUntil.Equal(openUntil) {
+		t.Fatalf("breaker state %v until %v, want half-open until %v", b.state, b.openUntil, openUntil)
+	}
+
+	b.done(nil, a, "test")
+	if b.state != breakerClosed {
+		t.Errorf("breaker state %v after a successful probe, want closed", b.state)
+	}
+
+	// nor does it count once the breaker closed again
+	b.done(errUnavailable, late, "test")
+	if b.failed != 0 {
+		t.Errorf("%d failures after the breaker closed, want 0", b.failed)
+	}
+}
@@ -19,11 +19,13 @@ import (
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	"go.opentelemetry.io/otel"
 	collogpb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
 )
 
 type Client struct {
@@ -32,6 +34,11 @@ type Client struct {
 	metadata      metadata.MD
 	exportTimeout time.Duration
 	requestFunc   retry.RequestFunc
+	// maxSendBytes is the size above which requests are split, 0 if they are
+	// never split.
+	maxSendBytes int
+	// breaker is nil unless WithCircuitBreaker is used.
+	breaker *breaker
 
 	// stopCtx is used as a parent context for all exports. Therefore, when it
 	// is canceled with the stopFunc all exports are canceled.
@@ -59,17 +66,22 @@ func NewClient(opts ...Option) *Client {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	c := &Client{
-		endpoint:      cfg.Traces.Endpoint,
-		exportTimeout: cfg.Traces.Timeout,
+		endpoint:      cfg.Logs.Endpoint,
+		exportTimeout: cfg.Logs.Timeout,
 		requestFunc:   cfg.RetryConfig.RequestFunc(retryable),
+		maxSendBytes:  cfg.MaxSendMsgSize,
 		dialOpts:      cfg.DialOptions,
 		stopCtx:       ctx,
 		stopFunc:      cancel,
 		conn:          cfg.GRPCConn,
 	}
 
-	if len(cfg.Traces.Headers) > 0 {
-		c.metadata = metadata.New(cfg.Traces.Headers)
+	if len(cfg.Logs.Headers) > 0 {
+		c.metadata = metadata.New(cfg.Logs.Headers)
+	}
+
+	if cfg.Breaker != nil {
+		c.breaker = newBreaker(cfg.Breaker.Failures, cfg.Breaker.OpenTimeout, cfg.Breaker.MaxOpenTimeout)
 	}
 
 	return c
@@ -173,6 +185,14 @@ var errShutdown = errors.New("the client is shutdown")
 // Retryable errors from the server will be handled according to any
 // RetryConfig the client was created with.
 func (c *Client) ExportLogs(ctx context.Context, logDatas []*sdklog.LogData) error {
+	return c.ExportResourceLogs(ctx, transform.Logs(logDatas))
+}
+
+// ExportResourceLogs sends logs already converted to OTLP, e.g. logs which
+// were persisted before being exported. Logs above the max send message size
+// are sent in several requests within the timeout of a single export. If
+// some of them fail, an *UnsentError holding their logs is returned.
+func (c *Client) ExportResourceLogs(ctx context.Context, resourceLogs []*logspb.ResourceLogs) error {
 	// Hold a read lock to ensure a shut down initiated after this starts does
 	// not abandon the export. This read lock acquire has less priority than a
 	// write lock acquire (i.e. Stop), meaning if the client is shutting down
@@ -185,12 +205,73 @@ func (c *Client) ExportLogs(ctx context.Context, logDatas []*sdklog.LogData) err
 		return errShutdown
 	}
 
+	c.checkConn()
+
+	if c.maxSendBytes <= 0 {
+		return c.export(ctx, resourceLogs)
+	}
+
+	// the requests share the deadline of the export
 	ctx, cancel := c.exportContext(ctx)
 	defer cancel()
 
-	return c.requestFunc(ctx, func(iCtx context.Context) error {
+	var (
+		unsent []*logspb.ResourceLogs
+		errs   []error
+	)
+	for _, part := range splitResourceLogs(resourceLogs, c.maxSendBytes) {
+		if err := c.export(ctx, part); err != nil {
+			unsent = append(unsent, part...)
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return &UnsentError{Unsent: unsent, Err: errors.Join(errs...)}
+}
+
+// CircuitOpen reports whether the exports currently fail fast with
+// ErrCircuitOpen.
+func (c *Client) CircuitOpen() bool {
+	return c.breaker != nil && c.breaker.open()
+}
+
+// export sends a single request through the circuit breaker, c.lscMu must be
+// held.
+func (c *Client) export(ctx context.Context, resourceLogs []*logspb.ResourceLogs) error {
+	if c.breaker == nil {
+		return c.send(ctx, resourceLogs, c.requestFunc)
+	}
+
+	a, allowed := c.breaker.allow()
+	if !allowed {
+		return ErrCircuitOpen
+	}
+
+	requestFunc := c.requestFunc
+	if a.probe {
+		// a probe is a single attempt, the breaker handles the backoff
+		requestFunc = func(ctx context.Context, fn func(context.Context) error) error {
+			return fn(ctx)
+		}
+	}
+
+	err := c.send(ctx, resourceLogs, requestFunc)
+	c.breaker.done(err, a, c.endpoint)
+
+	return err
+}
+
+// send sends a single request, retried by requestFunc.
+func (c *Client) send(ctx context.Context, resourceLogs []*logspb.ResourceLogs, requestFunc retry.RequestFunc) error {
+	ctx, cancel := c.exportContext(ctx)
+	defer cancel()
+
+	return requestFunc(ctx, func(iCtx context.Context) error {
 		resp, err := c.lsc.Export(iCtx, &collogpb.ExportLogsServiceRequest{
-			ResourceLogs: transform.Logs(logDatas),
+			ResourceLogs: resourceLogs,
 		})
 		if resp != nil && resp.PartialSuccess != nil {
 			msg := resp.PartialSuccess.GetErrorMessage()
@@ -209,6 +290,24 @@ func (c *Client) ExportLogs(ctx context.Context, logDatas []*sdklog.LogData) err
 	})
 }
 
+// checkConn wakes up a connection left idle, e.g. after the collector closed
+// it while the function was frozen between invocations, and skips the
+// reconnection backoff of a failed connection so the export does not fail
+// fast with Unavailable. The caller must hold c.lscMu.
+func (c *Client) checkConn() {
+	if !c.ourConn {
+		return
+	}
+
+	switch state := c.conn.GetState(); state {
+	case connectivity.Idle:
+		c.conn.Connect()
+	case connectivity.TransientFailure:
+		slog.Debug("reconnecting gRPC log client", "endpoint", c.endpoint, "state", state.String())
+		c.conn.ResetConnectBackoff()
+	}
+}
+
 // Shutdown is an alias for Stop.
 func (c *Client) Shutdown(ctx context.Context) error {
 	return c.Stop(ctx)
@@ -276,6 +375,16 @@ func retryableGRPCStatus(s *status.Status) (bool, time.Duration) {
 	return false, 0
 }
 
+// Permanent reports whether err is the collector rejecting a request as
+// invalid. Sending the same logs again would fail the same way.
+func Permanent(err error) bool {
+	var se interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &se) {
+		return false
+	}
+	return se.GRPCStatus().Code() == codes.InvalidArgument
+}
+
 // throttleDelay returns of the status is RetryInfo
 // and the its duration to wait for if an explicit throttle time.
 func throttleDelay(s *status.Status) (bool, time.Duration) {
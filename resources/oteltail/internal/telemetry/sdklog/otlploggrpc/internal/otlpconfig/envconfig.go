@@ -22,7 +22,7 @@ var DefaultEnvOptionsReader = envconfig.EnvOptionsReader{
 	Namespace: "OTEL_EXPORTER_OTLP",
 }
 
-// ApplyGRPCEnvConfigs applies the env configurations for gRPC.
+// ApplyGRPCEnvConfigs applies the generic env configurations for gRPC.
 func ApplyGRPCEnvConfigs(cfg Config) Config {
 	opts := getOptionsFromEnv()
 	for _, opt := range opts {
@@ -31,7 +31,7 @@ func ApplyGRPCEnvConfigs(cfg Config) Config {
 	return cfg
 }
 
-// ApplyHTTPEnvConfigs applies the env configurations for HTTP.
+// ApplyHTTPEnvConfigs applies the generic env configurations for HTTP.
 func ApplyHTTPEnvConfigs(cfg Config) Config {
 	opts := getOptionsFromEnv()
 	for _, opt := range opts {
@@ -40,6 +40,30 @@ func ApplyHTTPEnvConfigs(cfg Config) Config {
 	return cfg
 }
 
+// ApplyGRPCLogsEnvConfigs applies the logs specific env configurations for
+// gRPC. They are applied after the options, so that they take precedence over
+// them.
+func ApplyGRPCLogsEnvConfigs(cfg Config) Config {
+	opts := getLogsOptionsFromEnv()
+	for _, opt := range opts {
+		cfg = opt.ApplyGRPCOption(cfg)
+	}
+	return cfg
+}
+
+// ApplyHTTPLogsEnvConfigs applies the logs specific env configurations for
+// HTTP. They are applied after the options, so that they take precedence over
+// them.
+func ApplyHTTPLogsEnvConfigs(cfg Config) Config {
+	opts := getLogsOptionsFromEnv()
+	for _, opt := range opts {
+		cfg = opt.ApplyHTTPOption(cfg)
+	}
+	return cfg
+}
+
+// getOptionsFromEnv returns the options set by the variables shared by all
+// the signals.
 func getOptionsFromEnv() []GenericOption {
 	opts := []GenericOption{}
 
@@ -50,18 +74,42 @@ func getOptionsFromEnv() []GenericOption {
 		envconfig.WithURL("ENDPOINT", func(u *url.URL) {
 			opts = append(opts, withEndpointScheme(u))
 			opts = append(opts, newSplitOption(func(cfg Config) Config {
-				cfg.Traces.Endpoint = u.Host
+				cfg.Logs.Endpoint = u.Host
 				// For OTLP/HTTP endpoint URLs without a per-signal
 				// configuration, the passed endpoint is used as a base URL
 				// and the signals are sent to these paths relative to that.
-				cfg.Traces.URLPath = path.Join(u.Path, DefaultLogsPath)
+				cfg.Logs.URLPath = path.Join(u.Path, DefaultLogsPath)
 				return cfg
 			}, withEndpointForGRPC(u)))
 		}),
-		envconfig.WithURL("TRACES_ENDPOINT", func(u *url.URL) {
+		envconfig.WithCertPool("CERTIFICATE", func(p *x509.CertPool) { tlsConf.RootCAs = p }),
+		envconfig.WithClientCert("CLIENT_CERTIFICATE", "CLIENT_KEY", func(c tls.Certificate) { tlsConf.Certificates = []tls.Certificate{c} }),
+		withTLSConfig(tlsConf, func(c *tls.Config) { opts = append(opts, WithTLSClientConfig(c)) }),
+		envconfig.WithBool("INSECURE", func(b bool) { opts = append(opts, withInsecure(b)) }),
+		envconfig.WithHeaders("HEADERS", func(h map[string]string) { opts = append(opts, WithHeaders(h)) }),
+		WithEnvCompression("COMPRESSION", func(c Compression) { opts = append(opts, WithCompression(c)) }),
+		envconfig.WithDuration("TIMEOUT", func(d time.Duration) { opts = append(opts, WithTimeout(d)) }),
+	)
+
+	return opts
+}
+
+// getLogsOptionsFromEnv returns the options set by the OTEL_EXPORTER_OTLP_LOGS_*
+// variables.
+func getLogsOptionsFromEnv() []GenericOption {
+	opts := []GenericOption{}
+
+	// The logs certificates are combined with the generic ones, e.g. a logs
+	// client certificate with the generic CA.
+	tlsConf := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	logsTLS := false
+	DefaultEnvOptionsReader.Apply(
+		envconfig.WithURL("LOGS_ENDPOINT", func(u *url.URL) {
 			opts = append(opts, withEndpointScheme(u))
 			opts = append(opts, newSplitOption(func(cfg Config) Config {
-				cfg.Traces.Endpoint = u.Host
+				cfg.Logs.Endpoint = u.Host
 				// For endpoint URLs for OTLP/HTTP per-signal variables, the
 				// URL MUST be used as-is without any modification. The only
 				// exception is that if an URL contains no path part, the root
@@ -70,23 +118,29 @@ func getOptionsFromEnv() []GenericOption {
 				if path == "" {
 					path = "/"
 				}
-				cfg.Traces.URLPath = path
+				cfg.Logs.URLPath = path
 				return cfg
 			}, withEndpointForGRPC(u)))
 		}),
 		envconfig.WithCertPool("CERTIFICATE", func(p *x509.CertPool) { tlsConf.RootCAs = p }),
-		envconfig.WithCertPool("TRACES_CERTIFICATE", func(p *x509.CertPool) { tlsConf.RootCAs = p }),
 		envconfig.WithClientCert("CLIENT_CERTIFICATE", "CLIENT_KEY", func(c tls.Certificate) { tlsConf.Certificates = []tls.Certificate{c} }),
-		envconfig.WithClientCert("TRACES_CLIENT_CERTIFICATE", "TRACES_CLIENT_KEY", func(c tls.Certificate) { tlsConf.Certificates = []tls.Certificate{c} }),
-		withTLSConfig(tlsConf, func(c *tls.Config) { opts = append(opts, WithTLSClientConfig(c)) }),
-		envconfig.WithBool("INSECURE", func(b bool) { opts = append(opts, withInsecure(b)) }),
-		envconfig.WithBool("TRACES_INSECURE", func(b bool) { opts = append(opts, withInsecure(b)) }),
-		envconfig.WithHeaders("HEADERS", func(h map[string]string) { opts = append(opts, WithHeaders(h)) }),
-		envconfig.WithHeaders("TRACES_HEADERS", func(h map[string]string) { opts = append(opts, WithHeaders(h)) }),
-		WithEnvCompression("COMPRESSION", func(c Compression) { opts = append(opts, WithCompression(c)) }),
-		WithEnvCompression("TRACES_COMPRESSION", func(c Compression) { opts = append(opts, WithCompression(c)) }),
-		envconfig.WithDuration("TIMEOUT", func(d time.Duration) { opts = append(opts, WithTimeout(d)) }),
-		envconfig.WithDuration("TRACES_TIMEOUT", func(d time.Duration) { opts = append(opts, WithTimeout(d)) }),
+		envconfig.WithCertPool("LOGS_CERTIFICATE", func(p *x509.CertPool) {
+			tlsConf.RootCAs = p
+			logsTLS = true
+		}),
+		envconfig.WithClientCert("LOGS_CLIENT_CERTIFICATE", "LOGS_CLIENT_KEY", func(c tls.Certificate) {
+			tlsConf.Certificates = []tls.Certificate{c}
+			logsTLS = true
+		}),
+		func(*envconfig.EnvOptionsReader) {
+			if logsTLS {
+				opts = append(opts, WithTLSClientConfig(tlsConf))
+			}
+		},
+		envconfig.WithBool("LOGS_INSECURE", func(b bool) { opts = append(opts, withInsecure(b)) }),
+		envconfig.WithHeaders("LOGS_HEADERS", func(h map[string]string) { opts = append(opts, WithHeaders(h)) }),
+		WithEnvCompression("LOGS_COMPRESSION", func(c Compression) { opts = append(opts, WithCompression(c)) }),
+		envconfig.WithDuration("LOGS_TIMEOUT", func(d time.Duration) { opts = append(opts, WithTimeout(d)) }),
 	)
 
 	return opts
@@ -105,7 +159,7 @@ func withEndpointForGRPC(u *url.URL) func(cfg Config) Config {
 	return func(cfg Config) Config {
 		// For OTLP/gRPC endpoints, this is the target to which the
 		// exporter is going to send telemetry.
-		cfg.Traces.Endpoint = path.Join(u.Host, u.Path)
+		cfg.Logs.Endpoint = path.Join(u.Host, u.Path)
 		return cfg
 	}
 }
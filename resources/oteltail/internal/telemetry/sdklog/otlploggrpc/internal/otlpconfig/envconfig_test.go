@@ -0,0 +1,285 @@
+package otlpconfig
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// useEnv makes the env readers see env only, for the duration of the test.
+func useEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	getEnv := DefaultEnvOptionsReader.GetEnv
+	DefaultEnvOptionsReader.GetEnv = func(key string) string { return env[key] }
+	t.Cleanup(func() { DefaultEnvOptionsReader.GetEnv = getEnv })
+}
+
+// testCert is a self-signed certificate written to PEM files.
+type testCert struct {
+	der      []byte
+	certFile string
+	keyFile  string
+}
+
+func newTestCert(t *testing.T, name string) testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	c := testCert{
+		der:      der,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	if err := os.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (c testCert) pool(t *testing.T) *x509.CertPool {
+	t.Helper()
+	cert, err := x509.ParseCertificate(c.der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := x509.NewCertPool()
+	p.AddCert(cert)
+	return p
+}
+
+func TestGRPCConfigEnvPrecedence(t *testing.T) {
+	// WithEndpointURL and WithHeaders stand for the OTELTAIL settings
+	opts := []GRPCOption{
+		WithEndpointURL("http://oteltail:4317"),
+		WithHeaders(map[string]string{"from": "oteltail"}),
+	}
+
+	tests := []struct {
+		name        string
+		env         map[string]string
+		opts        []GRPCOption
+		wantEnd     string
+		wantHeaders map[string]string
+		wantInsec   bool
+	}{
+		{
+			name: "generic",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "https://generic:4317",
+				"OTEL_EXPORTER_OTLP_HEADERS":  "from=generic",
+			},
+			wantEnd:     "generic:4317",
+			wantHeaders: map[string]string{"from": "generic"},
+		},
+		{
+			name: "options over generic",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "https://generic:4317",
+				"OTEL_EXPORTER_OTLP_HEADERS":  "from=generic",
+			},
+			opts:        opts,
+			wantEnd:     "oteltail:4317",
+			wantHeaders: map[string]string{"from": "oteltail"},
+			wantInsec:   true,
+		},
+		{
+			name: "logs over options",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":      "https://generic:4317",
+				"OTEL_EXPORTER_OTLP_HEADERS":       "from=generic",
+				"OTEL_EXPORTER_OTLP_LOGS_ENDPOINT": "https://logs:4317",
+				"OTEL_EXPORTER_OTLP_LOGS_HEADERS":  "from=logs",
+			},
+			opts:        opts,
+			wantEnd:     "logs:4317",
+			wantHeaders: map[string]string{"from": "logs"},
+		},
+		{
+			name: "logs endpoint only",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_LOGS_ENDPOINT": "http://logs:4317",
+			},
+			opts:        opts,
+			wantEnd:     "logs:4317",
+			wantHeaders: map[string]string{"from": "oteltail"},
+			wantInsec:   true,
+		},
+		{
+			name: "ignored",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":      "https://generic:4317",
+				"OTEL_EXPORTER_OTLP_HEADERS":       "from=generic",
+				"OTEL_EXPORTER_OTLP_LOGS_ENDPOINT": "https://logs:4317",
+				"OTEL_EXPORTER_OTLP_LOGS_HEADERS":  "from=logs",
+				"OTEL_EXPORTER_OTLP_LOGS_INSECURE": "false",
+			},
+			opts: append([]GRPCOption{NewGRPCOption(func(cfg Config) Config {
+				cfg.IgnoreEnv = true
+				return cfg
+			})}, opts...),
+			wantEnd:     "oteltail:4317",
+			wantHeaders: map[string]string{"from": "oteltail"},
+			wantInsec:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useEnv(t, tt.env)
+
+			cfg := NewGRPCConfig(tt.opts...)
+			if cfg.Logs.Endpoint != tt.wantEnd {
+				t.Errorf("endpoint = %q, want %q", cfg.Logs.Endpoint, tt.wantEnd)
+			}
+			if !reflect.DeepEqual(cfg.Logs.Headers, tt.wantHeaders) {
+				t.Errorf("headers = %v, want %v", cfg.Logs.Headers, tt.wantHeaders)
+			}
+			if cfg.Logs.Insecure != tt.wantInsec {
+				t.Errorf("insecure = %v, want %v", cfg.Logs.Insecure, tt.wantInsec)
+			}
+		})
+	}
+}
+
+func TestEnvTLS(t *testing.T) {
+	generic := newTestCert(t, "generic")
+	logs := newTestCert(t, "logs")
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		// the CA and the client certificate of the config, nil if unset
+		wantCA         *testCert
+		wantClient     *testCert
+		wantLogsConfig bool
+	}{
+		{
+			name: "generic",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_CERTIFICATE":        generic.certFile,
+				"OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE": generic.certFile,
+				"OTEL_EXPORTER_OTLP_CLIENT_KEY":         generic.keyFile,
+			},
+			wantCA:     &generic,
+			wantClient: &generic,
+		},
+		{
+			name: "generic CA and logs client certificate",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_CERTIFICATE":             generic.certFile,
+				"OTEL_EXPORTER_OTLP_LOGS_CLIENT_CERTIFICATE": logs.certFile,
+				"OTEL_EXPORTER_OTLP_LOGS_CLIENT_KEY":         logs.keyFile,
+			},
+			wantCA:         &generic,
+			wantClient:     &logs,
+			wantLogsConfig: true,
+		},
+		{
+			name: "logs CA and generic client certificate",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_LOGS_CERTIFICATE":   logs.certFile,
+				"OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE": generic.certFile,
+				"OTEL_EXPORTER_OTLP_CLIENT_KEY":         generic.keyFile,
+			},
+			wantCA:         &logs,
+			wantClient:     &generic,
+			wantLogsConfig: true,
+		},
+		{
+			name: "logs over generic",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_CERTIFICATE":             generic.certFile,
+				"OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE":      generic.certFile,
+				"OTEL_EXPORTER_OTLP_CLIENT_KEY":              generic.keyFile,
+				"OTEL_EXPORTER_OTLP_LOGS_CERTIFICATE":        logs.certFile,
+				"OTEL_EXPORTER_OTLP_LOGS_CLIENT_CERTIFICATE": logs.certFile,
+				"OTEL_EXPORTER_OTLP_LOGS_CLIENT_KEY":         logs.keyFile,
+			},
+			wantCA:         &logs,
+			wantClient:     &logs,
+			wantLogsConfig: true,
+		},
+		{
+			name: "logs client certificate without its key",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_CERTIFICATE":             generic.certFile,
+				"OTEL_EXPORTER_OTLP_LOGS_CLIENT_CERTIFICATE": logs.certFile,
+			},
+			wantCA: &generic,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useEnv(t, tt.env)
+
+			// the TLS config is only inspectable once applied for HTTP, gRPC
+			// wraps it in credentials
+			var logsCfg Config
+			for _, opt := range getLogsOptionsFromEnv() {
+				logsCfg = opt.ApplyHTTPOption(logsCfg)
+			}
+			if got := logsCfg.Logs.TLSCfg != nil; got != tt.wantLogsConfig {
+				t.Fatalf("logs TLS config set = %v, want %v", got, tt.wantLogsConfig)
+			}
+
+			cfg := NewHTTPConfig()
+			tlsCfg := cfg.Logs.TLSCfg
+			if tlsCfg == nil {
+				t.Fatal("no TLS config")
+			}
+			if tt.wantCA == nil {
+				if tlsCfg.RootCAs != nil {
+					t.Error("RootCAs set, want unset")
+				}
+			} else if !tlsCfg.RootCAs.Equal(tt.wantCA.pool(t)) {
+				t.Error("RootCAs differ from the wanted CA")
+			}
+			if tt.wantClient == nil {
+				if len(tlsCfg.Certificates) != 0 {
+					t.Errorf("%d client certificates, want none", len(tlsCfg.Certificates))
+				}
+			} else if !hasCert(tlsCfg.Certificates, tt.wantClient.der) {
+				t.Error("client certificate differs from the wanted one")
+			}
+		})
+	}
+}
+
+func hasCert(certs []tls.Certificate, der []byte) bool {
+	return len(certs) == 1 && len(certs[0].Certificate) > 0 && bytes.Equal(certs[0].Certificate[0], der)
+}
@@ -22,6 +22,7 @@ import (
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
 )
 
 const (
@@ -34,6 +35,13 @@ const (
 )
 
 type (
+	// BreakerConfig configures the circuit breaker of the client.
+	BreakerConfig struct {
+		Failures       int
+		OpenTimeout    time.Duration
+		MaxOpenTimeout time.Duration
+	}
+
 	SignalConfig struct {
 		Endpoint    string
 		Insecure    bool
@@ -49,12 +57,19 @@ type (
 
 	Config struct {
 		// Signal specific configurations
-		Traces SignalConfig
+		Logs SignalConfig
 
 		RetryConfig retry.Config
 
+		// IgnoreEnv skips the OTEL_EXPORTER_OTLP_* variables, e.g. for an
+		// exporter configured for another destination.
+		IgnoreEnv bool
+
 		// gRPC configurations
 		ReconnectionPeriod time.Duration
+		Keepalive          *keepalive.ClientParameters
+		MaxSendMsgSize     int
+		Breaker            *BreakerConfig
 		ServiceConfig      string
 		DialOptions        []grpc.DialOption
 		GRPCConn           *grpc.ClientConn
@@ -65,7 +80,7 @@ type (
 // any unset setting using the default HTTP config values.
 func NewHTTPConfig(opts ...HTTPOption) Config {
 	cfg := Config{
-		Traces: SignalConfig{
+		Logs: SignalConfig{
 			Endpoint:    fmt.Sprintf("%s:%d", DefaultCollectorHost, DefaultCollectorHTTPPort),
 			URLPath:     DefaultLogsPath,
 			Compression: NoCompression,
@@ -77,10 +92,22 @@ func NewHTTPConfig(opts ...HTTPOption) Config {
 	for _, opt := range opts {
 		cfg = opt.ApplyHTTPOption(cfg)
 	}
-	cfg.Traces.URLPath = cleanPath(cfg.Traces.URLPath, DefaultLogsPath)
+	cfg = ApplyHTTPLogsEnvConfigs(cfg)
+	cfg.Logs.URLPath = cleanPath(cfg.Logs.URLPath, DefaultLogsPath)
 	return cfg
 }
 
+// ignoreEnv reports whether opts set IgnoreEnv. The generic env
+// configurations are applied before the options, so they are evaluated
+// beforehand on an empty Config.
+func ignoreEnv(opts []GRPCOption) bool {
+	var cfg Config
+	for _, opt := range opts {
+		cfg = opt.ApplyGRPCOption(cfg)
+	}
+	return cfg.IgnoreEnv
+}
+
 // cleanPath returns a path with all spaces trimmed and all redundancies
 // removed. If urlPath is empty or cleaning it results in an empty string,
 // defaultPath is returned instead.
@@ -100,7 +127,7 @@ func cleanPath(urlPath string, defaultPath string) string {
 func NewGRPCConfig(opts ...GRPCOption) Config {
 	userAgent := "OTel OTLP Exporter Go/dagger"
 	cfg := Config{
-		Traces: SignalConfig{
+		Logs: SignalConfig{
 			Endpoint:    fmt.Sprintf("%s:%d", DefaultCollectorHost, DefaultCollectorGRPCPort),
 			URLPath:     DefaultLogsPath,
 			Compression: NoCompression,
@@ -109,26 +136,31 @@ func NewGRPCConfig(opts ...GRPCOption) Config {
 		RetryConfig: retry.DefaultConfig,
 		DialOptions: []grpc.DialOption{grpc.WithUserAgent(userAgent)},
 	}
-	cfg = ApplyGRPCEnvConfigs(cfg)
+	if !ignoreEnv(opts) {
+		cfg = ApplyGRPCEnvConfigs(cfg)
+	}
 	for _, opt := range opts {
 		cfg = opt.ApplyGRPCOption(cfg)
 	}
+	if !cfg.IgnoreEnv {
+		cfg = ApplyGRPCLogsEnvConfigs(cfg)
+	}
 
 	if cfg.ServiceConfig != "" {
 		cfg.DialOptions = append(cfg.DialOptions, grpc.WithDefaultServiceConfig(cfg.ServiceConfig))
 	}
 	// Priroritize GRPCCredentials over Insecure (passing both is an error).
-	if cfg.Traces.GRPCCredentials != nil { //nolint: gocritic
-		cfg.DialOptions = append(cfg.DialOptions, grpc.WithTransportCredentials(cfg.Traces.GRPCCredentials))
-	} else if cfg.Traces.Insecure {
+	if cfg.Logs.GRPCCredentials != nil { //nolint: gocritic
+		cfg.DialOptions = append(cfg.DialOptions, grpc.WithTransportCredentials(cfg.Logs.GRPCCredentials))
+	} else if cfg.Logs.Insecure {
 		cfg.DialOptions = append(cfg.DialOptions, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	} else {
 		// Default to using the host's root CA.
 		creds := credentials.NewTLS(nil)
-		cfg.Traces.GRPCCredentials = creds
+		cfg.Logs.GRPCCredentials = creds
 		cfg.DialOptions = append(cfg.DialOptions, grpc.WithTransportCredentials(creds))
 	}
-	if cfg.Traces.Compression == GzipCompression {
+	if cfg.Logs.Compression == GzipCompression {
 		cfg.DialOptions = append(cfg.DialOptions, grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
 	}
 	if cfg.ReconnectionPeriod != 0 {
@@ -138,6 +170,12 @@ func NewGRPCConfig(opts ...GRPCOption) Config {
 		}
 		cfg.DialOptions = append(cfg.DialOptions, grpc.WithConnectParams(p))
 	}
+	if cfg.Keepalive != nil {
+		cfg.DialOptions = append(cfg.DialOptions, grpc.WithKeepaliveParams(*cfg.Keepalive))
+	}
+	if cfg.MaxSendMsgSize > 0 {
+		cfg.DialOptions = append(cfg.DialOptions, grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(cfg.MaxSendMsgSize)))
+	}
 
 	return cfg
 }
@@ -250,7 +288,7 @@ func NewGRPCOption(fn func(cfg Config) Config) GRPCOption {
 
 func WithEndpoint(endpoint string) GenericOption {
 	return newGenericOption(func(cfg Config) Config {
-		cfg.Traces.Endpoint = endpoint
+		cfg.Logs.Endpoint = endpoint
 		return cfg
 	})
 }
@@ -263,10 +301,10 @@ func WithEndpointURL(v string) GenericOption {
 			return cfg
 		}
 
-		cfg.Traces.Endpoint = u.Host
-		cfg.Traces.URLPath = u.Path
+		cfg.Logs.Endpoint = u.Host
+		cfg.Logs.URLPath = u.Path
 		if u.Scheme != "https" {
-			cfg.Traces.Insecure = true
+			cfg.Logs.Insecure = true
 		}
 
 		return cfg
@@ -275,14 +313,14 @@ func WithEndpointURL(v string) GenericOption {
 
 func WithCompression(compression Compression) GenericOption {
 	return newGenericOption(func(cfg Config) Config {
-		cfg.Traces.Compression = compression
+		cfg.Logs.Compression = compression
 		return cfg
 	})
 }
 
 func WithURLPath(urlPath string) GenericOption {
 	return newGenericOption(func(cfg Config) Config {
-		cfg.Traces.URLPath = urlPath
+		cfg.Logs.URLPath = urlPath
 		return cfg
 	})
 }
@@ -296,38 +334,38 @@ func WithRetry(rc retry.Config) GenericOption {
 
 func WithTLSClientConfig(tlsCfg *tls.Config) GenericOption {
 	return newSplitOption(func(cfg Config) Config {
-		cfg.Traces.TLSCfg = tlsCfg.Clone()
+		cfg.Logs.TLSCfg = tlsCfg.Clone()
 		return cfg
 	}, func(cfg Config) Config {
-		cfg.Traces.GRPCCredentials = credentials.NewTLS(tlsCfg)
+		cfg.Logs.GRPCCredentials = credentials.NewTLS(tlsCfg)
 		return cfg
 	})
 }
 
 func WithInsecure() GenericOption {
 	return newGenericOption(func(cfg Config) Config {
-		cfg.Traces.Insecure = true
+		cfg.Logs.Insecure = true
 		return cfg
 	})
 }
 
 func WithSecure() GenericOption {
 	return newGenericOption(func(cfg Config) Config {
-		cfg.Traces.Insecure = false
+		cfg.Logs.Insecure = false
 		return cfg
 	})
 }
 
 func WithHeaders(headers map[string]string) GenericOption {
 	return newGenericOption(func(cfg Config) Config {
-		cfg.Traces.Headers = headers
+		cfg.Logs.Headers = headers
 		return cfg
 	})
 }
 
 func WithTimeout(duration time.Duration) GenericOption {
 	return newGenericOption(func(cfg Config) Config {
-		cfg.Traces.Timeout = duration
+		cfg.Logs.Timeout = duration
 		return cfg
 	})
 }
@@ -44,3 +44,13 @@ func LogsPartialSuccessError(itemsRejected int64, errorMessage string) error {
 		RejectedKind:  "logs",
 	}
 }
+
+// MetricsPartialSuccessError returns an error describing a partial success
+// response for the metric signal.
+func MetricsPartialSuccessError(itemsRejected int64, errorMessage string) error {
+	return PartialSuccess{
+		ErrorMessage:  errorMessage,
+		RejectedItems: itemsRejected,
+		RejectedKind:  "metric data points",
+	}
+}
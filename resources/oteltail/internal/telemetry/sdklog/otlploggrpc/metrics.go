@@ -0,0 +1,55 @@
+package otlploggrpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go.opentelemetry.io/otel"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"oteltail/internal/telemetry/sdklog/otlploggrpc/internal"
+)
+
+// ExportMetrics sends metrics to the collector the logs are sent to, over the
+// same connection and with the same headers, timeout and retries. Metrics are
+// not sent while the circuit breaker is open.
+func (c *Client) ExportMetrics(ctx context.Context, resourceMetrics []*metricpb.ResourceMetrics) error {
+	c.lscMu.RLock()
+	defer c.lscMu.RUnlock()
+
+	if c.lsc == nil {
+		return errShutdown
+	}
+
+	if c.CircuitOpen() {
+		return ErrCircuitOpen
+	}
+
+	c.checkConn()
+
+	ctx, cancel := c.exportContext(ctx)
+	defer cancel()
+
+	msc := colmetricpb.NewMetricsServiceClient(c.conn)
+
+	return c.requestFunc(ctx, func(iCtx context.Context) error {
+		resp, err := msc.Export(iCtx, &colmetricpb.ExportMetricsServiceRequest{
+			ResourceMetrics: resourceMetrics,
+		})
+		if resp != nil && resp.PartialSuccess != nil {
+			msg := resp.PartialSuccess.GetErrorMessage()
+			n := resp.PartialSuccess.GetRejectedDataPoints()
+			if n != 0 || msg != "" {
+				otel.Handle(internal.MetricsPartialSuccessError(n, msg))
+			}
+		}
+		// nil is converted to OK.
+		if status.Code(err) == codes.OK {
+			return nil
+		}
+		return err
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"go.opentelemetry.io/otel"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 
 	"oteltail/internal/telemetry/sdklog/otlploggrpc/internal/otlpconfig"
 	"oteltail/internal/telemetry/sdklog/otlploggrpc/internal/retry"
@@ -35,6 +36,9 @@ func asGRPCOptions(opts []Option) []otlpconfig.GRPCOption {
 // entirely handled by the gRPC ClientConn.
 type RetryConfig retry.Config
 
+// DefaultRetryConfig is the retry policy used unless WithRetry is passed.
+var DefaultRetryConfig = RetryConfig(retry.DefaultConfig)
+
 type wrappedOption struct {
 	otlpconfig.GRPCOption
 }
@@ -55,10 +59,10 @@ func WithInsecure() Option {
 
 // WithEndpoint sets the target endpoint the Exporter will connect to.
 //
-// If the OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_METRICS_ENDPOINT
-// environment variable is set, and this option is not passed, that variable
-// value will be used. If both are set, OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
-// will take precedence.
+// If the OTEL_EXPORTER_OTLP_ENDPOINT environment variable is set, and this
+// option is not passed, that variable value will be used. If the
+// OTEL_EXPORTER_OTLP_LOGS_ENDPOINT environment variable is set, it takes
+// precedence over both.
 //
 // If both this option and WithEndpointURL are used, the last used option will
 // take precedence.
@@ -73,10 +77,10 @@ func WithEndpoint(endpoint string) Option {
 
 // WithEndpointURL sets the target endpoint URL the Exporter will connect to.
 //
-// If the OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_METRICS_ENDPOINT
-// environment variable is set, and this option is not passed, that variable
-// value will be used. If both are set, OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
-// will take precedence.
+// If the OTEL_EXPORTER_OTLP_ENDPOINT environment variable is set, and this
+// option is not passed, that variable value will be used. If the
+// OTEL_EXPORTER_OTLP_LOGS_ENDPOINT environment variable is set, it takes
+// precedence over both.
 //
 // If both this option and WithEndpoint are used, the last used option will
 // take precedence.
@@ -102,9 +106,27 @@ func WithReconnectionPeriod(rp time.Duration) Option {
 	})}
 }
 
+// WithKeepalive enables keepalive pings every interval, closing the
+// connection if a ping is not acknowledged within timeout. The interval must
+// not be shorter than the minimum ping interval enforced by the collector.
+//
+// This option has no effect if WithGRPCConn is used.
+func WithKeepalive(interval, timeout time.Duration) Option {
+	return wrappedOption{otlpconfig.NewGRPCOption(func(cfg otlpconfig.Config) otlpconfig.Config {
+		cfg.Keepalive = &keepalive.ClientParameters{
+			Time:    interval,
+			Timeout: timeout,
+		}
+		return cfg
+	})}
+}
+
 func compressorToCompression(compressor string) otlpconfig.Compression {
-	if compressor == "gzip" {
+	switch compressor {
+	case "gzip":
 		return otlpconfig.GzipCompression
+	case "none":
+		return otlpconfig.NoCompression
 	}
 
 	otel.Handle(fmt.Errorf("invalid compression type: '%s', using no compression as default", compressor))
@@ -112,11 +134,39 @@ func compressorToCompression(compressor string) otlpconfig.Compression {
 }
 
 // WithCompressor sets the compressor for the gRPC client to use when sending
-// requests. Supported compressor values: "gzip".
+// requests. Supported compressor values: "gzip" and "none".
 func WithCompressor(compressor string) Option {
 	return wrappedOption{otlpconfig.WithCompression(compressorToCompression(compressor))}
 }
 
+// WithMaxSendMsgSize sets the max size of the export requests, larger
+// requests are split. It should match the max receive message size of the
+// collector, 4 MiB by default.
+//
+// This option has no effect on the message size limit if WithGRPCConn is
+// used, requests are still split.
+func WithMaxSendMsgSize(size int) Option {
+	return wrappedOption{otlpconfig.NewGRPCOption(func(cfg otlpconfig.Config) otlpconfig.Config {
+		cfg.MaxSendMsgSize = size
+		return cfg
+	})}
+}
+
+// WithCircuitBreaker makes the exports fail fast with ErrCircuitOpen after
+// failures consecutive exports failed because the collector is unavailable.
+// The breaker stays open for openTimeout, doubled after each failed probe up
+// to maxOpenTimeout, or longer if the collector asks to with RetryInfo.
+func WithCircuitBreaker(failures int, openTimeout, maxOpenTimeout time.Duration) Option {
+	return wrappedOption{otlpconfig.NewGRPCOption(func(cfg otlpconfig.Config) otlpconfig.Config {
+		cfg.Breaker = &otlpconfig.BreakerConfig{
+			Failures:       failures,
+			OpenTimeout:    openTimeout,
+			MaxOpenTimeout: maxOpenTimeout,
+		}
+		return cfg
+	})}
+}
+
 // WithHeaders will send the provided headers with each gRPC requests.
 func WithHeaders(headers map[string]string) Option {
 	return wrappedOption{otlpconfig.WithHeaders(headers)}
@@ -131,7 +181,7 @@ func WithHeaders(headers map[string]string) Option {
 // This option has no effect if WithGRPCConn is used.
 func WithTLSCredentials(creds credentials.TransportCredentials) Option {
 	return wrappedOption{otlpconfig.NewGRPCOption(func(cfg otlpconfig.Config) otlpconfig.Config {
-		cfg.Traces.GRPCCredentials = creds
+		cfg.Logs.GRPCCredentials = creds
 		return cfg
 	})}
 }
@@ -159,6 +209,26 @@ func WithDialOption(opts ...grpc.DialOption) Option {
 	})}
 }
 
+// WithPerRPCCredentials adds credentials, e.g. from the auth package, to
+// every export request. It can be used several times to combine credentials.
+//
+// This option has no effect if WithGRPCConn is used.
+func WithPerRPCCredentials(creds credentials.PerRPCCredentials) Option {
+	return wrappedOption{otlpconfig.NewGRPCOption(func(cfg otlpconfig.Config) otlpconfig.Config {
+		cfg.DialOptions = append(cfg.DialOptions, grpc.WithPerRPCCredentials(creds))
+		return cfg
+	})}
+}
+
+// WithoutEnvConfig ignores the OTEL_EXPORTER_OTLP_* environment variables,
+// only the options configure the client.
+func WithoutEnvConfig() Option {
+	return wrappedOption{otlpconfig.NewGRPCOption(func(cfg otlpconfig.Config) otlpconfig.Config {
+		cfg.IgnoreEnv = true
+		return cfg
+	})}
+}
+
 // WithGRPCConn sets conn as the gRPC ClientConn used for all communication.
 //
 // This option takes precedence over any other option that relates to
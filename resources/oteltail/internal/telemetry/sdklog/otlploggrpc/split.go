@@ -0,0 +1,95 @@
+package otlploggrpc
+
+import (
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	collogpb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// UnsentError is returned when some of the requests an export was split in
+// failed. The other requests were delivered, only Unsent is to be exported
+// again.
+type UnsentError struct {
+	Unsent []*logspb.ResourceLogs
+	Err    error
+}
+
+func (e *UnsentError) Error() string {
+	return fmt.Sprintf("%d log records not sent: %v", countRecords(e.Unsent), e.Err)
+}
+
+func (e *UnsentError) Unwrap() error {
+	return e.Err
+}
+
+// splitResourceLogs splits resourceLogs in requests of at most maxBytes once
+// encoded, halving the records until each part fits. A record which does not
+// fit on its own can never be sent, it is dropped and reported to the otel
+// error handler.
+func splitResourceLogs(resourceLogs []*logspb.ResourceLogs, maxBytes int) [][]*logspb.ResourceLogs {
+	size := proto.Size(&collogpb.ExportLogsServiceRequest{ResourceLogs: resourceLogs})
+	if size <= maxBytes {
+		return [][]*logspb.ResourceLogs{resourceLogs}
+	}
+
+	n := countRecords(resourceLogs)
+	if n <= 1 {
+		otel.Handle(fmt.Errorf("dropping log record of %d bytes, above the %d bytes max send message size", size, maxBytes))
+		return nil
+	}
+
+	head, tail := cutResourceLogs(resourceLogs, n/2)
+
+	return append(splitResourceLogs(head, maxBytes), splitResourceLogs(tail, maxBytes)...)
+}
+
+func countRecords(resourceLogs []*logspb.ResourceLogs) int {
+	var n int
+	for _, rl := range resourceLogs {
+		for _, sl := range rl.ScopeLogs {
+			n += len(sl.LogRecords)
+		}
+	}
+	return n
+}
+
+// cutResourceLogs returns the first n records and the others, keeping their
+// resource and scope. The records are shared with resourceLogs.
+func cutResourceLogs(resourceLogs []*logspb.ResourceLogs, n int) (head, tail []*logspb.ResourceLogs) {
+	for _, rl := range resourceLogs {
+		headRL := &logspb.ResourceLogs{Resource: rl.Resource, SchemaUrl: rl.SchemaUrl}
+		tailRL := &logspb.ResourceLogs{Resource: rl.Resource, SchemaUrl: rl.SchemaUrl}
+
+		for _, sl := range rl.ScopeLogs {
+			take := min(n, len(sl.LogRecords))
+			n -= take
+
+			if take > 0 {
+				headRL.ScopeLogs = append(headRL.ScopeLogs, &logspb.ScopeLogs{
+					Scope:      sl.Scope,
+					SchemaUrl:  sl.SchemaUrl,
+					LogRecords: sl.LogRecords[:take],
+				})
+			}
+			if take < len(sl.LogRecords) {
+				tailRL.ScopeLogs = append(tailRL.ScopeLogs, &logspb.ScopeLogs{
+					Scope:      sl.Scope,
+					SchemaUrl:  sl.SchemaUrl,
+					LogRecords: sl.LogRecords[take:],
+				})
+			}
+		}
+
+		if len(headRL.ScopeLogs) > 0 {
+			head = append(head, headRL)
+		}
+		if len(tailRL.ScopeLogs) > 0 {
+			tail = append(tail, tailRL)
+		}
+	}
+
+	return head, tail
+}
@@ -0,0 +1,157 @@
+package otlploggrpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	collogpb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// collector rejects the requests holding a record with the body reject and
+// records the bodies of the others.
+type collector struct {
+	collogpb.UnimplementedLogsServiceServer
+
+	mu       sync.Mutex
+	received []string
+	delay    time.Duration
+}
+
+func (c *collector) Export(ctx context.Context, req *collogpb.ExportLogsServiceRequest) (*collogpb.ExportLogsServiceResponse, error) {
+	bodies := recordBodies(req.ResourceLogs)
+	for _, body := range bodies {
+		if body == "reject" {
+			return nil, status.Error(codes.InvalidArgument, "rejected")
+		}
+	}
+
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.received = append(c.received, bodies...)
+
+	return &collogpb.ExportLogsServiceResponse{}, nil
+}
+
+func recordBodies(resourceLogs []*logspb.ResourceLogs) []string {
+	var bodies []string
+	for _, rl := range resourceLogs {
+		for _, sl := range rl.ScopeLogs {
+			for _, lr := range sl.LogRecords {
+				bodies = append(bodies, lr.Body.GetStringValue())
+			}
+		}
+	}
+	return bodies
+}
+
+func startCollector(t *testing.T, c *collector) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := grpc.NewServer()
+	collogpb.RegisterLogsServiceServer(srv, c)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String()
+}
+
+// resourceLogs returns records of about 1 KiB each, with the given bodies
+// as prefix.
+func resourceLogs(bodies ...string) []*logspb.ResourceLogs {
+	sl := &logspb.ScopeLogs{}
+	for _, body := range bodies {
+		sl.LogRecords = append(sl.LogRecords, &logspb.LogRecord{
+			Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: body}},
+			Attributes: []*commonpb.KeyValue{{
+				Key:   "padding",
+				Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: strings.Repeat("x", 1024)}},
+			}},
+		})
+	}
+	return []*logspb.ResourceLogs{{ScopeLogs: []*logspb.ScopeLogs{sl}}}
+}
+
+func newTestClient(t *testing.T, endpoint string, opts ...Option) *Client {
+	opts = append([]Option{
+		WithoutEnvConfig(),
+		WithEndpoint(endpoint),
+		WithInsecure(),
+		WithRetry(RetryConfig{Enabled: false}),
+		// a request per record
+		WithMaxSendMsgSize(1500),
+	}, opts...)
+
+	c := NewClient(opts...)
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Stop(context.Background()) })
+
+	return c
+}
+
+func TestExportSplitReturnsUnsent(t *testing.T) {
+	col := &collector{}
+	c := newTestClient(t, startCollector(t, col))
+
+	err := c.ExportResourceLogs(context.Background(), resourceLogs("a", "reject", "b"))
+
+	var unsent *UnsentError
+	if !errors.As(err, &unsent) {
+		t.Fatalf("ExportResourceLogs = %v, want an *UnsentError", err)
+	}
+	if got := recordBodies(unsent.Unsent); len(got) != 1 || got[0] != "reject" {
+		t.Errorf("unsent = %v, want [reject]", got)
+	}
+	if !Permanent(err) {
+		t.Errorf("Permanent(%v) = false", err)
+	}
+
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	if len(col.received) != 2 {
+		t.Errorf("received %v, want [a b]", col.received)
+	}
+}
+
+func TestExportSplitSharesTimeout(t *testing.T) {
+	// each request fits in the timeout, the export of all of them does not
+	col := &collector{delay: 200 * time.Millisecond}
+	c := newTestClient(t, startCollector(t, col), WithTimeout(500*time.Millisecond))
+
+	start := time.Now()
+	err := c.ExportResourceLogs(context.Background(), resourceLogs("a", "b", "c", "d", "e"))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("export took %v, above its timeout", elapsed)
+	}
+
+	var unsent *UnsentError
+	if !errors.As(err, &unsent) {
+		t.Fatalf("ExportResourceLogs = %v, want an *UnsentError", err)
+	}
+
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	if sent := len(col.received); sent+len(recordBodies(unsent.Unsent)) != 5 || sent == 0 {
+		t.Errorf("%d records sent and %d unsent, want 5 in total", sent, len(recordBodies(unsent.Unsent)))
+	}
+}
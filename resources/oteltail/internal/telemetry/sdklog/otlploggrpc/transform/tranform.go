@@ -95,6 +95,8 @@ func InstrumentationScope(il instrumentation.Scope) *commonpb.InstrumentationSco
 func logValue(v olog.Value) *commonpb.AnyValue {
 	av := new(commonpb.AnyValue)
 	switch v.Kind() {
+	case olog.KindEmpty:
+		// An empty value is encoded as an AnyValue without a value.
 	case olog.KindBool:
 		av.Value = &commonpb.AnyValue_BoolValue{
 			BoolValue: v.AsBool(),
@@ -119,8 +121,21 @@ func logValue(v olog.Value) *commonpb.AnyValue {
 		av.Value = &commonpb.AnyValue_ArrayValue{
 			ArrayValue: array,
 		}
+	case olog.KindBytes:
+		av.Value = &commonpb.AnyValue_BytesValue{
+			BytesValue: v.AsBytes(),
+		}
 	case olog.KindMap:
-		panic("not supported")
+		kvList := &commonpb.KeyValueList{}
+		for _, kv := range v.AsMap() {
+			kvList.Values = append(kvList.Values, &commonpb.KeyValue{
+				Key:   kv.Key,
+				Value: logValue(kv.Value),
+			})
+		}
+		av.Value = &commonpb.AnyValue_KvlistValue{
+			KvlistValue: kvList,
+		}
 	default:
 		av.Value = &commonpb.AnyValue_StringValue{
 			StringValue: "INVALID",
@@ -2,6 +2,8 @@ package sdklog
 
 import (
 	"context"
+	"errors"
+	"sync"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/log"
@@ -22,6 +24,9 @@ type LogData struct {
 
 type LogProcessor interface {
 	OnEmit(context.Context, *LogData)
+	// ForceFlush exports the buffered logs and returns the errors of the
+	// exports done since the previous flush.
+	ForceFlush(context.Context) error
 	Shutdown(context.Context) error
 }
 
@@ -29,6 +34,10 @@ var _ LogProcessor = &simpleLogProcessor{}
 
 type simpleLogProcessor struct {
 	exporter LogExporter
+
+	// errs holds the export errors since the last flush.
+	mu   sync.Mutex
+	errs []error
 }
 
 func NewSimpleLogProcessor(exporter LogExporter) LogProcessor {
@@ -40,9 +49,24 @@ func NewSimpleLogProcessor(exporter LogExporter) LogProcessor {
 func (p *simpleLogProcessor) OnEmit(ctx context.Context, log *LogData) {
 	if err := p.exporter.ExportLogs(ctx, []*LogData{log}); err != nil {
 		otel.Handle(err)
+
+		p.mu.Lock()
+		p.errs = append(p.errs, err)
+		p.mu.Unlock()
 	}
 }
 
+// ForceFlush returns the export errors since the previous flush, logs are
+// exported as they are emitted so there is nothing to export.
+func (p *simpleLogProcessor) ForceFlush(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	err := errors.Join(p.errs...)
+	p.errs = nil
+	return err
+}
+
 func (p *simpleLogProcessor) Shutdown(ctx context.Context) error {
-	return nil
+	return p.exporter.Shutdown(ctx)
 }
@@ -2,6 +2,7 @@ package sdklog
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"sync/atomic"
 
@@ -72,6 +73,25 @@ func (p *LoggerProvider) Shutdown(ctx context.Context) error {
 	return eg.Wait()
 }
 
+// ForceFlush exports the logs buffered by the registered processors. It
+// waits for all of them and returns their errors joined.
+func (p *LoggerProvider) ForceFlush(ctx context.Context) error {
+	processors := p.getLogProcessors()
+
+	errs := make([]error, len(processors))
+	eg := new(errgroup.Group)
+	for i, lp := range processors {
+		i, lp := i, lp
+		eg.Go(func() error {
+			errs[i] = lp.ForceFlush(ctx)
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	return errors.Join(errs...)
+}
+
 func (p *LoggerProvider) getLogProcessors() []LogProcessor {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -0,0 +1,54 @@
+package sdklog
+
+import (
+	"go.opentelemetry.io/otel/log"
+)
+
+// RecordOverhead approximates the encoded size of the fixed fields of a log
+// record: timestamps, severity, flags, trace and span IDs and the field tags.
+const RecordOverhead = 64
+
+// EstimateSize approximates the protobuf encoded size of a log record. It is
+// meant for batching decisions, not for exact accounting.
+func EstimateSize(ld *LogData) int {
+	size := RecordOverhead + ValueSize(ld.Body()) + len(ld.SeverityText())
+
+	ld.WalkAttributes(func(kv log.KeyValue) bool {
+		size += KeyValueSize(kv)
+		return true
+	})
+
+	return size
+}
+
+// KeyValueSize approximates the protobuf encoded size of an attribute.
+func KeyValueSize(kv log.KeyValue) int {
+	return len(kv.Key) + ValueSize(kv.Value) + 4
+}
+
+// ValueSize approximates the protobuf encoded size of a value.
+func ValueSize(v log.Value) int {
+	switch v.Kind() {
+	case log.KindString:
+		return len(v.AsString()) + 2
+	case log.KindBytes:
+		return len(v.AsBytes()) + 2
+	case log.KindSlice:
+		size := 2
+		for _, item := range v.AsSlice() {
+			size += ValueSize(item) + 2
+		}
+		return size
+	case log.KindMap:
+		size := 2
+		for _, kv := range v.AsMap() {
+			size += KeyValueSize(kv) + 2
+		}
+		return size
+	case log.KindEmpty:
+		return 0
+	default:
+		// bool, int64 and float64
+		return 10
+	}
+}
@@ -0,0 +1,366 @@
+package spill
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	collogpb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/proto"
+
+	"oteltail/internal/telemetry/sdklog"
+	"oteltail/internal/telemetry/sdklog/otlploggrpc"
+	"oteltail/internal/telemetry/sdklog/otlploggrpc/transform"
+)
+
+// RawExporter is an exporter which can also send logs already converted to
+// OTLP, which is how spilled logs are replayed.
+type RawExporter interface {
+	sdklog.LogExporter
+	ExportResourceLogs(ctx context.Context, resourceLogs []*logspb.ResourceLogs) error
+}
+
+// Exporter persists the logs the wrapped exporter fails to send and replays
+// them, before any new logs, on the next export. The logs are kept in segment
+// files, each holding a sequence of frames:
+//
+//	length (4 bytes, big endian) | CRC-32 IEEE of the payload (4 bytes) | payload
+//
+// where the payload is a protobuf encoded ExportLogsServiceRequest.
+//
+// Lambda keeps /tmp between invocations served by the same execution
+// environment only, so the spill covers short collector outages, not the
+// loss of the environment.
+type Exporter struct {
+	mu   sync.Mutex
+	next RawExporter
+	cfg  config
+
+	// retryAt is the time before which exports go straight to disk.
+	retryAt time.Time
+}
+
+// Compile time check *Exporter implements sdklog.LogExporter.
+var _ sdklog.LogExporter = (*Exporter)(nil)
+
+const (
+	segmentExt  = ".seg"
+	frameHeader = 8
+)
+
+var errCorruptSegment = errors.New("corrupt spill segment")
+
+// New creates an Exporter spilling the logs next fails to export.
+func New(next RawExporter, opts ...Option) (*Exporter, error) {
+	cfg := newConfig(opts...)
+
+	if err := os.MkdirAll(cfg.dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Exporter{
+		next: next,
+		cfg:  cfg,
+	}, nil
+}
+
+// ExportLogs replays the spilled logs, then exports logs. If either fails,
+// logs are written to disk and no error is returned unless they could not
+// be persisted.
+func (e *Exporter) ExportLogs(ctx context.Context, logs []*sdklog.LogData) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	resourceLogs := transform.Logs(logs)
+
+	if time.Now().Before(e.retryAt) {
+		return e.spill(resourceLogs)
+	}
+
+	if err := e.replay(ctx); err != nil {
+		return e.fail(resourceLogs, err)
+	}
+
+	if err := e.next.ExportResourceLogs(ctx, resourceLogs); err != nil {
+		return e.fail(unsentLogs(resourceLogs, err), err)
+	}
+
+	return nil
+}
+
+// unsentLogs returns the logs of resourceLogs which the failed export did
+// not deliver.
+func unsentLogs(resourceLogs []*logspb.ResourceLogs, err error) []*logspb.ResourceLogs {
+	var unsent *otlploggrpc.UnsentError
+	if errors.As(err, &unsent) {
+		return unsent.Unsent
+	}
+	return resourceLogs
+}
+
+// Replay exports the spilled logs without waiting for new logs to export,
+// so that they do not stay on disk while no records are read. It does
+// nothing while exports go straight to disk after a failure.
+func (e *Exporter) Replay(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if time.Now().Before(e.retryAt) {
+		return nil
+	}
+
+	if err := e.replay(ctx); err != nil {
+		e.retryAt = time.Now().Add(e.cfg.retryInterval)
+		return err
+	}
+
+	return nil
+}
+
+// Pending reports whether spilled logs are waiting to be replayed, or whether
+// the segments could not be listed.
+func (e *Exporter) Pending() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	segments, err := e.segments()
+	return err != nil || len(segments) > 0
+}
+
+// Shutdown shuts the wrapped exporter down. The spilled logs are kept on
+// disk.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	return e.next.Shutdown(ctx)
+}
+
+// fail spills the logs after an export error.
+func (e *Exporter) fail(resourceLogs []*logspb.ResourceLogs, cause error) error {
+	slog.Warn("spilling logs to disk", "dir", e.cfg.dir, "error", cause)
+	e.retryAt = time.Now().Add(e.cfg.retryInterval)
+
+	return e.spill(resourceLogs)
+}
+
+// spill appends the logs to the last segment.
+func (e *Exporter) spill(resourceLogs []*logspb.ResourceLogs) error {
+	payload, err := proto.Marshal(&collogpb.ExportLogsServiceRequest{
+		ResourceLogs: resourceLogs,
+	})
+	if err != nil {
+		return err
+	}
+
+	frame := encodeFrame(payload)
+	if int64(len(frame)) > e.cfg.maxBytes {
+		return fmt.Errorf("unable to spill %d bytes, above the %d bytes limit", len(frame), e.cfg.maxBytes)
+	}
+
+	segments, err := e.segments()
+	if err != nil {
+		return err
+	}
+
+	// drop the oldest segments to stay within the size cap
+	var total int64
+	for _, s := range segments {
+		total += s.size
+	}
+	for len(segments) > 0 && total+int64(len(frame)) > e.cfg.maxBytes {
+		otel.Handle(fmt.Errorf("spill size limit reached, dropping segment %s", segments[0].path))
+		if err := os.Remove(segments[0].path); err != nil {
+			return err
+		}
+		total -= segments[0].size
+		segments = segments[1:]
+	}
+
+	path := e.newSegmentPath()
+	if n := len(segments); n > 0 && segments[n-1].size < e.cfg.segmentBytes {
+		path = segments[n-1].path
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(frame); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replay exports the spilled logs, oldest first. Segments are removed once
+// all their frames were exported. When an export fails the segment is
+// rewritten with the frames left.
+func (e *Exporter) replay(ctx context.Context) error {
+	segments, err := e.segments()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range segments {
+		payloads, err := readSegment(s.path, s.size)
+		if err != nil {
+			// keep the frames read before the corruption
+			otel.Handle(fmt.Errorf("%s: %w", s.path, err))
+		}
+
+		for i, payload := range payloads {
+			var request collogpb.ExportLogsServiceRequest
+			if err := proto.Unmarshal(payload, &request); err != nil {
+				otel.Handle(fmt.Errorf("%s: %w", s.path, err))
+				continue
+			}
+
+			if err := e.next.ExportResourceLogs(ctx, request.ResourceLogs); err != nil {
+				left := payloads[i:]
+				var unsent *otlploggrpc.UnsentError
+				if errors.As(err, &unsent) {
+					// keep the logs of the request which were not delivered
+					payload, merr := proto.Marshal(&collogpb.ExportLogsServiceRequest{ResourceLogs: unsent.Unsent})
+					if merr != nil {
+						return errors.Join(err, merr)
+					}
+					left = append([][]byte{payload}, payloads[i+1:]...)
+				}
+				if werr := writeSegment(s.path, left); werr != nil {
+					return errors.Join(err, werr)
+				}
+				return err
+			}
+		}
+
+		if err := os.Remove(s.path); err != nil {
+			return err
+		}
+		slog.Info("replayed spilled logs", "segment", s.path, "requests", len(payloads))
+	}
+
+	return nil
+}
+
+type segment struct {
+	path string
+	size int64
+}
+
+// segments returns the segment files, oldest first.
+func (e *Exporter) segments() ([]segment, error) {
+	entries, err := os.ReadDir(e.cfg.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []segment
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), segmentExt) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment{
+			path: filepath.Join(e.cfg.dir, entry.Name()),
+			size: info.Size(),
+		})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].path < segments[j].path
+	})
+
+	return segments, nil
+}
+
+// newSegmentPath names segments after their creation time so that they sort
+// oldest first.
+func (e *Exporter) newSegmentPath() string {
+	return filepath.Join(e.cfg.dir, fmt.Sprintf("%020d%s", time.Now().UnixNano(), segmentExt))
+}
+
+func encodeFrame(payload []byte) []byte {
+	frame := make([]byte, frameHeader+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	copy(frame[frameHeader:], payload)
+	return frame
+}
+
+// readSegment returns the payloads of the frames of a segment of the given
+// size. On corruption, the payloads of the frames preceding it are returned
+// with the error.
+func readSegment(path string, size int64) ([][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var payloads [][]byte
+	header := make([]byte, frameHeader)
+	for {
+		if _, err := io.ReadFull(f, header); err == io.EOF {
+			return payloads, nil
+		} else if err != nil {
+			return payloads, errCorruptSegment
+		}
+
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		if length > size {
+			return payloads, errCorruptSegment
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(f, payload); err != nil {
+			return payloads, errCorruptSegment
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+			return payloads, errCorruptSegment
+		}
+
+		payloads = append(payloads, payload)
+	}
+}
+
+// writeSegment replaces the segment with the given payloads.
+func writeSegment(path string, payloads [][]byte) error {
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	for _, payload := range payloads {
+		if _, err := f.Write(encodeFrame(payload)); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,81 @@
+package spill
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/log"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+
+	"oteltail/internal/telemetry/sdklog"
+)
+
+// collector fails the exports while down and counts the records of the
+// others.
+type collector struct {
+	down     bool
+	received int
+}
+
+func (c *collector) ExportLogs(context.Context, []*sdklog.LogData) error {
+	return errors.New("unused")
+}
+
+func (c *collector) ExportResourceLogs(_ context.Context, resourceLogs []*logspb.ResourceLogs) error {
+	if c.down {
+		return errors.New("unavailable")
+	}
+	for _, rl := range resourceLogs {
+		for _, sl := range rl.ScopeLogs {
+			c.received += len(sl.LogRecords)
+		}
+	}
+	return nil
+}
+
+func (c *collector) Shutdown(context.Context) error {
+	return nil
+}
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	col := &collector{down: true}
+
+	e, err := New(col, WithDir(t.TempDir()), WithRetryInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Pending() {
+		t.Fatal("Pending() = true before any export")
+	}
+
+	var ld sdklog.LogData
+	ld.SetBody(log.StringValue("line"))
+	if err := e.ExportLogs(ctx, []*sdklog.LogData{&ld}); err != nil {
+		t.Fatalf("ExportLogs = %v, want the logs spilled", err)
+	}
+	if !e.Pending() {
+		t.Fatal("Pending() = false after a failed export")
+	}
+
+	// still down, the logs stay on disk
+	if err := e.Replay(ctx); err == nil {
+		t.Error("Replay succeeded while the collector is down")
+	}
+	if !e.Pending() {
+		t.Error("Pending() = false after a failed replay")
+	}
+
+	col.down = false
+	if err := e.Replay(ctx); err != nil {
+		t.Fatalf("Replay = %v", err)
+	}
+	if e.Pending() {
+		t.Error("Pending() = true after the replay")
+	}
+	if col.received != 1 {
+		t.Errorf("received %d records, want 1", col.received)
+	}
+}
@@ -0,0 +1,72 @@
+package spill
+
+import (
+	"time"
+)
+
+const (
+	// DefaultDir is where segments are written unless WithDir is used.
+	DefaultDir = "/tmp/oteltail-spill"
+	// DefaultMaxBytes caps the size of all the segments, /tmp is 512 MiB
+	// unless the function is configured with more ephemeral storage.
+	DefaultMaxBytes = 64 << 20
+	// DefaultSegmentBytes is the size above which a new segment is started.
+	DefaultSegmentBytes = 4 << 20
+	// DefaultRetryInterval is how long exports go straight to disk after the
+	// exporter failed.
+	DefaultRetryInterval = 5 * time.Second
+)
+
+// Option configures the Exporter.
+type Option func(cfg *config)
+
+type config struct {
+	dir           string
+	maxBytes      int64
+	segmentBytes  int64
+	retryInterval time.Duration
+}
+
+func newConfig(opts ...Option) config {
+	cfg := config{
+		dir:           DefaultDir,
+		maxBytes:      DefaultMaxBytes,
+		segmentBytes:  DefaultSegmentBytes,
+		retryInterval: DefaultRetryInterval,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithDir sets the directory holding the segment files. It is created if it
+// does not exist.
+func WithDir(dir string) Option {
+	return func(cfg *config) {
+		cfg.dir = dir
+	}
+}
+
+// WithMaxBytes caps the total size of the segment files. Once reached, the
+// oldest segments are dropped to make room for new logs.
+func WithMaxBytes(n int64) Option {
+	return func(cfg *config) {
+		cfg.maxBytes = n
+	}
+}
+
+// WithSegmentBytes sets the size above which a new segment file is started.
+func WithSegmentBytes(n int64) Option {
+	return func(cfg *config) {
+		cfg.segmentBytes = n
+	}
+}
+
+// WithRetryInterval sets how long logs are written straight to disk, without
+// trying the wrapped exporter, after an export failed.
+func WithRetryInterval(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.retryInterval = d
+	}
+}
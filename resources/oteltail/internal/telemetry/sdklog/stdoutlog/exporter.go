@@ -0,0 +1,172 @@
+package stdoutlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	collogpb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"oteltail/internal/telemetry/sdklog"
+	"oteltail/internal/telemetry/sdklog/otlploggrpc/transform"
+)
+
+// Exporter writes exported logs as OTLP-JSON, one ExportLogsServiceRequest
+// per ExportLogs call. The output is the same request the gRPC exporter would
+// send, so resource, attributes, severity, timestamps and trace IDs can be
+// inspected as the collector would receive them.
+type Exporter struct {
+	mu          sync.Mutex
+	writer      io.Writer
+	closer      io.Closer
+	prettyPrint bool
+	stopped     bool
+}
+
+// Compile time check *Exporter implements sdklog.LogExporter.
+var _ sdklog.LogExporter = (*Exporter)(nil)
+
+var errStopped = errors.New("the exporter is shutdown")
+
+// New creates a new Exporter. By default logs are written to os.Stdout.
+func New(opts ...Option) (*Exporter, error) {
+	cfg := newConfig(opts...)
+
+	e := &Exporter{
+		writer:      cfg.writer,
+		prettyPrint: cfg.prettyPrint,
+	}
+
+	if cfg.path != "" {
+		f, err := os.OpenFile(cfg.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		e.writer = f
+		e.closer = f
+	}
+
+	return e, nil
+}
+
+// ExportLogs writes logs to the configured writer.
+func (e *Exporter) ExportLogs(ctx context.Context, logs []*sdklog.LogData) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	doc, err := e.encode(logs)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.stopped {
+		return errStopped
+	}
+
+	_, err = e.writer.Write(doc)
+	return err
+}
+
+// Shutdown stops the exporter, closing the output file if one was opened.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.stopped {
+		return nil
+	}
+	e.stopped = true
+
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+// encode renders logs as an OTLP-JSON ExportLogsServiceRequest terminated by
+// a newline.
+func (e *Exporter) encode(logs []*sdklog.LogData) ([]byte, error) {
+	raw, err := protojson.MarshalOptions{
+		UseEnumNumbers: true,
+	}.Marshal(&collogpb.ExportLogsServiceRequest{
+		ResourceLogs: transform.Logs(logs),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// protojson encodes bytes fields as base64, OTLP-JSON requires trace
+	// and span IDs to be hex encoded.
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var request map[string]any
+	if err := decoder.Decode(&request); err != nil {
+		return nil, err
+	}
+
+	for _, rl := range objects(request["resourceLogs"]) {
+		for _, sl := range objects(rl["scopeLogs"]) {
+			for _, lr := range objects(sl["logRecords"]) {
+				hexID(lr, "traceId")
+				hexID(lr, "spanId")
+			}
+		}
+	}
+
+	var out []byte
+	if e.prettyPrint {
+		out, err = json.MarshalIndent(request, "", "  ")
+	} else {
+		out, err = json.Marshal(request)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, '\n'), nil
+}
+
+func objects(v any) []map[string]any {
+	list, _ := v.([]any)
+
+	res := make([]map[string]any, 0, len(list))
+	for _, item := range list {
+		if m, ok := item.(map[string]any); ok {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// hexID rewrites the base64 encoded ID stored under key as hex, removing it
+// when the ID is unset.
+func hexID(record map[string]any, key string) {
+	encoded, ok := record[key].(string)
+	if !ok {
+		return
+	}
+
+	id, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(bytes.Trim(id, "\x00")) == 0 {
+		delete(record, key)
+		return
+	}
+
+	record[key] = hex.EncodeToString(id)
+}
@@ -0,0 +1,156 @@
+package stdoutlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+
+	"oteltail/internal/telemetry/sdklog"
+)
+
+func TestExportLogs(t *testing.T) {
+	var buf bytes.Buffer
+	e, err := New(WithWriter(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	traced := &sdklog.LogData{
+		Resource:             resource.NewSchemaless(attribute.String("service.name", "oteltail")),
+		InstrumentationScope: instrumentation.Scope{Name: "log/slog"},
+		TraceID:              trace.TraceID{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c},
+		SpanID:               trace.SpanID{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74},
+	}
+	traced.SetTimestamp(time.Unix(1700000000, 5))
+	traced.SetSeverity(log.SeverityError)
+	traced.SetBody(log.StringValue("line"))
+	traced.AddAttributes(log.String("__aws_log_type", "cloudwatch"), log.Int("status", 500))
+
+	untraced := &sdklog.LogData{
+		Resource:             traced.Resource,
+		InstrumentationScope: traced.InstrumentationScope,
+	}
+	untraced.SetBody(log.StringValue("other"))
+
+	if err := e.ExportLogs(context.Background(), []*sdklog.LogData{traced, untraced}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(buf.String(), "}\n") || strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("output = %q, want a single line", buf.String())
+	}
+
+	var request struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string
+					Value map[string]any
+				}
+			}
+			ScopeLogs []struct {
+				Scope struct {
+					Name string
+				}
+				LogRecords []map[string]any
+			}
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &request); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(request.ResourceLogs) != 1 || len(request.ResourceLogs[0].ScopeLogs) != 1 {
+		t.Fatalf("request = %s, want a single resource and scope", buf.String())
+	}
+	rl := request.ResourceLogs[0]
+	if attrs := rl.Resource.Attributes; len(attrs) != 1 || attrs[0].Key != "service.name" || attrs[0].Value["stringValue"] != "oteltail" {
+		t.Errorf("resource attributes = %v, want service.name", attrs)
+	}
+	if name := rl.ScopeLogs[0].Scope.Name; name != "log/slog" {
+		t.Errorf("scope = %q, want log/slog", name)
+	}
+
+	records := rl.ScopeLogs[0].LogRecords
+	if len(records) != 2 {
+		t.Fatalf("%d records, want 2", len(records))
+	}
+
+	// the OTLP-JSON encoding of the fields protojson renders differently
+	want := map[string]any{
+		"timeUnixNano":   "1700000000000000005",
+		"severityNumber": float64(log.SeverityError),
+		"traceId":        "5b8efff798038103d269b633813fc60c",
+		"spanId":         "eee19b7ec3c1b174",
+		"body":           map[string]any{"stringValue": "line"},
+	}
+	for key, value := range want {
+		got, _ := json.Marshal(records[0][key])
+		expected, _ := json.Marshal(value)
+		if !bytes.Equal(got, expected) {
+			t.Errorf("%s = %s, want %s", key, got, expected)
+		}
+	}
+
+	attrs, _ := json.Marshal(records[0]["attributes"])
+	if string(attrs) != `[{"key":"__aws_log_type","value":{"stringValue":"cloudwatch"}},{"key":"status","value":{"intValue":"500"}}]` {
+		t.Errorf("attributes = %s", attrs)
+	}
+
+	for _, key := range []string{"traceId", "spanId"} {
+		if _, ok := records[1][key]; ok {
+			t.Errorf("%s = %v, want unset IDs omitted", key, records[1][key])
+		}
+	}
+}
+
+func TestExportLogsPrettyPrint(t *testing.T) {
+	var buf bytes.Buffer
+	e, err := New(WithWriter(&buf), WithPrettyPrint())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ld sdklog.LogData
+	ld.SetBody(log.StringValue("line"))
+	if err := e.ExportLogs(context.Background(), []*sdklog.LogData{&ld}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "{\n  \"resourceLogs\"") {
+		t.Errorf("output = %q, want it indented", buf.String())
+	}
+	if !json.Valid(buf.Bytes()) {
+		t.Errorf("output = %q, want a JSON document", buf.String())
+	}
+}
+
+func TestExportLogsShutdown(t *testing.T) {
+	var buf bytes.Buffer
+	e, err := New(WithWriter(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var ld sdklog.LogData
+	ld.SetBody(log.StringValue("line"))
+	if err := e.ExportLogs(context.Background(), []*sdklog.LogData{&ld}); err != errStopped {
+		t.Errorf("ExportLogs = %v, want %v", err, errStopped)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("output = %q after the shutdown", buf.String())
+	}
+}
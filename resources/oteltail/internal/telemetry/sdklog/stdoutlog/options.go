@@ -0,0 +1,57 @@
+package stdoutlog
+
+import (
+	"io"
+	"os"
+)
+
+// Option configures the Exporter.
+type Option func(cfg *config)
+
+type config struct {
+	writer      io.Writer
+	path        string
+	prettyPrint bool
+}
+
+func newConfig(opts ...Option) config {
+	cfg := config{
+		writer: os.Stdout,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithWriter sets the writer the Exporter writes to. By default logs are
+// written to os.Stdout.
+//
+// If both this option and WithFile are used, the last used option will take
+// precedence.
+func WithWriter(w io.Writer) Option {
+	return func(cfg *config) {
+		cfg.writer = w
+		cfg.path = ""
+	}
+}
+
+// WithFile makes the Exporter append to the file at path, creating it if it
+// does not exist. The file is closed when the Exporter is shut down.
+//
+// If both this option and WithWriter are used, the last used option will take
+// precedence.
+func WithFile(path string) Option {
+	return func(cfg *config) {
+		cfg.writer = nil
+		cfg.path = path
+	}
+}
+
+// WithPrettyPrint indents each exported request across multiple lines rather
+// than writing one request per line.
+func WithPrettyPrint() Option {
+	return func(cfg *config) {
+		cfg.prettyPrint = true
+	}
+}
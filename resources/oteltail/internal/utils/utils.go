@@ -2,15 +2,14 @@ package utils
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
 	"sort"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
-	"github.com/aws/aws-lambda-go/events"
 	"github.com/prometheus/common/model"
 	"go.opentelemetry.io/otel/trace"
 
@@ -43,40 +42,12 @@ Outer:
 	return fmt.Sprintf("{%s}", strings.Join(lstrs, ", "))
 }
 
-func CheckEventType(ev map[string]interface{}) (interface{}, error) {
-	var s3Event events.S3Event
-	var s3TestEvent events.S3TestEvent
-	var cwEvent events.CloudwatchLogsEvent
-	var kinesisEvent events.KinesisEvent
-	var sqsEvent events.SQSEvent
-	var snsEvent events.SNSEvent
-	var eventBridgeEvent events.CloudWatchEvent
-
-	types := [...]interface{}{&s3Event, &s3TestEvent, &cwEvent, &kinesisEvent, &sqsEvent, &snsEvent, &eventBridgeEvent}
-
-	j, _ := json.Marshal(ev)
-	reader := strings.NewReader(string(j))
-	d := json.NewDecoder(reader)
-	d.DisallowUnknownFields()
-
-	for _, t := range types {
-		err := d.Decode(t)
-
-		if err == nil {
-			return t, nil
-		}
-
-		reader.Seek(0, 0)
-	}
-
-	return nil, fmt.Errorf("unknown event type!")
-}
-
 // getUnixSecNsec returns the Unix time seconds and nanoseconds in the string s.
 // It assumes that the first 10 digits of the parsed int is the Unix time in seconds and the rest is the nanoseconds part.
 // This assumption will hold until 2286-11-20 17:46:40 UTC, so it's a safe assumption.
 // It also makes use of the fact that the log10 of a number in base 10 is its number of digits - 1.
 // It returns early if the fractional seconds is 0 because getting the log10 of 0 results in -Inf.
+// Zero and negative values are rejected, they have no log10 either.
 // For example, given a string 1234567890123:
 //
 //	iLog10 = 12  // the parsed int is 13 digits long
@@ -96,6 +67,9 @@ func GetUnixSecNsec(s string) (sec int64, nsec int64, err error) {
 	if err != nil {
 		return sec, nsec, err
 	}
+	if i <= 0 {
+		return sec, nsec, fmt.Errorf("invalid unix time %s", s)
+	}
 
 	iLog10 := int(math.Log10(float64(i)))
 	multiplier := math.Pow10(UNIX_SEC_LOG10 - iLog10)
@@ -152,3 +126,19 @@ func ParseTraceID(xrayTraceID string) (trace.TraceID, error) {
 	result := epochPart + uniquePart
 	return trace.TraceIDFromHex(result)
 }
+
+// UTF8Cut returns the largest length of at most n bytes which does not cut
+// s in the middle of a rune.
+func UTF8Cut(s string, n int) int {
+	if n >= len(s) {
+		return len(s)
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	if n == 0 {
+		// a single rune longer than n bytes
+		_, n = utf8.DecodeRuneInString(s)
+	}
+	return n
+}